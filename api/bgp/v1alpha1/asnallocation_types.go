@@ -0,0 +1,70 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AsnAllocationSpec defines the owner of an allocated local AS number
+type AsnAllocationSpec struct {
+	// ASNumber is the allocated AS number, it is also encoded in the object name
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4294967295
+	ASNumber int64 `json:"asNumber"`
+
+	// Node owns the AS number if it is allocated per node
+	// +optional
+	Node string `json:"node,omitempty"`
+
+	// TopologyValue owns the AS number if it is allocated per rack
+	// +optional
+	TopologyValue string `json:"topologyValue,omitempty"`
+}
+
+// AsnAllocationName returns the name of the allocation of an AS number, a second allocation of the same number conflicts
+func AsnAllocationName(asNumber int64) string {
+	return "as" + strconv.FormatInt(asNumber, 10)
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="AS Number",type=integer,JSONPath=`.spec.asNumber`
+//+kubebuilder:printcolumn:name="Node",type=string,JSONPath=`.spec.node`
+//+kubebuilder:printcolumn:name="Topology Value",type=string,JSONPath=`.spec.topologyValue`
+
+// AsnAllocation records a local AS number allocated to a node or rack, like an IPAM handle
+type AsnAllocation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AsnAllocationSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AsnAllocationList contains a list of AsnAllocation
+type AsnAllocationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AsnAllocation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AsnAllocation{}, &AsnAllocationList{})
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"slices"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/sapcc/cni-nanny/api/bgp/v1beta1"
+)
+
+// TopologyValueAnnotation keeps spec.topologyValue of v1beta1 objects if it differs from the object name
+const TopologyValueAnnotation = "bgp.cninanny.sap.cc/topology-value"
+
+// ConvertTo converts this BgpPeerDiscovery to the Hub version (v1beta1).
+func (src *BgpPeerDiscovery) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.BgpPeerDiscovery)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	dst.Spec.TopologyValue = src.Name
+	if value, ok := src.Annotations[TopologyValueAnnotation]; ok {
+		dst.Spec.TopologyValue = value
+		delete(dst.Annotations, TopologyValueAnnotation)
+	}
+	spec := src.Spec.DeepCopy()
+	dst.Spec.StaticPeers = spec.StaticPeers
+	dst.Spec.ExcludedPeers = spec.ExcludedPeers
+	dst.Spec.RediscoverGeneration = src.Spec.RediscoverGeneration
+
+	dst.Status.PeeringProfile = src.Status.PeeringProfile
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.ObservedRediscoverGeneration = src.Status.ObservedRediscoverGeneration
+	dst.Status.Conditions = src.Status.DeepCopy().Conditions
+	dst.Status.EffectivePeers = nil
+	for _, peer := range src.Status.EffectivePeers {
+		dst.Status.EffectivePeers = append(dst.Status.EffectivePeers, v1beta1.EffectivePeer{IP: peer.IP, Origin: v1beta1.PeerOrigin(peer.Origin),
+			RemoteAS: peer.RemoteAS, RemoteASSource: peer.RemoteASSource})
+	}
+	dst.Status.NodePeers = nil
+	for node, nodePeers := range src.Status.NodePeers {
+		if dst.Status.NodePeers == nil {
+			dst.Status.NodePeers = map[string]v1beta1.NodePeers{}
+		}
+		dst.Status.NodePeers[node] = v1beta1.NodePeers{Peers: slices.Clone(nodePeers.Peers), LastSeen: nodePeers.LastSeen}
+	}
+	dst.Status.NodeExceptions = nil
+	for _, exception := range src.Status.NodeExceptions {
+		dst.Status.NodeExceptions = append(dst.Status.NodeExceptions, v1beta1.NodeException{Node: exception.Node, Peers: slices.Clone(exception.Peers)})
+	}
+	dst.Status.Sessions = nil
+	for _, session := range src.Status.Sessions {
+		nodes := make([]v1beta1.NodeSession, 0, len(session.Nodes))
+		for _, node := range session.Nodes {
+			nodes = append(nodes, v1beta1.NodeSession(node))
+		}
+		dst.Status.Sessions = append(dst.Status.Sessions, v1beta1.PeerSession{IP: session.IP, Established: session.Established, Nodes: nodes})
+	}
+	dst.Status.Peers = nil
+	for _, peer := range src.Status.PeerList() {
+		dst.Status.Peers = append(dst.Status.Peers, v1beta1.DiscoveredPeer{
+			IP:            peer.IP,
+			AddressFamily: v1beta1.AddressFamily(peer.AddressFamily),
+			Interface:     peer.Interface,
+			SourceNode:    peer.SourceNode,
+			Source:        v1beta1.PeerSource{Address: peer.Source.Address, NodeIP: peer.Source.NodeIP},
+			FirstSeen:     peer.FirstSeen,
+			LastSeen:      peer.LastSeen,
+			Method:        v1beta1.DiscoveryMethod(peer.Method),
+			Validations:   convertValidationsTo(peer.Validations),
+		})
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *BgpPeerDiscovery) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.BgpPeerDiscovery)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	if src.Spec.TopologyValue != "" && src.Spec.TopologyValue != src.Name {
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[TopologyValueAnnotation] = src.Spec.TopologyValue
+	}
+	spec := src.Spec.DeepCopy()
+	dst.Spec.StaticPeers = spec.StaticPeers
+	dst.Spec.ExcludedPeers = spec.ExcludedPeers
+	dst.Spec.RediscoverGeneration = src.Spec.RediscoverGeneration
+
+	dst.Status.PeeringProfile = src.Status.PeeringProfile
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.ObservedRediscoverGeneration = src.Status.ObservedRediscoverGeneration
+	dst.Status.Conditions = src.Status.DeepCopy().Conditions
+	dst.Status.EffectivePeers = nil
+	for _, peer := range src.Status.EffectivePeers {
+		dst.Status.EffectivePeers = append(dst.Status.EffectivePeers, EffectivePeer{IP: peer.IP, Origin: PeerOrigin(peer.Origin),
+			RemoteAS: peer.RemoteAS, RemoteASSource: peer.RemoteASSource})
+	}
+	dst.Status.NodePeers = nil
+	for node, nodePeers := range src.Status.NodePeers {
+		if dst.Status.NodePeers == nil {
+			dst.Status.NodePeers = map[string]NodePeers{}
+		}
+		dst.Status.NodePeers[node] = NodePeers{Peers: slices.Clone(nodePeers.Peers), LastSeen: nodePeers.LastSeen}
+	}
+	dst.Status.NodeExceptions = nil
+	for _, exception := range src.Status.NodeExceptions {
+		dst.Status.NodeExceptions = append(dst.Status.NodeExceptions, NodeException{Node: exception.Node, Peers: slices.Clone(exception.Peers)})
+	}
+	dst.Status.Sessions = nil
+	for _, session := range src.Status.Sessions {
+		nodes := make([]NodeSession, 0, len(session.Nodes))
+		for _, node := range session.Nodes {
+			nodes = append(nodes, NodeSession(node))
+		}
+		dst.Status.Sessions = append(dst.Status.Sessions, PeerSession{IP: session.IP, Established: session.Established, Nodes: nodes})
+	}
+	dst.Status.DiscoveredPeers = []string{}
+	dst.Status.Peers = nil
+	for _, peer := range src.Status.Peers {
+		dst.Status.DiscoveredPeers = append(dst.Status.DiscoveredPeers, peer.IP)
+		dst.Status.Peers = append(dst.Status.Peers, DiscoveredPeer{
+			IP:            peer.IP,
+			AddressFamily: AddressFamily(peer.AddressFamily),
+			Interface:     peer.Interface,
+			SourceNode:    peer.SourceNode,
+			Source:        PeerSource{Address: peer.Source.Address, NodeIP: peer.Source.NodeIP},
+			FirstSeen:     peer.FirstSeen,
+			LastSeen:      peer.LastSeen,
+			Method:        DiscoveryMethod(peer.Method),
+			Validations:   convertValidationsFrom(peer.Validations),
+		})
+	}
+	return nil
+}
+
+func convertValidationsTo(in []PeerValidation) []v1beta1.PeerValidation {
+	if in == nil {
+		return nil
+	}
+	out := make([]v1beta1.PeerValidation, 0, len(in))
+	for _, v := range in {
+		out = append(out, v1beta1.PeerValidation{Type: v.Type, Passed: v.Passed, Message: v.Message})
+	}
+	return out
+}
+
+func convertValidationsFrom(in []v1beta1.PeerValidation) []PeerValidation {
+	if in == nil {
+		return nil
+	}
+	out := make([]PeerValidation, 0, len(in))
+	for _, v := range in {
+		out = append(out, PeerValidation{Type: v.Type, Passed: v.Passed, Message: v.Message})
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sapcc/cni-nanny/api/bgp/v1beta1"
+)
+
+var _ = Describe("BgpPeerDiscovery conversion", func() {
+
+	seen := metav1.NewTime(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	newDiscovery := func() *BgpPeerDiscovery {
+		discovery := &BgpPeerDiscovery{}
+		discovery.Name = "rack1"
+		discovery.Namespace = "cni-nanny"
+		discovery.Annotations = map[string]string{DeletionPolicyAnnotation: string(DeletionPolicyOrphan)}
+		discovery.Spec = BgpPeerDiscoverySpec{
+			StaticPeers:          []string{"10.0.0.9"},
+			ExcludedPeers:        []string{"10.0.0.8"},
+			RediscoverGeneration: 2,
+		}
+		discovery.Status = BgpPeerDiscoveryStatus{
+			DiscoveredPeers: []string{"10.0.0.1"},
+			Peers: []DiscoveredPeer{{
+				IP:            "10.0.0.1",
+				AddressFamily: AddressFamilyIPv4,
+				Interface:     "eth0",
+				SourceNode:    "node-a",
+				Source:        PeerSource{Address: "10.1.0.5", NodeIP: true},
+				FirstSeen:     seen,
+				LastSeen:      seen,
+				Method:        DiscoveryMethodTraceroute,
+				Validations:   []PeerValidation{{Type: ValidationReachable, Passed: true, Message: "1ms"}},
+			}},
+			EffectivePeers: []EffectivePeer{
+				{IP: "10.0.0.1", Origin: PeerOriginDiscovered, RemoteAS: 65000, RemoteASSource: "rules.yaml"},
+				{IP: "10.0.0.9", Origin: PeerOriginStatic},
+			},
+			PeeringProfile: "default",
+			NodePeers:      map[string]NodePeers{"node-a": {Peers: []string{"10.0.0.1"}, LastSeen: seen}},
+			NodeExceptions: []NodeException{{Node: "node-b", Peers: []string{"10.0.0.2"}}},
+			Sessions: []PeerSession{{IP: "10.0.0.1", Established: 1,
+				Nodes: []NodeSession{{Node: "node-a", State: "Established", Since: "1h"}}}},
+			ObservedGeneration:           3,
+			ObservedRediscoverGeneration: 2,
+			Conditions: []metav1.Condition{{Type: ConditionDiscovered, Status: metav1.ConditionTrue,
+				Reason: "PeersDiscovered", LastTransitionTime: seen}},
+		}
+		return discovery
+	}
+
+	It("keeps every field from v1alpha1 through v1beta1 and back", func() {
+		src := newDiscovery()
+		hub := &v1beta1.BgpPeerDiscovery{}
+		Expect(src.ConvertTo(hub)).To(Succeed())
+		Expect(hub.Spec.TopologyValue).To(Equal("rack1"))
+		Expect(hub.Status.Peers).To(HaveLen(1))
+
+		dst := &BgpPeerDiscovery{}
+		Expect(dst.ConvertFrom(hub)).To(Succeed())
+		Expect(dst).To(Equal(newDiscovery()))
+	})
+
+	It("keeps a topology value differing from the name in an annotation", func() {
+		src := newDiscovery()
+		src.Annotations[TopologyValueAnnotation] = "rack/1"
+		hub := &v1beta1.BgpPeerDiscovery{}
+		Expect(src.ConvertTo(hub)).To(Succeed())
+		Expect(hub.Spec.TopologyValue).To(Equal("rack/1"))
+		Expect(hub.Annotations).NotTo(HaveKey(TopologyValueAnnotation))
+
+		dst := &BgpPeerDiscovery{}
+		Expect(dst.ConvertFrom(hub)).To(Succeed())
+		Expect(dst).To(Equal(src))
+
+		By("converting the hub again")
+		again := &v1beta1.BgpPeerDiscovery{}
+		Expect(dst.ConvertTo(again)).To(Succeed())
+		Expect(again).To(Equal(hub))
+	})
+
+	It("builds structured peers of objects written by older discovery jobs", func() {
+		src := newDiscovery()
+		src.Status.Peers = nil
+		hub := &v1beta1.BgpPeerDiscovery{}
+		Expect(src.ConvertTo(hub)).To(Succeed())
+		Expect(hub.Status.Peers).To(ConsistOf(HaveField("IP", "10.0.0.1")))
+
+		dst := &BgpPeerDiscovery{}
+		Expect(dst.ConvertFrom(hub)).To(Succeed())
+		Expect(dst.Status.DiscoveredPeers).To(Equal([]string{"10.0.0.1"}))
+		Expect(dst.Status.Peers).To(ConsistOf(HaveField("IP", "10.0.0.1")))
+	})
+})
@@ -17,23 +17,318 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"net"
+	"strings"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+const (
+	PeerSourceNode      = "bgp.cninanny.sap.cc/source-node"
+	PeerDiscoveryMethod = "bgp.cninanny.sap.cc/discovery-method"
+	PeerInterface       = "bgp.cninanny.sap.cc/interface"
+	// PeerSourceAddress records on a BGPPeer the probe source address, Calico can only use it for the session if it is the node IP
+	PeerSourceAddress = "bgp.cninanny.sap.cc/source-address"
+	// PeerReplacedAt marks a BGPPeer replaced by a rollout whose sessions are not verified yet
+	PeerReplacedAt = "bgp.cninanny.sap.cc/replaced-at"
+	// PeerSessionReset marks a replaced BGPPeer whose change restarts its sessions, they must be established anew
+	PeerSessionReset = "bgp.cninanny.sap.cc/session-reset"
+	// PeerStaleSince marks a BGPPeer whose peer is no longer effective, it is deleted after a grace period
+	PeerStaleSince = "bgp.cninanny.sap.cc/stale-since"
+	// PasswordSource records on a copy of a BGP password Secret the name of the Secret it was copied from
+	PasswordSource = "bgp.cninanny.sap.cc/password-source"
+	// PoolRetiringSince marks a disabled IPPool of an empty rack, it is deleted after a grace period
+	PoolRetiringSince = "bgp.cninanny.sap.cc/retiring-since"
+)
+
+// DeletionPolicyAnnotation overrides the deletion policy of the BGPPeers of a BgpPeerDiscovery
+const DeletionPolicyAnnotation = "bgp.cninanny.sap.cc/deletion-policy"
+
+// DeletionPolicy decides what happens to the BGPPeers of a deleted BgpPeerDiscovery
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyCleanup deletes the BGPPeers
+	DeletionPolicyCleanup DeletionPolicy = "Cleanup"
+	// DeletionPolicyOrphan keeps the BGPPeers and removes their ownership labels
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// Valid reports whether p is a known deletion policy
+func (p DeletionPolicy) Valid() bool {
+	return p == DeletionPolicyCleanup || p == DeletionPolicyOrphan
+}
+
 // BgpPeerDiscoverySpec defines the desired state of BgpPeerDiscovery
 type BgpPeerDiscoverySpec struct {
-	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// StaticPeers are always peered with, whether discovery finds them or not
+	// +optional
+	StaticPeers []string `json:"static_peers,omitempty"`
+
+	// ExcludedPeers are never peered with, each entry is an IP or a CIDR
+	// +optional
+	ExcludedPeers []string `json:"excluded_peers,omitempty"`
+
+	// RediscoverGeneration triggers a new discovery of the rack when increased
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RediscoverGeneration int64 `json:"rediscover_generation,omitempty"`
 }
 
 // BgpPeerDiscoveryStatus defines the observed state of BgpPeerDiscovery
 type BgpPeerDiscoveryStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// DiscoveredPeers lists the IPs of discovered peers, kept for compatibility with older consumers
 	DiscoveredPeers []string `json:"discovered_peers"`
+
+	// Peers describes each discovered peer and how it was found
+	// +optional
+	Peers []DiscoveredPeer `json:"peers,omitempty"`
+
+	// EffectivePeers are the peers BGPPeers are applied for, after merging static and excluded peers
+	// +optional
+	EffectivePeers []EffectivePeer `json:"effective_peers,omitempty"`
+
+	// PeeringProfile is the PeeringProfile the BGPPeers of the rack are rendered from
+	// +optional
+	PeeringProfile string `json:"peering_profile,omitempty"`
+
+	// NodePeers lists the peers discovered by each node of the rack, set by per-node discovery
+	// +optional
+	NodePeers map[string]NodePeers `json:"node_peers,omitempty"`
+
+	// NodeExceptions are the nodes whose peers differ from the majority of the rack, they get node-specific BGPPeers
+	// +optional
+	NodeExceptions []NodeException `json:"node_exceptions,omitempty"`
+
+	// Sessions aggregates the BGP session state of each effective peer on the sampled nodes of the rack
+	// +optional
+	Sessions []PeerSession `json:"sessions,omitempty"`
+
+	// ObservedGeneration is the generation last processed by the controllers
+	// +optional
+	ObservedGeneration int64 `json:"observed_generation,omitempty"`
+
+	// ObservedRediscoverGeneration is the last RediscoverGeneration a discovery was started for
+	// +optional
+	ObservedRediscoverGeneration int64 `json:"observed_rediscover_generation,omitempty"`
+
+	// Conditions describe the state of discovery and peering of the rack
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// AddressFamily of a discovered peer
+// +kubebuilder:validation:Enum=IPv4;IPv6
+type AddressFamily string
+
+const (
+	AddressFamilyIPv4 AddressFamily = "IPv4"
+	AddressFamilyIPv6 AddressFamily = "IPv6"
+)
+
+// DiscoveryMethod describes how a peer was found
+// +kubebuilder:validation:Enum=Traceroute;Cache
+type DiscoveryMethod string
+
+const (
+	// DiscoveryMethodTraceroute means the peer answered a full traceroute scan
+	DiscoveryMethodTraceroute DiscoveryMethod = "Traceroute"
+	// DiscoveryMethodCache means a cached peer was re-verified without a full scan
+	DiscoveryMethodCache DiscoveryMethod = "Cache"
+)
+
+const (
+	// ValidationReachable checks that the peer answers direct probes
+	ValidationReachable = "Reachable"
+	// ValidationDirectlyConnected checks that the peer is inside a subnet of a local interface
+	ValidationDirectlyConnected = "DirectlyConnected"
+)
+
+// DiscoveredPeer is a BGP peer found by discovery
+type DiscoveredPeer struct {
+	// IP is the address of the peer
+	IP string `json:"ip"`
+
+	// AddressFamily is the address family of IP
+	AddressFamily AddressFamily `json:"address_family"`
+
+	// Interface is the local interface the peer is reachable on
+	// +optional
+	Interface string `json:"interface,omitempty"`
+
+	// SourceNode is the node that discovered the peer
+	// +optional
+	SourceNode string `json:"source_node,omitempty"`
+
+	// Source describes the probe source address the peer was found with
+	// +optional
+	Source PeerSource `json:"source,omitempty"`
+
+	// FirstSeen is the time the peer was discovered first
+	// +optional
+	FirstSeen metav1.Time `json:"first_seen,omitempty"`
+
+	// LastSeen is the time the peer was discovered last
+	// +optional
+	LastSeen metav1.Time `json:"last_seen,omitempty"`
+
+	// Method describes how the peer was discovered
+	Method DiscoveryMethod `json:"method"`
+
+	// Validations lists the checks run against the peer
+	// +optional
+	Validations []PeerValidation `json:"validations,omitempty"`
+}
+
+// PeerValidation is the result of a check run against a discovered peer
+type PeerValidation struct {
+	// Type of the check, e.g. Reachable or DirectlyConnected
+	Type string `json:"type"`
+
+	// Passed is true if the check succeeded
+	Passed bool `json:"passed"`
+
+	// Message describes the result
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PeerOrigin describes where an effective peer came from
+// +kubebuilder:validation:Enum=Discovered;Static
+type PeerOrigin string
+
+const (
+	// PeerOriginDiscovered means the peer was found by discovery
+	PeerOriginDiscovered PeerOrigin = "Discovered"
+	// PeerOriginStatic means the peer is listed in spec.static_peers
+	PeerOriginStatic PeerOrigin = "Static"
+)
+
+// EffectivePeer is a peer BGPPeers are applied for
+type EffectivePeer struct {
+	// IP is the address of the peer
+	IP string `json:"ip"`
+
+	// Origin describes where the peer came from
+	Origin PeerOrigin `json:"origin"`
+
+	// RemoteAS is the AS number of the peer
+	// +optional
+	RemoteAS int64 `json:"remote_as,omitempty"`
+
+	// RemoteASSource is the remote AS mapping rule, PeeringProfile or flag the AS number was taken from
+	// +optional
+	RemoteASSource string `json:"remote_as_source,omitempty"`
+}
+
+// NodePeers are the peers discovered by a single node
+type NodePeers struct {
+	// Peers are the IPs of the peers discovered by the node
+	Peers []string `json:"peers"`
+
+	// LastSeen is the time of the last discovery on the node
+	LastSeen metav1.Time `json:"last_seen"`
+}
+
+// NodeException is a node whose peers differ from the majority of its rack
+type NodeException struct {
+	// Node is the name of the node
+	Node string `json:"node"`
+
+	// Peers are the IPs node-specific BGPPeers are applied for
+	Peers []string `json:"peers"`
+}
+
+// PeerSession is the BGP session state of a peer on the sampled nodes of a rack, as reported by CalicoNodeStatus
+type PeerSession struct {
+	// IP is the address of the peer
+	IP string `json:"ip"`
+
+	// Established is the number of sampled nodes with an established session
+	Established int32 `json:"established"`
+
+	// Nodes lists the session state per sampled node
+	// +optional
+	Nodes []NodeSession `json:"nodes,omitempty"`
+}
+
+// NodeSession is the BGP session state of a peer on a single node
+type NodeSession struct {
+	// Node is the name of the node
+	Node string `json:"node"`
+
+	// State is the session state reported by Calico, e.g. Established, Idle or Active
+	State string `json:"state"`
+
+	// Since is the time of the last state change reported by Calico, the uptime of an established session
+	// +optional
+	Since string `json:"since,omitempty"`
+}
+
+// PeerSource describes the source address used to discover a peer
+type PeerSource struct {
+	// Address is the probe source address, empty if it was chosen by the kernel
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// NodeIP is true if Address is the node's Calico BGP address
+	// +optional
+	NodeIP bool `json:"node_ip,omitempty"`
+}
+
+// PeerList returns the structured peers, or peers built from DiscoveredPeers for objects written by older discovery jobs
+func (in *BgpPeerDiscoveryStatus) PeerList() []DiscoveredPeer {
+	if len(in.Peers) > 0 {
+		return in.Peers
+	}
+	peers := make([]DiscoveredPeer, 0, len(in.DiscoveredPeers))
+	for _, ip := range in.DiscoveredPeers {
+		peers = append(peers, DiscoveredPeer{IP: ip, AddressFamily: AddressFamilyOf(ip), Method: DiscoveryMethodTraceroute})
+	}
+	return peers
+}
+
+// Excludes returns true if ip is listed in or inside a CIDR of ExcludedPeers
+func (in *BgpPeerDiscoverySpec) Excludes(ip string) bool {
+	parsed := net.ParseIP(ip)
+	for _, excluded := range in.ExcludedPeers {
+		if _, cidr, err := net.ParseCIDR(excluded); err == nil {
+			if parsed != nil && cidr.Contains(parsed) {
+				return true
+			}
+			continue
+		}
+		if excludedIP := net.ParseIP(excluded); excludedIP != nil && excludedIP.Equal(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Failed returns true if the validation of the given type ran against the peer and failed
+func (in *DiscoveredPeer) Failed(validationType string) bool {
+	for _, v := range in.Validations {
+		if v.Type == validationType && !v.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+// AddressFamilyOf returns the address family of an IP
+func AddressFamilyOf(ip string) AddressFamily {
+	if strings.Contains(ip, ":") {
+		return AddressFamilyIPv6
+	}
+	return AddressFamilyIPv4
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,58 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Condition types of BgpPeerDiscovery
+const (
+	// ConditionDiscovered is set by the discovery job once peers of the rack were found
+	ConditionDiscovered = "Discovered"
+	// ConditionPeersApplied is set once Calico BGPPeers exist for all discovered peers
+	ConditionPeersApplied = "PeersApplied"
+	// ConditionDegraded is set if some peers could not be applied
+	ConditionDegraded = "Degraded"
+	// ConditionStalled is set if discovery of the rack does not make progress
+	ConditionStalled = "Stalled"
+)
+
+// Condition reasons of BgpPeerDiscovery
+const (
+	ReasonPeersDiscovered         = "PeersDiscovered"
+	ReasonNoPeersFound            = "NoPeersFound"
+	ReasonPeersApplied            = "BGPPeersApplied"
+	ReasonApplyFailed             = "ApplyFailed"
+	ReasonUnreachablePeers        = "UnreachablePeers"
+	ReasonDiscoveryNotProgressing = "DiscoveryNotProgressing"
+	ReasonRediscoveryRequested    = "RediscoveryRequested"
+	ReasonPeersReplacing          = "PeersReplacing"
+	ReasonSessionNotEstablished   = "SessionNotEstablished"
+	ReasonStalePeersRetiring      = "StalePeersRetiring"
+	ReasonFilterMissing           = "FilterMissing"
+	ReasonAsExpected              = "AsExpected"
+)
+
+// Condition types of PeeringFilter
+const (
+	// ConditionFilterApplied is set once the PeeringFilter was rendered into its Calico BGPFilter
+	ConditionFilterApplied = "FilterApplied"
+)
+
+// Condition reasons of PeeringFilter
+const (
+	ReasonFilterApplied    = "BGPFilterApplied"
+	ReasonInvalidCIDRs     = "InvalidCIDRs"
+	ReasonFilterNotManaged = "BGPFilterNotManaged"
+)
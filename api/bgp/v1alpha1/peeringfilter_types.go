@@ -0,0 +1,90 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PeeringFilterSpec defines the desired state of PeeringFilter
+type PeeringFilterSpec struct {
+	// Import selects the routes accepted from the peers, all routes are accepted if nothing is selected
+	// +optional
+	Import RouteSelection `json:"import,omitempty"`
+
+	// Export selects the routes advertised to the peers, all routes are advertised if nothing is selected
+	// +optional
+	Export RouteSelection `json:"export,omitempty"`
+}
+
+// RouteSelection selects routes by prefix, once anything is selected all other routes are rejected
+type RouteSelection struct {
+	// DefaultRoute selects the default routes 0.0.0.0/0 and ::/0
+	// +optional
+	DefaultRoute bool `json:"defaultRoute,omitempty"`
+
+	// PodCIDRs selects the CIDRs of the enabled Calico IPPools and the prefixes within them
+	// +optional
+	PodCIDRs bool `json:"podCIDRs,omitempty"`
+
+	// LoadBalancerIPs selects the serviceLoadBalancerIPs of the default Calico BGPConfiguration and the prefixes within them
+	// +optional
+	LoadBalancerIPs bool `json:"loadBalancerIPs,omitempty"`
+
+	// CIDRs selects further CIDRs and the prefixes within them
+	// +optional
+	CIDRs []string `json:"cidrs,omitempty"`
+}
+
+// Empty reports whether the selection selects no routes
+func (s RouteSelection) Empty() bool {
+	return !s.DefaultRoute && !s.PodCIDRs && !s.LoadBalancerIPs && len(s.CIDRs) == 0
+}
+
+// PeeringFilterStatus defines the observed state of PeeringFilter
+type PeeringFilterStatus struct {
+	// Conditions describe whether the filter was rendered into its Calico BGPFilter
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// PeeringFilter is the Schema for the peeringfilters API, it is rendered into the Calico BGPFilter of the same name
+type PeeringFilter struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PeeringFilterSpec   `json:"spec,omitempty"`
+	Status PeeringFilterStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PeeringFilterList contains a list of PeeringFilter
+type PeeringFilterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PeeringFilter `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PeeringFilter{}, &PeeringFilterList{})
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PeeringProfileAnnotation records the PeeringProfile a BGPPeer was rendered from
+const PeeringProfileAnnotation = "bgp.cninanny.sap.cc/peering-profile"
+
+// PeeringProfileSpec defines the desired state of PeeringProfile
+type PeeringProfileSpec struct {
+	// TopologyValues selects racks by their topology value
+	// +optional
+	TopologyValues []string `json:"topologyValues,omitempty"`
+
+	// NodeSelector selects racks with at least one node matching the selector
+	// +optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	// Template is rendered into every BGPPeer of a selected rack
+	Template BGPPeerTemplate `json:"template"`
+
+	// BGPConfiguration is rendered into the node-specific Calico BGPConfiguration node.<name> of every node of a
+	// selected rack, the nodes keep the cluster-wide BGPConfiguration if unset
+	// +optional
+	BGPConfiguration *BGPConfigurationTemplate `json:"bgpConfiguration,omitempty"`
+}
+
+// BGPPeerTemplate holds the Calico BGPPeer fields set by a PeeringProfile
+type BGPPeerTemplate struct {
+	// ASNumber of the peers, defaults to --bgp-remote-as
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4294967295
+	// +optional
+	ASNumber *int64 `json:"asNumber,omitempty"`
+
+	// Filters are the BGPFilters applied to the peers, defaults to --bgp-filters
+	// +optional
+	Filters []string `json:"filters,omitempty"`
+
+	// KeepOriginalNextHop keeps the next hop of routes received from the peers
+	// +optional
+	KeepOriginalNextHop bool `json:"keepOriginalNextHop,omitempty"`
+
+	// MaxRestartTime is the graceful restart time of the sessions
+	// +optional
+	MaxRestartTime *metav1.Duration `json:"maxRestartTime,omitempty"`
+
+	// TTLSecurity is the number of hops a peer may be away, enables GTSM if set
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=255
+	// +optional
+	TTLSecurity *int32 `json:"ttlSecurity,omitempty"`
+
+	// Password of the sessions
+	// +optional
+	Password *BGPPassword `json:"password,omitempty"`
+
+	// NumAllowedLocalASNumbers is the number of times the local AS may appear in received AS paths
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	NumAllowedLocalASNumbers *int32 `json:"numAllowedLocalASNumbers,omitempty"`
+
+	// ReachableBy is the gateway the peers are reachable by, for peers that are not directly connected
+	// +optional
+	ReachableBy string `json:"reachableBy,omitempty"`
+}
+
+// BGPConfigurationTemplate holds the Calico BGPConfiguration fields set per node by a PeeringProfile. Service IPs are
+// only advertised as configured in the default BGPConfiguration, Calico ignores them in node-specific ones.
+type BGPConfigurationTemplate struct {
+	// ListenPort is the port BIRD listens on for BGP sessions
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	ListenPort *int32 `json:"listenPort,omitempty"`
+
+	// Communities are named BGP communities usable in prefixAdvertisements
+	// +optional
+	Communities []BGPCommunity `json:"communities,omitempty"`
+
+	// PrefixAdvertisements attach communities to the advertised prefixes
+	// +optional
+	PrefixAdvertisements []PrefixAdvertisement `json:"prefixAdvertisements,omitempty"`
+}
+
+// BGPCommunity names a standard community aa:nn or a large community aa:nn:mm
+type BGPCommunity struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PrefixAdvertisement attaches communities to the routes of a CIDR
+type PrefixAdvertisement struct {
+	CIDR string `json:"cidr"`
+
+	// Communities are names of communities or community values
+	Communities []string `json:"communities"`
+}
+
+// BGPPassword references the password of a BGP session
+type BGPPassword struct {
+	// SecretKeyRef selects the key of a Secret holding the password
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PeeringProfile is the Schema for the peeringprofiles API
+type PeeringProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PeeringProfileSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PeeringProfileList contains a list of PeeringProfile
+type PeeringProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PeeringProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PeeringProfile{}, &PeeringProfileList{})
+}
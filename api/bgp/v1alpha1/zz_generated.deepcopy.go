@@ -5,6 +5,8 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -13,7 +15,7 @@ func (in *BgpPeerDiscovery) DeepCopyInto(out *BgpPeerDiscovery) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -70,6 +72,16 @@ func (in *BgpPeerDiscoveryList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BgpPeerDiscoverySpec) DeepCopyInto(out *BgpPeerDiscoverySpec) {
 	*out = *in
+	if in.StaticPeers != nil {
+		in, out := &in.StaticPeers, &out.StaticPeers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludedPeers != nil {
+		in, out := &in.ExcludedPeers, &out.ExcludedPeers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BgpPeerDiscoverySpec.
@@ -90,6 +102,46 @@ func (in *BgpPeerDiscoveryStatus) DeepCopyInto(out *BgpPeerDiscoveryStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Peers != nil {
+		in, out := &in.Peers, &out.Peers
+		*out = make([]DiscoveredPeer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EffectivePeers != nil {
+		in, out := &in.EffectivePeers, &out.EffectivePeers
+		*out = make([]EffectivePeer, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodePeers != nil {
+		in, out := &in.NodePeers, &out.NodePeers
+		*out = make(map[string]NodePeers, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.NodeExceptions != nil {
+		in, out := &in.NodeExceptions, &out.NodeExceptions
+		*out = make([]NodeException, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Sessions != nil {
+		in, out := &in.Sessions, &out.Sessions
+		*out = make([]PeerSession, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BgpPeerDiscoveryStatus.
@@ -101,3 +153,559 @@ func (in *BgpPeerDiscoveryStatus) DeepCopy() *BgpPeerDiscoveryStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiscoveredPeer) DeepCopyInto(out *DiscoveredPeer) {
+	*out = *in
+	out.Source = in.Source
+	in.FirstSeen.DeepCopyInto(&out.FirstSeen)
+	in.LastSeen.DeepCopyInto(&out.LastSeen)
+	if in.Validations != nil {
+		in, out := &in.Validations, &out.Validations
+		*out = make([]PeerValidation, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscoveredPeer.
+func (in *DiscoveredPeer) DeepCopy() *DiscoveredPeer {
+	if in == nil {
+		return nil
+	}
+	out := new(DiscoveredPeer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeerSource) DeepCopyInto(out *PeerSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeerSource.
+func (in *PeerSource) DeepCopy() *PeerSource {
+	if in == nil {
+		return nil
+	}
+	out := new(PeerSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeerValidation) DeepCopyInto(out *PeerValidation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeerValidation.
+func (in *PeerValidation) DeepCopy() *PeerValidation {
+	if in == nil {
+		return nil
+	}
+	out := new(PeerValidation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPPassword) DeepCopyInto(out *BGPPassword) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPPassword.
+func (in *BGPPassword) DeepCopy() *BGPPassword {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPPassword)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPPeerTemplate) DeepCopyInto(out *BGPPeerTemplate) {
+	*out = *in
+	if in.ASNumber != nil {
+		in, out := &in.ASNumber, &out.ASNumber
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Filters != nil {
+		in, out := &in.Filters, &out.Filters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxRestartTime != nil {
+		in, out := &in.MaxRestartTime, &out.MaxRestartTime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.TTLSecurity != nil {
+		in, out := &in.TTLSecurity, &out.TTLSecurity
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Password != nil {
+		in, out := &in.Password, &out.Password
+		*out = new(BGPPassword)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NumAllowedLocalASNumbers != nil {
+		in, out := &in.NumAllowedLocalASNumbers, &out.NumAllowedLocalASNumbers
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPPeerTemplate.
+func (in *BGPPeerTemplate) DeepCopy() *BGPPeerTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPPeerTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeeringFilterStatus) DeepCopyInto(out *PeeringFilterStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringFilterStatus.
+func (in *PeeringFilterStatus) DeepCopy() *PeeringFilterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PeeringFilterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeeringProfile) DeepCopyInto(out *PeeringProfile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringProfile.
+func (in *PeeringProfile) DeepCopy() *PeeringProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(PeeringProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PeeringProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeeringProfileList) DeepCopyInto(out *PeeringProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PeeringProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringProfileList.
+func (in *PeeringProfileList) DeepCopy() *PeeringProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(PeeringProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PeeringProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeeringProfileSpec) DeepCopyInto(out *PeeringProfileSpec) {
+	*out = *in
+	if in.TopologyValues != nil {
+		in, out := &in.TopologyValues, &out.TopologyValues
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Template.DeepCopyInto(&out.Template)
+	if in.BGPConfiguration != nil {
+		in, out := &in.BGPConfiguration, &out.BGPConfiguration
+		*out = new(BGPConfigurationTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringProfileSpec.
+func (in *PeeringProfileSpec) DeepCopy() *PeeringProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PeeringProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EffectivePeer) DeepCopyInto(out *EffectivePeer) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EffectivePeer.
+func (in *EffectivePeer) DeepCopy() *EffectivePeer {
+	if in == nil {
+		return nil
+	}
+	out := new(EffectivePeer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeSession) DeepCopyInto(out *NodeSession) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeSession.
+func (in *NodeSession) DeepCopy() *NodeSession {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeSession)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeerSession) DeepCopyInto(out *PeerSession) {
+	*out = *in
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]NodeSession, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeerSession.
+func (in *PeerSession) DeepCopy() *PeerSession {
+	if in == nil {
+		return nil
+	}
+	out := new(PeerSession)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeException) DeepCopyInto(out *NodeException) {
+	*out = *in
+	if in.Peers != nil {
+		in, out := &in.Peers, &out.Peers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeException.
+func (in *NodeException) DeepCopy() *NodeException {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeException)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodePeers) DeepCopyInto(out *NodePeers) {
+	*out = *in
+	if in.Peers != nil {
+		in, out := &in.Peers, &out.Peers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.LastSeen.DeepCopyInto(&out.LastSeen)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodePeers.
+func (in *NodePeers) DeepCopy() *NodePeers {
+	if in == nil {
+		return nil
+	}
+	out := new(NodePeers)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeeringFilter) DeepCopyInto(out *PeeringFilter) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringFilter.
+func (in *PeeringFilter) DeepCopy() *PeeringFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(PeeringFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PeeringFilter) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeeringFilterList) DeepCopyInto(out *PeeringFilterList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PeeringFilter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringFilterList.
+func (in *PeeringFilterList) DeepCopy() *PeeringFilterList {
+	if in == nil {
+		return nil
+	}
+	out := new(PeeringFilterList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PeeringFilterList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeeringFilterSpec) DeepCopyInto(out *PeeringFilterSpec) {
+	*out = *in
+	in.Import.DeepCopyInto(&out.Import)
+	in.Export.DeepCopyInto(&out.Export)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringFilterSpec.
+func (in *PeeringFilterSpec) DeepCopy() *PeeringFilterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PeeringFilterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RouteSelection) DeepCopyInto(out *RouteSelection) {
+	*out = *in
+	if in.CIDRs != nil {
+		in, out := &in.CIDRs, &out.CIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteSelection.
+func (in *RouteSelection) DeepCopy() *RouteSelection {
+	if in == nil {
+		return nil
+	}
+	out := new(RouteSelection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AsnAllocation) DeepCopyInto(out *AsnAllocation) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AsnAllocation.
+func (in *AsnAllocation) DeepCopy() *AsnAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(AsnAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AsnAllocation) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AsnAllocationList) DeepCopyInto(out *AsnAllocationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AsnAllocation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AsnAllocationList.
+func (in *AsnAllocationList) DeepCopy() *AsnAllocationList {
+	if in == nil {
+		return nil
+	}
+	out := new(AsnAllocationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AsnAllocationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AsnAllocationSpec) DeepCopyInto(out *AsnAllocationSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AsnAllocationSpec.
+func (in *AsnAllocationSpec) DeepCopy() *AsnAllocationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AsnAllocationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPConfigurationTemplate) DeepCopyInto(out *BGPConfigurationTemplate) {
+	*out = *in
+	if in.ListenPort != nil {
+		in, out := &in.ListenPort, &out.ListenPort
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Communities != nil {
+		in, out := &in.Communities, &out.Communities
+		*out = make([]BGPCommunity, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrefixAdvertisements != nil {
+		in, out := &in.PrefixAdvertisements, &out.PrefixAdvertisements
+		*out = make([]PrefixAdvertisement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPConfigurationTemplate.
+func (in *BGPConfigurationTemplate) DeepCopy() *BGPConfigurationTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPConfigurationTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPCommunity) DeepCopyInto(out *BGPCommunity) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPCommunity.
+func (in *BGPCommunity) DeepCopy() *BGPCommunity {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPCommunity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrefixAdvertisement) DeepCopyInto(out *PrefixAdvertisement) {
+	*out = *in
+	if in.Communities != nil {
+		in, out := &in.Communities, &out.Communities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrefixAdvertisement.
+func (in *PrefixAdvertisement) DeepCopy() *PrefixAdvertisement {
+	if in == nil {
+		return nil
+	}
+	out := new(PrefixAdvertisement)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BgpPeerDiscoverySpec defines the desired state of BgpPeerDiscovery
+type BgpPeerDiscoverySpec struct {
+	// TopologyValue is the topology value of the rack, defaults to the object name
+	// +optional
+	TopologyValue string `json:"topologyValue,omitempty"`
+
+	// StaticPeers are always peered with, whether discovery finds them or not
+	// +optional
+	StaticPeers []string `json:"staticPeers,omitempty"`
+
+	// ExcludedPeers are never peered with, each entry is an IP or a CIDR
+	// +optional
+	ExcludedPeers []string `json:"excludedPeers,omitempty"`
+
+	// RediscoverGeneration triggers a new discovery of the rack when increased
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RediscoverGeneration int64 `json:"rediscoverGeneration,omitempty"`
+}
+
+// BgpPeerDiscoveryStatus defines the observed state of BgpPeerDiscovery
+type BgpPeerDiscoveryStatus struct {
+	// Peers describes each discovered peer and how it was found
+	// +optional
+	Peers []DiscoveredPeer `json:"peers,omitempty"`
+
+	// EffectivePeers are the peers BGPPeers are applied for, after merging static and excluded peers
+	// +optional
+	EffectivePeers []EffectivePeer `json:"effectivePeers,omitempty"`
+
+	// PeeringProfile is the PeeringProfile the BGPPeers of the rack are rendered from
+	// +optional
+	PeeringProfile string `json:"peeringProfile,omitempty"`
+
+	// NodePeers lists the peers discovered by each node of the rack, set by per-node discovery
+	// +optional
+	NodePeers map[string]NodePeers `json:"nodePeers,omitempty"`
+
+	// NodeExceptions are the nodes whose peers differ from the majority of the rack, they get node-specific BGPPeers
+	// +optional
+	NodeExceptions []NodeException `json:"nodeExceptions,omitempty"`
+
+	// Sessions aggregates the BGP session state of each effective peer on the sampled nodes of the rack
+	// +optional
+	Sessions []PeerSession `json:"sessions,omitempty"`
+
+	// ObservedGeneration is the generation last processed by the controllers
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// ObservedRediscoverGeneration is the last RediscoverGeneration a discovery was started for
+	// +optional
+	ObservedRediscoverGeneration int64 `json:"observedRediscoverGeneration,omitempty"`
+
+	// Conditions describe the state of discovery and peering of the rack
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// AddressFamily of a discovered peer
+// +kubebuilder:validation:Enum=IPv4;IPv6
+type AddressFamily string
+
+// DiscoveryMethod describes how a peer was found
+// +kubebuilder:validation:Enum=Traceroute;Cache
+type DiscoveryMethod string
+
+// DiscoveredPeer is a BGP peer found by discovery
+type DiscoveredPeer struct {
+	// IP is the address of the peer
+	IP string `json:"ip"`
+
+	// AddressFamily is the address family of IP
+	AddressFamily AddressFamily `json:"addressFamily"`
+
+	// Interface is the local interface the peer is reachable on
+	// +optional
+	Interface string `json:"interface,omitempty"`
+
+	// SourceNode is the node that discovered the peer
+	// +optional
+	SourceNode string `json:"sourceNode,omitempty"`
+
+	// Source describes the probe source address the peer was found with
+	// +optional
+	Source PeerSource `json:"source,omitempty"`
+
+	// FirstSeen is the time the peer was discovered first
+	// +optional
+	FirstSeen metav1.Time `json:"firstSeen,omitempty"`
+
+	// LastSeen is the time the peer was discovered last
+	// +optional
+	LastSeen metav1.Time `json:"lastSeen,omitempty"`
+
+	// Method describes how the peer was discovered
+	Method DiscoveryMethod `json:"method"`
+
+	// Validations lists the checks run against the peer
+	// +optional
+	Validations []PeerValidation `json:"validations,omitempty"`
+}
+
+// PeerValidation is the result of a check run against a discovered peer
+type PeerValidation struct {
+	// Type of the check, e.g. Reachable or DirectlyConnected
+	Type string `json:"type"`
+
+	// Passed is true if the check succeeded
+	Passed bool `json:"passed"`
+
+	// Message describes the result
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PeerOrigin describes where an effective peer came from
+// +kubebuilder:validation:Enum=Discovered;Static
+type PeerOrigin string
+
+// EffectivePeer is a peer BGPPeers are applied for
+type EffectivePeer struct {
+	// IP is the address of the peer
+	IP string `json:"ip"`
+
+	// Origin describes where the peer came from
+	Origin PeerOrigin `json:"origin"`
+
+	// RemoteAS is the AS number of the peer
+	// +optional
+	RemoteAS int64 `json:"remoteAS,omitempty"`
+
+	// RemoteASSource is the remote AS mapping rule, PeeringProfile or flag the AS number was taken from
+	// +optional
+	RemoteASSource string `json:"remoteASSource,omitempty"`
+}
+
+// NodePeers are the peers discovered by a single node
+type NodePeers struct {
+	// Peers are the IPs of the peers discovered by the node
+	Peers []string `json:"peers"`
+
+	// LastSeen is the time of the last discovery on the node
+	LastSeen metav1.Time `json:"lastSeen"`
+}
+
+// NodeException is a node whose peers differ from the majority of its rack
+type NodeException struct {
+	// Node is the name of the node
+	Node string `json:"node"`
+
+	// Peers are the IPs node-specific BGPPeers are applied for
+	Peers []string `json:"peers"`
+}
+
+// PeerSession is the BGP session state of a peer on the sampled nodes of a rack, as reported by CalicoNodeStatus
+type PeerSession struct {
+	// IP is the address of the peer
+	IP string `json:"ip"`
+
+	// Established is the number of sampled nodes with an established session
+	Established int32 `json:"established"`
+
+	// Nodes lists the session state per sampled node
+	// +optional
+	Nodes []NodeSession `json:"nodes,omitempty"`
+}
+
+// NodeSession is the BGP session state of a peer on a single node
+type NodeSession struct {
+	// Node is the name of the node
+	Node string `json:"node"`
+
+	// State is the session state reported by Calico, e.g. Established, Idle or Active
+	State string `json:"state"`
+
+	// Since is the time of the last state change reported by Calico, the uptime of an established session
+	// +optional
+	Since string `json:"since,omitempty"`
+}
+
+// PeerSource describes the source address used to discover a peer
+type PeerSource struct {
+	// Address is the probe source address, empty if it was chosen by the kernel
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// NodeIP is true if Address is the node's Calico BGP address
+	// +optional
+	NodeIP bool `json:"nodeIP,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// BgpPeerDiscovery is the Schema for the bgppeerdiscoveries API
+type BgpPeerDiscovery struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BgpPeerDiscoverySpec   `json:"spec,omitempty"`
+	Status BgpPeerDiscoveryStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BgpPeerDiscoveryList contains a list of BgpPeerDiscovery
+type BgpPeerDiscoveryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BgpPeerDiscovery `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BgpPeerDiscovery{}, &BgpPeerDiscoveryList{})
+}
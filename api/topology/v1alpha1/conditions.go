@@ -0,0 +1,39 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Condition types of LabelDiscovery
+const (
+	// ConditionDiscovered is set once the topology values of all nodes were collected
+	ConditionDiscovered = "Discovered"
+	// ConditionPeersApplied is set once every topology value is finalized
+	ConditionPeersApplied = "PeersApplied"
+	// ConditionDegraded is set if discovery jobs of some topology values failed
+	ConditionDegraded = "Degraded"
+	// ConditionStalled is set if topology values stay unfinalized for too long
+	ConditionStalled = "Stalled"
+)
+
+// Condition reasons of LabelDiscovery
+const (
+	ReasonTopologyValuesDiscovered = "TopologyValuesDiscovered"
+	ReasonPeersPending             = "PeersPending"
+	ReasonPeersApplied             = "AllTopologyValuesFinalized"
+	ReasonDiscoveryJobFailed       = "DiscoveryJobFailed"
+	ReasonDiscoveryNotProgressing  = "DiscoveryNotProgressing"
+	ReasonAsExpected               = "AsExpected"
+)
@@ -0,0 +1,60 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/sapcc/cni-nanny/api/topology/v1beta1"
+)
+
+// ConvertTo converts this LabelDiscovery to the Hub version (v1beta1).
+func (src *LabelDiscovery) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.LabelDiscovery)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec.TopologyLabel = src.Spec.TopologyLabel
+	dst.Spec.RediscoverGeneration = src.Spec.RediscoverGeneration
+
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.ObservedRediscoverGeneration = src.Status.ObservedRediscoverGeneration
+	dst.Status.Conditions = src.Status.DeepCopy().Conditions
+	dst.Status.TopologyValues = nil
+	if src.Status.DiscoveredTopologyValues != nil {
+		dst.Status.TopologyValues = make(map[string]v1beta1.TopologyValueStatus, len(src.Status.DiscoveredTopologyValues))
+		for k, v := range src.Status.DiscoveredTopologyValues {
+			dst.Status.TopologyValues[k] = v1beta1.TopologyValueStatus{Finalized: v.Finalized}
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *LabelDiscovery) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.LabelDiscovery)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec.TopologyLabel = src.Spec.TopologyLabel
+	dst.Spec.RediscoverGeneration = src.Spec.RediscoverGeneration
+
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.ObservedRediscoverGeneration = src.Status.ObservedRediscoverGeneration
+	dst.Status.Conditions = src.Status.DeepCopy().Conditions
+	dst.Status.DiscoveredTopologyValues = make(map[string]DiscoveredTopologyValue, len(src.Status.TopologyValues))
+	for k, v := range src.Status.TopologyValues {
+		dst.Status.DiscoveredTopologyValues[k] = DiscoveredTopologyValue{Finalized: v.Finalized}
+	}
+	return nil
+}
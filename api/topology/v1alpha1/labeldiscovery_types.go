@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"slices"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -34,6 +36,11 @@ type LabelDiscoverySpec struct {
 
 	// TopologyLabel is node label used for peer discovery job placement
 	TopologyLabel string `json:"topology_label"`
+
+	// RediscoverGeneration triggers a new discovery of all topology values when increased
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RediscoverGeneration int64 `json:"rediscover_generation,omitempty"`
 }
 
 // LabelDiscoveryStatus defines the observed state of LabelDiscovery
@@ -43,6 +50,32 @@ type LabelDiscoveryStatus struct {
 
 	// DiscoveredTopologyValues collects discovered values
 	DiscoveredTopologyValues map[string]DiscoveredTopologyValue `json:"discovered_topology_values"`
+
+	// ObservedGeneration is the generation last processed by the controllers
+	// +optional
+	ObservedGeneration int64 `json:"observed_generation,omitempty"`
+
+	// ObservedRediscoverGeneration is the last RediscoverGeneration a discovery was started for
+	// +optional
+	ObservedRediscoverGeneration int64 `json:"observed_rediscover_generation,omitempty"`
+
+	// Conditions describe the state of topology discovery and peering
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// PendingTopologyValues returns the sorted topology values that are not finalized yet
+func (in *LabelDiscoveryStatus) PendingTopologyValues() []string {
+	var pending []string
+	for k, v := range in.DiscoveredTopologyValues {
+		if !v.Finalized {
+			pending = append(pending, k)
+		}
+	}
+	slices.Sort(pending)
+	return pending
 }
 
 type DiscoveredTopologyValue struct {
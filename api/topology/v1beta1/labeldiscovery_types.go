@@ -0,0 +1,84 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LabelDiscoverySpec defines the desired state of LabelDiscovery
+type LabelDiscoverySpec struct {
+	// TopologyLabel is node label used for peer discovery job placement
+	TopologyLabel string `json:"topologyLabel"`
+
+	// RediscoverGeneration triggers a new discovery of all topology values when increased
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RediscoverGeneration int64 `json:"rediscoverGeneration,omitempty"`
+}
+
+// LabelDiscoveryStatus defines the observed state of LabelDiscovery
+type LabelDiscoveryStatus struct {
+	// TopologyValues collects discovered values of the topology label
+	// +optional
+	TopologyValues map[string]TopologyValueStatus `json:"topologyValues,omitempty"`
+
+	// ObservedGeneration is the generation last processed by the controllers
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// ObservedRediscoverGeneration is the last RediscoverGeneration a discovery was started for
+	// +optional
+	ObservedRediscoverGeneration int64 `json:"observedRediscoverGeneration,omitempty"`
+
+	// Conditions describe the state of topology discovery and peering
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// TopologyValueStatus is the discovery state of a single topology value
+type TopologyValueStatus struct {
+	// Finalized is true once the BGP peers of the topology value were applied
+	Finalized bool `json:"finalized"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// LabelDiscovery is the Schema for the labeldiscoveries API
+type LabelDiscovery struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LabelDiscoverySpec   `json:"spec,omitempty"`
+	Status LabelDiscoveryStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// LabelDiscoveryList contains a list of LabelDiscovery
+type LabelDiscoveryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LabelDiscovery `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LabelDiscovery{}, &LabelDiscoveryList{})
+}
@@ -16,7 +16,9 @@ package main
 
 import (
 	"flag"
+	"net"
 	"os"
+	"time"
 
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
@@ -31,6 +33,8 @@ import (
 	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
 	"github.com/sapcc/cni-nanny/internal/config"
 	"github.com/sapcc/cni-nanny/internal/controller/bgp"
+	"github.com/sapcc/cni-nanny/internal/discovery"
+	"github.com/sapcc/cni-nanny/internal/monitor"
 )
 
 var (
@@ -47,9 +51,16 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "preflight" {
+		os.Exit(runPreflight(os.Args[2:]))
+	}
+
 	var metricsAddr string
 	var probeAddr string
 	var requeueInterval int
+	var monitorMode bool
+	var monitorInterval time.Duration
+	var monitorProbeCount int
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", "0", "The address the probe endpoint binds to.")
 	flag.IntVar(&requeueInterval, "requeue-interval", 5, "requeue interval in minutes")
@@ -59,6 +70,16 @@ func main() {
 	flag.StringVar(&config.Cfg.NodeTopologyValue, "node-topology-value", "", "The node topology value to handle peer discovery.")
 	flag.IntVar(&config.Cfg.TraceCount, "traceroute-count", 10, "The count of traceroute packets to send.")
 	flag.IntVar(&config.Cfg.BgpNeighborCount, "bgp-neighbor-count", 1, "The count of bgp neighbors.")
+	flag.StringVar(&config.Cfg.NodeName, "node-name", os.Getenv("NODE_NAME"), "The name of the node the discovery runs on.")
+	flag.StringVar(&config.Cfg.SourceAddress, "source-address", "", "The source address of discovery probes.")
+	flag.StringVar(&config.Cfg.SourceInterface, "source-interface", "", "The interface of this node whose address discovery probes are sent from.")
+	flag.BoolVar(&config.Cfg.SourceFromCalico, "source-address-from-calico", false, "Derive the source address of discovery probes from the node's Calico BGP address.")
+	flag.StringVar(&config.Cfg.CacheDir, "cache-dir", "", "The directory to cache the last discovery result in.")
+	flag.BoolVar(&config.Cfg.DiscoveryPerNode, "per-node", false, "Record the peers of this node next to the ones of the other nodes of the rack.")
+	flag.BoolVar(&config.Cfg.VerifyCached, "verify-cached", false, "Only re-check cached peers and fall back to a full scan if they no longer answer.")
+	flag.BoolVar(&monitorMode, "monitor", false, "Continuously probe the peers of the node's rack and export latency and loss metrics instead of running discovery.")
+	flag.DurationVar(&monitorInterval, "monitor-interval", 30*time.Second, "The interval between probe rounds in monitor mode.")
+	flag.IntVar(&monitorProbeCount, "monitor-probe-count", 5, "The count of probes sent to each peer per round in monitor mode.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -80,9 +101,32 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&bgp.TracerouteDiscoveryReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+	if monitorMode {
+		source := net.ParseIP(config.Cfg.SourceAddress)
+		if config.Cfg.SourceInterface != "" {
+			source, err = discovery.InterfaceAddress(config.Cfg.SourceInterface)
+			if err != nil {
+				discLog.Error(err, "unable to resolve the source interface")
+				os.Exit(1)
+			}
+		}
+		if err = mgr.Add(&monitor.Monitor{
+			Client:            mgr.GetAPIReader(),
+			Namespace:         config.Cfg.Namespace,
+			NodeName:          config.Cfg.NodeName,
+			NodeTopologyLabel: config.Cfg.NodeTopologyLabel,
+			NodeTopologyValue: config.Cfg.NodeTopologyValue,
+			Source:            source,
+			Interval:          monitorInterval,
+			ProbeCount:        monitorProbeCount,
+		}); err != nil {
+			discLog.Error(err, "unable to create peer monitor")
+			os.Exit(1)
+		}
+	} else if err = (&bgp.TracerouteDiscoveryReconciler{
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+		Scheme:    mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		discLog.Error(err, "unable to create controller")
 		os.Exit(1)
@@ -0,0 +1,43 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/sapcc/cni-nanny/internal/clients"
+	"github.com/sapcc/cni-nanny/internal/preflight"
+)
+
+// runPreflight checks the environment discovery depends on and returns the process exit code
+func runPreflight(args []string) int {
+	opts := preflight.Options{}
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	fs.StringVar(&opts.NodeName, "node-name", os.Getenv("NODE_NAME"), "The name of the node the discovery runs on.")
+	fs.StringVar(&opts.Namespace, "namespace", "cni-nanny", "The namespace to operate in.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var kube kubernetes.Interface
+	if err := clients.InitializeKubeClient(); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to initialize kubernetes client: %v\n", err)
+	} else {
+		kube = clients.KubeClient
+	}
+
+	if !preflight.Report(os.Stdout, preflight.Run(ctx, kube, opts)) {
+		return 1
+	}
+	return 0
+}
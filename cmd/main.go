@@ -17,15 +17,16 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"net/netip"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/sapcc/cni-nanny/internal/controller/calico"
 
-	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
-
 	"github.com/sapcc/cni-nanny/internal/config"
 	bgpcontroller "github.com/sapcc/cni-nanny/internal/controller/bgp"
 
@@ -33,17 +34,30 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	bgpv1beta1 "github.com/sapcc/cni-nanny/api/bgp/v1beta1"
 	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	topologyv1beta1 "github.com/sapcc/cni-nanny/api/topology/v1beta1"
 	topologycontroller "github.com/sapcc/cni-nanny/internal/controller/topology"
+	"github.com/sapcc/cni-nanny/internal/preflight"
+	webhookbgpv1alpha1 "github.com/sapcc/cni-nanny/internal/webhook/bgp/v1alpha1"
+	webhooktopologyv1alpha1 "github.com/sapcc/cni-nanny/internal/webhook/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/webhook/validation"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -56,8 +70,9 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(bgpv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(bgpv1beta1.AddToScheme(scheme))
 	utilruntime.Must(topologyv1alpha1.AddToScheme(scheme))
-	utilruntime.Must(v3.AddToScheme(scheme))
+	utilruntime.Must(topologyv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -66,7 +81,24 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var requeueInterval int
+	var stalledTimeout int
+	var rolloutTimeout int
+	var sessionStatusNodes int
+	var stalePeerGracePeriod int
+	var bgpPeerDeletionPolicy string
+	var bgpPasswords calico.PasswordConfig
+	var bgpPasswordScope string
+	var remoteASConfigMap string
+	var localASRanges string
+	var localASScope string
+	var rackPoolCIDR string
+	var calicoAPIMode string
+	var rackPoolPrefixLength int
+	var rackPoolGracePeriod int
 	var bgpFilters string
+	var enableWebhooks bool
+	var webhookPort int
+	var webhookCertDir string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":30996", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":30997", "The address the probe endpoint binds to.")
 	flag.StringVar(&config.Cfg.DefaultName, "default-name", "default", "The default resource name.")
@@ -78,10 +110,35 @@ func main() {
 	flag.IntVar(&config.Cfg.BgpRemoteAs, "bgp-remote-as", 12345, "The remote autonomous system of bgp peers.")
 	flag.StringVar(&bgpFilters, "bgp-filters", "", "The BGP filters to apply to peers.")
 	flag.IntVar(&requeueInterval, "requeue-interval", 10, "requeue interval in minutes")
+	flag.IntVar(&rolloutTimeout, "peer-rollout-timeout", 10, "minutes after which a replaced BGPPeer without established sessions is reported as degraded")
+	flag.IntVar(&sessionStatusNodes, "session-status-nodes", 2, "number of nodes per rack BGP session state is reported for, 0 for all nodes, negative to disable")
+	flag.IntVar(&stalePeerGracePeriod, "stale-peer-grace-period", 5, "minutes BGPPeers of peers no longer discovered are kept before they are deleted")
+	flag.StringVar(&bgpPeerDeletionPolicy, "bgp-peer-deletion-policy", string(bgpv1alpha1.DeletionPolicyOrphan), "What happens to the BGPPeers of a deleted BgpPeerDiscovery, Cleanup or Orphan.")
+	flag.StringVar(&remoteASConfigMap, "remote-as-configmap", "", "The ConfigMap in the operator namespace mapping topology values and peer CIDRs to remote AS numbers.")
+	flag.StringVar(&calicoAPIMode, "calico-api-mode", string(calico.APIModeAuto), "The API the Calico resources are managed in, APIServer for projectcalico.org/v3, CRD for crd.projectcalico.org/v1, None to disable the Calico controllers or Auto to detect it.")
+	flag.StringVar(&localASRanges, "local-as-ranges", "", "Comma-separated AS numbers and ranges like 64512-64999 local AS numbers are allocated from, disabled if empty. Requires the Calico Kubernetes datastore.")
+	flag.StringVar(&localASScope, "local-as-scope", string(calico.LocalASScopeNode), "Whether each node or each rack gets its own local AS number, Node or Rack.")
+	flag.StringVar(&rackPoolCIDR, "rack-pool-cidr", "", "The parent CIDR each rack gets its own Calico IPPool from, disabled if empty.")
+	flag.IntVar(&rackPoolPrefixLength, "rack-pool-prefix-length", 0, "The prefix length of the IPPool of a rack, 24 for an IPv4 and 120 for an IPv6 parent CIDR if 0.")
+	flag.IntVar(&rackPoolGracePeriod, "rack-pool-grace-period", 60, "minutes the disabled IPPool of an empty rack is kept before it is deleted")
+	flag.StringVar(&bgpPasswords.Secret, "bgp-password-secret", "", "The Secret in the operator namespace holding the BGP password of the peers, no password is set if empty.")
+	flag.StringVar(&bgpPasswords.Key, "bgp-password-key", "password", "The key of the BGP password in its Secret.")
+	flag.StringVar(&bgpPasswordScope, "bgp-password-scope", string(calico.PasswordScopeGlobal), "Whether all peers share one password Secret or each rack or peer has its own, Global, Rack or Peer.")
+	flag.StringVar(&bgpPasswords.Namespace, "calico-namespace", "kube-system", "The namespace of calico-node, BGP passwords are copied there.")
+	flag.StringVar(&bgpPasswords.ServiceAccount, "calico-node-service-account", "calico-node", "The service account of calico-node allowed to read the BGP passwords.")
+	flag.IntVar(&stalledTimeout, "stalled-timeout", 30, "minutes after which unfinalized topology values are reported as stalled")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&config.Cfg.HostEndpointInterface, "host-endpoint-interface", "", "The interface name for host endpoints.")
+	flag.StringVar(&config.Cfg.SourceInterface, "discovery-source-interface", "", "The interface whose address discovery probes are sent from, resolved on each node.")
+	flag.BoolVar(&config.Cfg.SourceFromCalico, "discovery-source-address-from-calico", false, "Derive the source address of discovery probes from the node's Calico BGP address.")
+	flag.StringVar(&config.Cfg.CacheDir, "discovery-cache-dir", "", "The host directory discovery jobs cache their last result in.")
+	flag.BoolVar(&config.Cfg.DiscoveryPerNode, "discovery-per-node", false, "Run discovery jobs on every node of a rack and give nodes with different peers node-specific BGPPeers.")
+	flag.BoolVar(&config.Cfg.VerifyCached, "discovery-verify-cached", false, "Let discovery jobs only re-check cached peers.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", true, "Serve the conversion, defaulting and validating webhooks of the cni-nanny CRDs.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "The port the webhook server binds to.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "", "The directory containing tls.crt and tls.key of the webhook server.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -94,13 +151,104 @@ func main() {
 	if bgpFilters != "" {
 		config.Cfg.BgpFilters = strings.Split(bgpFilters, ",")
 	}
+	if errs := validation.ValidateASNumber(int64(config.Cfg.BgpRemoteAs), field.NewPath("bgp-remote-as")); len(errs) > 0 {
+		setupLog.Error(errs.ToAggregate(), "invalid flag")
+		os.Exit(1)
+	}
+	if !bgpv1alpha1.DeletionPolicy(bgpPeerDeletionPolicy).Valid() {
+		setupLog.Error(fmt.Errorf("unsupported deletion policy %q", bgpPeerDeletionPolicy), "invalid flag")
+		os.Exit(1)
+	}
+	bgpPasswords.Scope = calico.PasswordScope(bgpPasswordScope)
+	if !bgpPasswords.Scope.Valid() {
+		setupLog.Error(fmt.Errorf("unsupported password scope %q", bgpPasswordScope), "invalid flag")
+		os.Exit(1)
+	}
+	asRanges, err := calico.ParseASRanges(localASRanges)
+	if err != nil {
+		setupLog.Error(err, "invalid flag")
+		os.Exit(1)
+	}
+	if !calico.LocalASScope(localASScope).Valid() {
+		setupLog.Error(fmt.Errorf("unsupported local AS scope %q", localASScope), "invalid flag")
+		os.Exit(1)
+	}
+	var rackPoolParent netip.Prefix
+	if rackPoolCIDR != "" {
+		rackPoolParent, err = netip.ParsePrefix(rackPoolCIDR)
+		if err != nil {
+			setupLog.Error(err, "invalid flag")
+			os.Exit(1)
+		}
+		// the IPPool of a rack has to hold at least one IPAM block of Calico's default size,
+		// by default it holds four of them
+		maxPrefixLength := 26
+		if rackPoolParent.Addr().Is6() {
+			maxPrefixLength = 122
+		}
+		if rackPoolPrefixLength == 0 {
+			rackPoolPrefixLength = maxPrefixLength - 2
+		}
+		if rackPoolPrefixLength <= rackPoolParent.Bits() || rackPoolPrefixLength > maxPrefixLength {
+			setupLog.Error(fmt.Errorf("rack pool prefix length %d must be longer than /%d and at most /%d",
+				rackPoolPrefixLength, rackPoolParent.Bits(), maxPrefixLength), "invalid flag")
+			os.Exit(1)
+		}
+	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	if !calico.APIMode(calicoAPIMode).Valid() {
+		setupLog.Error(fmt.Errorf("unsupported calico API mode %q", calicoAPIMode), "invalid flag")
+		os.Exit(1)
+	}
+
+	restConfig := ctrl.GetConfigOrDie()
+	apiMode, err := calico.DetectAPIMode(restConfig, calico.APIMode(calicoAPIMode))
+	if err != nil {
+		setupLog.Error(err, "unable to detect calico API mode")
+		os.Exit(1)
+	}
+	setupLog.Info("using calico API", "mode", apiMode)
+	if apiMode == calico.APIModeNone && calico.APIMode(calicoAPIMode) == calico.APIModeAuto {
+		setupLog.Info("neither the calico API server nor the calico CRDs serve BGPPeers, the calico controllers are disabled")
+	}
+	if apiMode == calico.APIModeNone && config.Cfg.SourceFromCalico {
+		setupLog.Error(fmt.Errorf("--discovery-source-address-from-calico needs the calico API, the calico API mode is %s", apiMode), "invalid flag")
+		os.Exit(1)
+	}
+	utilruntime.Must(calico.AddToScheme(scheme, apiMode))
+	if apiMode != calico.APIModeNone && bgpPasswords.Secret != "" {
+		// the Roles granting these are namespaced by kustomize, they have to match the flags
+		kube := kubernetes.NewForConfigOrDie(restConfig)
+		for _, access := range bgpPasswords.RequiredAccess(config.Cfg.Namespace) {
+			if check := preflight.CheckAccess(context.Background(), kube, access); !check.Passed {
+				setupLog.Error(fmt.Errorf("%s: %s", check.Name, check.Message),
+					"missing permission for BGP passwords, --namespace and --calico-namespace must match the namespaces of config/default and config/calico-rbac")
+				os.Exit(1)
+			}
+		}
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "operator.cninanny.sap.cc",
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
+		// the manager may only read Secrets, Roles and RoleBindings in the namespaces it was granted access to
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Secret{}: {Namespaces: map[string]cache.Config{
+					config.Cfg.Namespace:   {},
+					bgpPasswords.Namespace: {},
+				}},
+				&rbacv1.Role{}:        {Namespaces: map[string]cache.Config{bgpPasswords.Namespace: {}}},
+				&rbacv1.RoleBinding{}: {Namespaces: map[string]cache.Config{bgpPasswords.Namespace: {}}},
+			},
+		},
+		LeaderElection:   enableLeaderElection,
+		LeaderElectionID: "operator.cninanny.sap.cc",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -119,43 +267,104 @@ func main() {
 	}
 
 	if err = (&bgpcontroller.BgpPeerDiscoveryReconciler{
-		Client:          mgr.GetClient(),
-		Scheme:          mgr.GetScheme(),
-		DefaultName:     config.Cfg.DefaultName,
-		Namespace:       config.Cfg.Namespace,
-		JobImageName:    config.Cfg.JobImageName,
-		JobImageTag:     config.Cfg.JobImageTag,
-		ServiceAccount:  config.Cfg.ServiceAccount,
-		RequeueInterval: time.Duration(requeueInterval) * time.Minute,
+		Client:             mgr.GetClient(),
+		APIReader:          mgr.GetAPIReader(),
+		Scheme:             mgr.GetScheme(),
+		DefaultName:        config.Cfg.DefaultName,
+		Namespace:          config.Cfg.Namespace,
+		JobImageName:       config.Cfg.JobImageName,
+		JobImageTag:        config.Cfg.JobImageTag,
+		ServiceAccount:     config.Cfg.ServiceAccount,
+		RequeueInterval:    time.Duration(requeueInterval) * time.Minute,
+		SourceInterface:    config.Cfg.SourceInterface,
+		SourceFromCalico:   config.Cfg.SourceFromCalico,
+		CacheDir:           config.Cfg.CacheDir,
+		VerifyCached:       config.Cfg.VerifyCached,
+		PerNode:            config.Cfg.DiscoveryPerNode,
+		FinalizeDiscovered: apiMode == calico.APIModeNone,
+		StalledTimeout:     time.Duration(stalledTimeout) * time.Minute,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "BgpPeerDiscovery")
 		os.Exit(1)
 	}
-	if err = (&calico.CalicoBgpReconciler{
-		Client:            mgr.GetClient(),
-		Scheme:            mgr.GetScheme(),
-		DefaultName:       config.Cfg.DefaultName,
-		Namespace:         config.Cfg.Namespace,
-		NodeTopologyLabel: config.Cfg.NodeTopologyLabel,
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "CalicoBgp")
-		os.Exit(1)
-	}
-
-	if config.Cfg.HostEndpointInterface != "" {
-		if err = (&calico.HostEndpointReconciler{
-			Client:        mgr.GetClient(),
-			Scheme:        mgr.GetScheme(),
-			Log:           ctrl.Log.WithName("controllers").WithName("HostEndpoint"),
-			InterfaceName: config.Cfg.HostEndpointInterface,
+	if apiMode == calico.APIModeNone {
+		setupLog.Info("calico controllers disabled, running topology and peer discovery only")
+		if err = (&calico.OrphanReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
 		}).SetupWithManager(mgr); err != nil {
-			setupLog.Error(err, "unable to create controller", "controller", "HostEndpoint")
+			setupLog.Error(err, "unable to create controller", "controller", "Orphan")
 			os.Exit(1)
 		}
+	} else {
+		if err = (&calico.CalicoBgpReconciler{
+			Client:               mgr.GetClient(),
+			APIReader:            mgr.GetAPIReader(),
+			Scheme:               mgr.GetScheme(),
+			DefaultName:          config.Cfg.DefaultName,
+			Namespace:            config.Cfg.Namespace,
+			NodeTopologyLabel:    config.Cfg.NodeTopologyLabel,
+			RolloutTimeout:       time.Duration(rolloutTimeout) * time.Minute,
+			SessionStatusNodes:   sessionStatusNodes,
+			StalePeerGracePeriod: time.Duration(stalePeerGracePeriod) * time.Minute,
+			DeletionPolicy:       bgpv1alpha1.DeletionPolicy(bgpPeerDeletionPolicy),
+			Passwords:            bgpPasswords,
+			RemoteASConfigMap:    remoteASConfigMap,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CalicoBgp")
+			os.Exit(1)
+		}
+		if err = (&calico.PeeringFilterReconciler{
+			Client:    mgr.GetClient(),
+			APIReader: mgr.GetAPIReader(),
+			Scheme:    mgr.GetScheme(),
+			Recorder:  mgr.GetEventRecorderFor("cni-nanny"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "PeeringFilter")
+			os.Exit(1)
+		}
+		if len(asRanges) > 0 {
+			if err = (&calico.LocalASReconciler{
+				Client:            mgr.GetClient(),
+				Scheme:            mgr.GetScheme(),
+				NodeTopologyLabel: config.Cfg.NodeTopologyLabel,
+				Ranges:            asRanges,
+				Scope:             calico.LocalASScope(localASScope),
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "LocalAS")
+				os.Exit(1)
+			}
+		}
+		if rackPoolParent.IsValid() {
+			if err = (&calico.RackIPPoolReconciler{
+				Client:            mgr.GetClient(),
+				Scheme:            mgr.GetScheme(),
+				NodeTopologyLabel: config.Cfg.NodeTopologyLabel,
+				ParentCIDR:        rackPoolParent.Masked(),
+				PrefixLength:      rackPoolPrefixLength,
+				RetireGracePeriod: time.Duration(rackPoolGracePeriod) * time.Minute,
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "RackIPPool")
+				os.Exit(1)
+			}
+		}
+
+		if config.Cfg.HostEndpointInterface != "" {
+			if err = (&calico.HostEndpointReconciler{
+				Client:        mgr.GetClient(),
+				Scheme:        mgr.GetScheme(),
+				Log:           ctrl.Log.WithName("controllers").WithName("HostEndpoint"),
+				InterfaceName: config.Cfg.HostEndpointInterface,
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "HostEndpoint")
+				os.Exit(1)
+			}
+		}
 	}
 
 	if err = (&topologycontroller.LabelDiscoveryReconciler{
 		Client:            mgr.GetClient(),
+		APIReader:         mgr.GetAPIReader(),
 		Scheme:            mgr.GetScheme(),
 		DefaultName:       config.Cfg.DefaultName,
 		Namespace:         config.Cfg.Namespace,
@@ -165,6 +374,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	if enableWebhooks {
+		if err = webhookbgpv1alpha1.SetupBgpPeerDiscoveryWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "BgpPeerDiscovery")
+			os.Exit(1)
+		}
+		if err = webhookbgpv1alpha1.SetupPeeringFilterWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PeeringFilter")
+			os.Exit(1)
+		}
+		if err = webhookbgpv1alpha1.SetupPeeringProfileWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PeeringProfile")
+			os.Exit(1)
+		}
+		if err = webhooktopologyv1alpha1.SetupLabelDiscoveryWebhookWithManager(mgr, config.Cfg.NodeTopologyLabel); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "LabelDiscovery")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
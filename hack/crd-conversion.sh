@@ -0,0 +1,31 @@
+#!/usr/bin/env bash
+# SPDX-FileCopyrightText: SAP SE or an SAP affiliate company
+# SPDX-License-Identifier: Apache-2.0
+
+# controller-gen has no marker for spec.conversion, so this adds the conversion webhook to the generated CRDs of
+# the multi-version APIs. The CA bundle is injected by cert-manager, see config/crd/kustomization.yaml.
+set -euo pipefail
+
+CRD_DIR="${1:-crd}"
+# the webhook service is deployed by config/default, its namespace and name prefix apply to the service
+KUSTOMIZATION="$(dirname "$0")/../config/default/kustomization.yaml"
+NAMESPACE="$(sed -n 's/^namespace: *//p' "${KUSTOMIZATION}")"
+NAME_PREFIX="$(sed -n 's/^namePrefix: *//p' "${KUSTOMIZATION}")"
+
+for crd in bgp.cninanny.sap.cc_bgppeerdiscoveries topology.cninanny.sap.cc_labeldiscoveries; do
+  file="${CRD_DIR}/${crd}.yaml"
+  if grep -q '^  conversion:' "${file}"; then
+    continue
+  fi
+  sed -i "/^  group: /i\\
+  conversion:\\
+    strategy: Webhook\\
+    webhook:\\
+      clientConfig:\\
+        service:\\
+          name: ${NAME_PREFIX}webhook-service\\
+          namespace: ${NAMESPACE}\\
+          path: /convert\\
+      conversionReviewVersions:\\
+      - v1" "${file}"
+done
@@ -0,0 +1,65 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"context"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// PatchStatus applies mutate to obj and patches its status with an optimistic lock. A merge patch replaces the
+// whole conditions list, so without the lock controllers writing conditions of the same object would overwrite each
+// other. On a conflict the latest object is read through reader, which has to bypass the cache, the cache may not have
+// seen the conflicting write yet and the retry would fail with the same resource version. mutate is applied to the
+// latest object again. It returns the patched object.
+func PatchStatus[T client.Object](ctx context.Context, c client.Client, reader client.Reader, obj T, mutate func(T)) (T, error) {
+	latest := obj
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		patch := client.MergeFromWithOptions(latest.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+		mutate(latest)
+		err := c.Status().Patch(ctx, latest, patch)
+		if !k8serrors.IsConflict(err) {
+			return err
+		}
+		fresh, newErr := newObject(c, obj)
+		if newErr != nil {
+			return newErr
+		}
+		if getErr := reader.Get(ctx, client.ObjectKeyFromObject(obj), fresh); getErr != nil {
+			return getErr
+		}
+		latest = fresh
+		return err
+	})
+	return latest, err
+}
+
+// newObject returns an empty object of the type of obj, decoding into obj itself would keep fields missing in the response
+func newObject[T client.Object](c client.Client, obj T) (T, error) {
+	var empty T
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return empty, err
+	}
+	fresh, err := c.Scheme().New(gvk)
+	if err != nil {
+		return empty, err
+	}
+	return fresh.(T), nil
+}
@@ -20,6 +20,11 @@ const (
 	KubeApp            = "cni-nanny"
 	KubeLabelComponent = "app.kubernetes.io/component"
 	KubeLabelManaged   = "app.kubernetes.io/managed-by"
+
+	// CalicoIPv4AddressAnnotation holds the node's Calico BGP address in CIDR notation
+	CalicoIPv4AddressAnnotation = "projectcalico.org/IPv4Address"
+	// CalicoASNumberAnnotation holds the node's Calico BGP AS number, overriding the global default AS number
+	CalicoASNumberAnnotation = "projectcalico.org/ASNumber"
 )
 
 var Cfg = Config{}
@@ -38,4 +43,11 @@ type Config struct {
 	BgpRemoteAs           int
 	BgpFilters            []string
 	HostEndpointInterface string
+	NodeName              string
+	SourceAddress         string
+	SourceInterface       string
+	SourceFromCalico      bool
+	CacheDir              string
+	VerifyCached          bool
+	DiscoveryPerNode      bool
 }
@@ -18,32 +18,55 @@ package bgp
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
 	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/clients"
 	"github.com/sapcc/cni-nanny/internal/config"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
+// jobDeletionDelay is the time to wait for deleted discovery jobs before starting new ones
+const jobDeletionDelay = 5 * time.Second
+
 // BgpPeerDiscoveryReconciler reconciles a BgpPeerDiscovery object
 type BgpPeerDiscoveryReconciler struct {
 	client.Client
-	Scheme          *runtime.Scheme
-	DefaultName     string
-	Namespace       string
-	JobImageName    string
-	JobImageTag     string
-	ServiceAccount  string
-	RequeueInterval time.Duration
+	// APIReader reads around the cache, status patches refetch through it on conflicts
+	APIReader        client.Reader
+	Scheme           *runtime.Scheme
+	DefaultName      string
+	Namespace        string
+	JobImageName     string
+	JobImageTag      string
+	ServiceAccount   string
+	RequeueInterval  time.Duration
+	SourceInterface  string
+	SourceFromCalico bool
+	CacheDir         string
+	VerifyCached     bool
+	StalledTimeout   time.Duration
+	// PerNode runs a discovery job on every node of a rack instead of a single one
+	PerNode bool
+	// FinalizeDiscovered finalizes topology values once peers were discovered, for clusters without the calico controller
+	FinalizeDiscovered bool
 }
 
 //+kubebuilder:rbac:groups=bgp.cninanny.sap.cc,resources=bgppeerdiscoveries,verbs=get;list;watch;create;update;patch;delete
@@ -69,9 +92,46 @@ func (r *BgpPeerDiscoveryReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return reconcile.Result{}, err
 	}
 	log.FromContext(ctx).Info("found labeldiscovery", labelDiscovery.Name, labelDiscovery.Namespace)
+	reset, err := r.rediscover(ctx, labelDiscovery)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error requesting rediscovery")
+		return ctrl.Result{}, err
+	}
+	if len(reset) > 0 {
+		// new jobs reuse the names of the deleted ones, give them time to go away
+		return ctrl.Result{RequeueAfter: jobDeletionDelay}, nil
+	}
+	if r.FinalizeDiscovered {
+		err = r.finalizeDiscovered(ctx, labelDiscovery)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error finalizing discovered topology values")
+			return ctrl.Result{}, err
+		}
+	}
 	for k, v := range labelDiscovery.Status.DiscoveredTopologyValues {
 		if !v.Finalized {
 			log.FromContext(ctx).Info("found non finalized", "topology value", k)
+			conf := config.Config{
+				Namespace:         req.Namespace,
+				JobImageName:      r.JobImageName,
+				JobImageTag:       r.JobImageTag,
+				NodeTopologyLabel: labelDiscovery.Spec.TopologyLabel,
+				NodeTopologyValue: k,
+				ServiceAccount:    r.ServiceAccount,
+				SourceInterface:   r.SourceInterface,
+				SourceFromCalico:  r.SourceFromCalico,
+				CacheDir:          r.CacheDir,
+				VerifyCached:      r.VerifyCached,
+				DiscoveryPerNode:  r.PerNode,
+			}
+			if r.PerNode {
+				err = r.createNodeDiscoveryJobs(ctx, conf)
+				if err != nil {
+					log.FromContext(ctx).Error(err, "error creating node discovery jobs")
+					return ctrl.Result{}, err
+				}
+				continue
+			}
 			// check if discovery is already running
 			found, err := r.checkJobsForTopologyValue(ctx, k)
 			if err != nil {
@@ -81,14 +141,6 @@ func (r *BgpPeerDiscoveryReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			log.FromContext(ctx).Info(k, "existing job found:", found)
 			if !found {
 				log.FromContext(ctx).Info("starting discovery job", "topology value", k)
-				conf := config.Config{
-					Namespace:         req.Namespace,
-					JobImageName:      r.JobImageName,
-					JobImageTag:       r.JobImageTag,
-					NodeTopologyLabel: labelDiscovery.Spec.TopologyLabel,
-					NodeTopologyValue: k,
-					ServiceAccount:    r.ServiceAccount,
-				}
 				err = r.createDiscoveryJob(ctx, conf)
 				if err != nil {
 					log.FromContext(ctx).Error(err, "error creating job")
@@ -97,6 +149,16 @@ func (r *BgpPeerDiscoveryReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			}
 		}
 	}
+	failed, err := r.failedDiscoveryJobs(ctx, req.Namespace)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error checking failed discovery jobs")
+		return ctrl.Result{}, err
+	}
+	err = r.updateConditions(ctx, labelDiscovery, failed)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error updating conditions")
+		return ctrl.Result{}, err
+	}
 	return ctrl.Result{
 		RequeueAfter: r.RequeueInterval,
 	}, nil
@@ -107,9 +169,20 @@ func (r *BgpPeerDiscoveryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		Named("bgp peer discovery controller").
 		For(&topologyv1alpha1.LabelDiscovery{}).
+		Watches(&bgpv1alpha1.BgpPeerDiscovery{}, handler.EnqueueRequestsFromMapFunc(r.labelDiscoveryForBgpPeerDiscovery),
+			builder.WithPredicates(r.bgpPeerDiscoveryPredicate())).
 		Complete(r)
 }
 
+// bgpPeerDiscoveryPredicate filters the BgpPeerDiscovery changes the LabelDiscovery is reconciled for,
+// finalizing discovered topology values also needs the status updates of the discovery jobs
+func (r *BgpPeerDiscoveryReconciler) bgpPeerDiscoveryPredicate() predicate.Predicate {
+	if r.FinalizeDiscovered {
+		return predicate.ResourceVersionChangedPredicate{}
+	}
+	return predicate.GenerationChangedPredicate{}
+}
+
 func (r BgpPeerDiscoveryReconciler) checkJobsForTopologyValue(ctx context.Context, value string) (bool, error) {
 	labelSelector, err := labels.ValidatedSelectorFromSet(map[string]string{topologyv1alpha1.TopologyValue: value})
 	if err != nil {
@@ -137,6 +210,10 @@ func (r BgpPeerDiscoveryReconciler) createDiscoveryJob(ctx context.Context, conf
 	lab[config.KubeLabelManaged] = config.KubeApp
 	lab[topologyv1alpha1.TopologyValue] = conf.NodeTopologyValue
 	job.Name = "bgp-peer-discovery" + "-" + conf.NodeTopologyValue
+	if conf.NodeName != "" {
+		lab[bgpv1alpha1.PeerSourceNode] = conf.NodeName
+		job.Name = nodeJobName(conf.NodeTopologyValue, conf.NodeName)
+	}
 	job.Namespace = conf.Namespace
 	job.Labels = lab
 
@@ -165,6 +242,55 @@ func (r BgpPeerDiscoveryReconciler) createDiscoveryJob(ctx context.Context, conf
 			"--node-topology-label", conf.NodeTopologyLabel,
 			"--node-topology-value", conf.NodeTopologyValue,
 		},
+		Env: []corev1.EnvVar{
+			{
+				Name: "NODE_NAME",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+				},
+			},
+		},
+	}
+	if conf.NodeName != "" {
+		// pin the job to its node like a DaemonSet pod
+		job.Spec.Template.Spec.Affinity = &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchFields: []corev1.NodeSelectorRequirement{{
+							Key:      "metadata.name",
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{conf.NodeName},
+						}},
+					}},
+				},
+			},
+		}
+	}
+	if conf.DiscoveryPerNode {
+		container.Args = append(container.Args, "--per-node")
+	}
+	if conf.SourceInterface != "" {
+		container.Args = append(container.Args, "--source-interface", conf.SourceInterface)
+	}
+	if conf.SourceFromCalico {
+		container.Args = append(container.Args, "--source-address-from-calico")
+	}
+	if conf.CacheDir != "" {
+		hostPathType := corev1.HostPathDirectoryOrCreate
+		job.Spec.Template.Spec.Volumes = []corev1.Volume{
+			{
+				Name: "cache",
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{Path: conf.CacheDir, Type: &hostPathType},
+				},
+			},
+		}
+		container.VolumeMounts = []corev1.VolumeMount{{Name: "cache", MountPath: conf.CacheDir}}
+		container.Args = append(container.Args, "--cache-dir", conf.CacheDir)
+		if conf.VerifyCached {
+			container.Args = append(container.Args, "--verify-cached")
+		}
 	}
 	job.Spec.Template.Spec.Containers = []corev1.Container{container}
 	err := r.Create(ctx, &job)
@@ -173,3 +299,118 @@ func (r BgpPeerDiscoveryReconciler) createDiscoveryJob(ctx context.Context, conf
 	}
 	return nil
 }
+
+// failedDiscoveryJobs returns the sorted topology values whose discovery job failed
+func (r BgpPeerDiscoveryReconciler) failedDiscoveryJobs(ctx context.Context, namespace string) ([]string, error) {
+	jobList := batchv1.JobList{}
+	err := r.List(ctx, &jobList, client.InNamespace(namespace), client.MatchingLabels{config.KubeLabelComponent: "DiscoveryJob"})
+	if err != nil {
+		return nil, err
+	}
+	var failed []string
+	for _, job := range jobList.Items {
+		for _, c := range job.Status.Conditions {
+			if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+				failed = append(failed, job.Labels[topologyv1alpha1.TopologyValue])
+			}
+		}
+	}
+	slices.Sort(failed)
+	return slices.Compact(failed), nil
+}
+
+// updateConditions sets the Degraded and Stalled conditions of the LabelDiscovery and the Stalled condition of each BgpPeerDiscovery
+func (r BgpPeerDiscoveryReconciler) updateConditions(ctx context.Context, labelDiscovery *topologyv1alpha1.LabelDiscovery, failed []string) error {
+	_, err := clients.PatchStatus(ctx, r.Client, r.APIReader, labelDiscovery, func(labelDiscovery *topologyv1alpha1.LabelDiscovery) {
+		r.setLabelDiscoveryConditions(labelDiscovery, failed)
+	})
+	if err != nil {
+		return err
+	}
+
+	bgpPeerDiscoveryList := bgpv1alpha1.BgpPeerDiscoveryList{}
+	err = r.List(ctx, &bgpPeerDiscoveryList, client.InNamespace(labelDiscovery.Namespace))
+	if err != nil {
+		return err
+	}
+	for i := range bgpPeerDiscoveryList.Items {
+		bgpPeerDiscovery := &bgpPeerDiscoveryList.Items[i]
+		if !r.setStalled(bgpPeerDiscovery.DeepCopy(), labelDiscovery) {
+			continue
+		}
+		_, err = clients.PatchStatus(ctx, r.Client, r.APIReader, bgpPeerDiscovery, func(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) {
+			r.setStalled(bgpPeerDiscovery, labelDiscovery)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setLabelDiscoveryConditions sets the Degraded and Stalled conditions of the LabelDiscovery
+func (r BgpPeerDiscoveryReconciler) setLabelDiscoveryConditions(labelDiscovery *topologyv1alpha1.LabelDiscovery, failed []string) {
+	generation := labelDiscovery.Generation
+	labelDiscovery.Status.ObservedGeneration = generation
+
+	degraded := metav1.Condition{
+		Type:               topologyv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             topologyv1alpha1.ReasonAsExpected,
+		Message:            "no discovery job failed",
+		ObservedGeneration: generation,
+	}
+	if len(failed) > 0 {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = topologyv1alpha1.ReasonDiscoveryJobFailed
+		degraded.Message = "discovery jobs failed for topology values " + strings.Join(failed, ", ")
+	}
+	meta.SetStatusCondition(&labelDiscovery.Status.Conditions, degraded)
+
+	stalled := metav1.Condition{
+		Type:               topologyv1alpha1.ConditionStalled,
+		Status:             metav1.ConditionFalse,
+		Reason:             topologyv1alpha1.ReasonAsExpected,
+		Message:            "discovery is progressing",
+		ObservedGeneration: generation,
+	}
+	applied := meta.FindStatusCondition(labelDiscovery.Status.Conditions, topologyv1alpha1.ConditionPeersApplied)
+	if r.StalledTimeout > 0 && applied != nil && applied.Status == metav1.ConditionFalse &&
+		time.Since(applied.LastTransitionTime.Time) > r.StalledTimeout {
+		stalled.Status = metav1.ConditionTrue
+		stalled.Reason = topologyv1alpha1.ReasonDiscoveryNotProgressing
+		stalled.Message = "topology values not finalized since " + applied.LastTransitionTime.UTC().Format(time.RFC3339)
+	}
+	meta.SetStatusCondition(&labelDiscovery.Status.Conditions, stalled)
+}
+
+// setStalled sets the Stalled condition of a BgpPeerDiscovery and reports whether it changed.
+// The rack is stalled if its topology value stays unfinalized and its PeersApplied condition was not True
+// for longer than StalledTimeout, counted from the creation of the BgpPeerDiscovery if PeersApplied is not set yet.
+// Failed discovery jobs are reported by the Degraded condition of the LabelDiscovery instead.
+func (r BgpPeerDiscoveryReconciler) setStalled(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery, labelDiscovery *topologyv1alpha1.LabelDiscovery) bool {
+	condition := metav1.Condition{
+		Type:               bgpv1alpha1.ConditionStalled,
+		Status:             metav1.ConditionFalse,
+		Reason:             bgpv1alpha1.ReasonAsExpected,
+		Message:            "discovery of the rack is progressing",
+		ObservedGeneration: bgpPeerDiscovery.Generation,
+	}
+	since := bgpPeerDiscovery.CreationTimestamp
+	applied := meta.FindStatusCondition(bgpPeerDiscovery.Status.Conditions, bgpv1alpha1.ConditionPeersApplied)
+	if applied != nil {
+		since = applied.LastTransitionTime
+	}
+	value, ok := labelDiscovery.Status.DiscoveredTopologyValues[bgpPeerDiscovery.Name]
+	if r.StalledTimeout > 0 && ok && !value.Finalized && (applied == nil || applied.Status != metav1.ConditionTrue) &&
+		time.Since(since.Time) > r.StalledTimeout {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = bgpv1alpha1.ReasonDiscoveryNotProgressing
+		condition.Message = "topology value " + bgpPeerDiscovery.Name + " not finalized since " + since.UTC().Format(time.RFC3339)
+	}
+	if !meta.SetStatusCondition(&bgpPeerDiscovery.Status.Conditions, condition) {
+		return false
+	}
+	bgpPeerDiscovery.Status.ObservedGeneration = bgpPeerDiscovery.Generation
+	return true
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+)
+
+// countingReader counts the objects read around the cache
+type countingReader struct {
+	client.Reader
+	gets int
+}
+
+func (r *countingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	r.gets++
+	return r.Reader.Get(ctx, key, obj, opts...)
+}
+
+var _ = Describe("setStalled", func() {
+
+	var (
+		reconciler       BgpPeerDiscoveryReconciler
+		labelDiscovery   *topologyv1alpha1.LabelDiscovery
+		bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery
+	)
+
+	BeforeEach(func() {
+		reconciler = BgpPeerDiscoveryReconciler{StalledTimeout: 30 * time.Minute}
+		labelDiscovery = &topologyv1alpha1.LabelDiscovery{}
+		labelDiscovery.Status.DiscoveredTopologyValues = map[string]topologyv1alpha1.DiscoveredTopologyValue{"rack1": {}}
+		bgpPeerDiscovery = &bgpv1alpha1.BgpPeerDiscovery{}
+		bgpPeerDiscovery.Name = "rack1"
+		bgpPeerDiscovery.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	})
+
+	setPeersApplied := func(status metav1.ConditionStatus, since time.Time) {
+		bgpPeerDiscovery.Status.Conditions = []metav1.Condition{{
+			Type:               bgpv1alpha1.ConditionPeersApplied,
+			Status:             status,
+			Reason:             bgpv1alpha1.ReasonPeersApplied,
+			LastTransitionTime: metav1.NewTime(since),
+		}}
+	}
+
+	stalled := func() *metav1.Condition {
+		return meta.FindStatusCondition(bgpPeerDiscovery.Status.Conditions, bgpv1alpha1.ConditionStalled)
+	}
+
+	It("reports a rack unfinalized since its creation", func() {
+		Expect(reconciler.setStalled(bgpPeerDiscovery, labelDiscovery)).To(BeTrue())
+		Expect(stalled().Status).To(Equal(metav1.ConditionTrue))
+		Expect(stalled().Reason).To(Equal(bgpv1alpha1.ReasonDiscoveryNotProgressing))
+		Expect(reconciler.setStalled(bgpPeerDiscovery, labelDiscovery)).To(BeFalse())
+	})
+
+	It("counts from the last transition of PeersApplied", func() {
+		setPeersApplied(metav1.ConditionFalse, time.Now().Add(-time.Minute))
+		reconciler.setStalled(bgpPeerDiscovery, labelDiscovery)
+		Expect(stalled().Status).To(Equal(metav1.ConditionFalse))
+
+		setPeersApplied(metav1.ConditionFalse, time.Now().Add(-time.Hour))
+		reconciler.setStalled(bgpPeerDiscovery, labelDiscovery)
+		Expect(stalled().Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	It("does not report finalized or applied racks", func() {
+		setPeersApplied(metav1.ConditionTrue, time.Now().Add(-time.Hour))
+		reconciler.setStalled(bgpPeerDiscovery, labelDiscovery)
+		Expect(stalled().Status).To(Equal(metav1.ConditionFalse))
+
+		bgpPeerDiscovery.Status.Conditions = nil
+		labelDiscovery.Status.DiscoveredTopologyValues["rack1"] = topologyv1alpha1.DiscoveredTopologyValue{Finalized: true}
+		reconciler.setStalled(bgpPeerDiscovery, labelDiscovery)
+		Expect(stalled().Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("does not report racks without a timeout or a topology value", func() {
+		reconciler.StalledTimeout = 0
+		reconciler.setStalled(bgpPeerDiscovery, labelDiscovery)
+		Expect(stalled().Status).To(Equal(metav1.ConditionFalse))
+
+		reconciler.StalledTimeout = 30 * time.Minute
+		delete(labelDiscovery.Status.DiscoveredTopologyValues, "rack1")
+		reconciler.setStalled(bgpPeerDiscovery, labelDiscovery)
+		Expect(stalled().Status).To(Equal(metav1.ConditionFalse))
+	})
+
+})
+
+var _ = Describe("updateConditions", func() {
+
+	var (
+		labelDiscovery *topologyv1alpha1.LabelDiscovery
+		reader         *countingReader
+		conflicts      int
+		reconciler     *BgpPeerDiscoveryReconciler
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(bgpv1alpha1.AddToScheme(scheme)).To(Succeed())
+		Expect(topologyv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		labelDiscovery = &topologyv1alpha1.LabelDiscovery{}
+		labelDiscovery.Name = "default"
+		labelDiscovery.Namespace = "cni-nanny"
+
+		conflicts = 1
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(labelDiscovery).
+			WithStatusSubresource(labelDiscovery).
+			WithInterceptorFuncs(interceptor.Funcs{
+				SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+					if conflicts > 0 {
+						conflicts--
+						return k8serrors.NewConflict(schema.GroupResource{Resource: "labeldiscoveries"}, obj.GetName(), nil)
+					}
+					return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+				},
+			}).
+			Build()
+		reader = &countingReader{Reader: c}
+		reconciler = &BgpPeerDiscoveryReconciler{Client: c, APIReader: reader, Scheme: scheme}
+	})
+
+	It("refetches through the API reader on conflicts", func(ctx SpecContext) {
+		latest := &topologyv1alpha1.LabelDiscovery{}
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(labelDiscovery), latest)).To(Succeed())
+		Expect(reconciler.updateConditions(ctx, latest, []string{"rack1"})).To(Succeed())
+		Expect(reader.gets).To(Equal(1))
+
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(labelDiscovery), latest)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(latest.Status.Conditions, topologyv1alpha1.ConditionDegraded)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(latest.Status.Conditions, topologyv1alpha1.ConditionStalled)).To(BeTrue())
+	})
+
+})
@@ -0,0 +1,69 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/clients"
+)
+
+// finalizeDiscovered finalizes the topology values whose BgpPeerDiscovery reported peers. Without the calico
+// controller applying the peers and finalizing the values, their discovery jobs would be started again and again.
+func (r *BgpPeerDiscoveryReconciler) finalizeDiscovered(ctx context.Context, labelDiscovery *topologyv1alpha1.LabelDiscovery) error {
+	var discovered []string
+	for value, status := range labelDiscovery.Status.DiscoveredTopologyValues {
+		if status.Finalized {
+			continue
+		}
+		bgpPeerDiscovery := &bgpv1alpha1.BgpPeerDiscovery{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: labelDiscovery.Namespace, Name: value}, bgpPeerDiscovery)
+		if err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if !meta.IsStatusConditionTrue(bgpPeerDiscovery.Status.Conditions, bgpv1alpha1.ConditionDiscovered) ||
+			len(bgpPeerDiscovery.Status.Peers) == 0 {
+			continue
+		}
+		log.FromContext(ctx).Info("finalizing discovered topology value", "topology value", value)
+		discovered = append(discovered, value)
+	}
+	if len(discovered) == 0 {
+		return nil
+	}
+	latest, err := clients.PatchStatus(ctx, r.Client, r.APIReader, labelDiscovery, func(labelDiscovery *topologyv1alpha1.LabelDiscovery) {
+		for _, value := range discovered {
+			if status, ok := labelDiscovery.Status.DiscoveredTopologyValues[value]; ok {
+				status.Finalized = true
+				labelDiscovery.Status.DiscoveredTopologyValues[value] = status
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	*labelDiscovery = *latest
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+)
+
+var _ = Describe("finalizeDiscovered", func() {
+
+	var (
+		labelDiscovery *topologyv1alpha1.LabelDiscovery
+		reconciler     *BgpPeerDiscoveryReconciler
+	)
+
+	bgpPeerDiscovery := func(name string, discovered metav1.ConditionStatus, peers ...string) *bgpv1alpha1.BgpPeerDiscovery {
+		bgpPeerDiscovery := &bgpv1alpha1.BgpPeerDiscovery{}
+		bgpPeerDiscovery.Name = name
+		bgpPeerDiscovery.Namespace = "cni-nanny"
+		meta.SetStatusCondition(&bgpPeerDiscovery.Status.Conditions, metav1.Condition{
+			Type: bgpv1alpha1.ConditionDiscovered, Status: discovered, Reason: bgpv1alpha1.ReasonPeersDiscovered,
+		})
+		for _, peer := range peers {
+			bgpPeerDiscovery.Status.Peers = append(bgpPeerDiscovery.Status.Peers, bgpv1alpha1.DiscoveredPeer{IP: peer})
+		}
+		return bgpPeerDiscovery
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(bgpv1alpha1.AddToScheme(scheme)).To(Succeed())
+		Expect(topologyv1alpha1.AddToScheme(scheme)).To(Succeed())
+		labelDiscovery = &topologyv1alpha1.LabelDiscovery{}
+		labelDiscovery.Name = "default"
+		labelDiscovery.Namespace = "cni-nanny"
+		labelDiscovery.Status.DiscoveredTopologyValues = map[string]topologyv1alpha1.DiscoveredTopologyValue{
+			"rack1": {},
+			"rack2": {},
+			"rack3": {},
+			"rack4": {},
+			"rack5": {Finalized: true},
+		}
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(labelDiscovery,
+				bgpPeerDiscovery("rack1", metav1.ConditionTrue, "10.0.0.1"),
+				bgpPeerDiscovery("rack2", metav1.ConditionFalse),
+				bgpPeerDiscovery("rack3", metav1.ConditionTrue),
+			).
+			WithStatusSubresource(labelDiscovery).
+			Build()
+		reconciler = &BgpPeerDiscoveryReconciler{Client: c, APIReader: c, Scheme: scheme, DefaultName: "default", FinalizeDiscovered: true}
+	})
+
+	finalized := func(labelDiscovery *topologyv1alpha1.LabelDiscovery) []string {
+		var values []string
+		for value, status := range labelDiscovery.Status.DiscoveredTopologyValues {
+			if status.Finalized {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+
+	It("finalizes only the topology values whose peers were discovered", func(ctx SpecContext) {
+		Expect(reconciler.finalizeDiscovered(ctx, labelDiscovery)).To(Succeed())
+		Expect(finalized(labelDiscovery)).To(ConsistOf("rack1", "rack5"))
+
+		latest := &topologyv1alpha1.LabelDiscovery{}
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(labelDiscovery), latest)).To(Succeed())
+		Expect(finalized(latest)).To(ConsistOf("rack1", "rack5"))
+	})
+
+	It("does not patch without newly discovered topology values", func(ctx SpecContext) {
+		Expect(reconciler.finalizeDiscovered(ctx, labelDiscovery)).To(Succeed())
+		resourceVersion := labelDiscovery.ResourceVersion
+		Expect(reconciler.finalizeDiscovered(ctx, labelDiscovery)).To(Succeed())
+		Expect(labelDiscovery.ResourceVersion).To(Equal(resourceVersion))
+	})
+
+})
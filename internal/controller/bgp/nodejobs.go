@@ -0,0 +1,77 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+// createNodeDiscoveryJobs starts a discovery job on every node of a rack that has none running
+func (r BgpPeerDiscoveryReconciler) createNodeDiscoveryJobs(ctx context.Context, conf config.Config) error {
+	nodes := &corev1.NodeList{}
+	err := r.List(ctx, nodes, client.MatchingLabels{conf.NodeTopologyLabel: conf.NodeTopologyValue})
+	if err != nil {
+		return err
+	}
+	jobList := &batchv1.JobList{}
+	err = r.List(ctx, jobList, client.InNamespace(conf.Namespace), client.MatchingLabels{topologyv1alpha1.TopologyValue: conf.NodeTopologyValue})
+	if err != nil {
+		return err
+	}
+	running := map[string]bool{}
+	for _, job := range jobList.Items {
+		running[job.Labels[bgpv1alpha1.PeerSourceNode]] = true
+	}
+	for _, node := range nodes.Items {
+		if running[node.Name] {
+			continue
+		}
+		log.FromContext(ctx).Info("starting node discovery job", "topology value", conf.NodeTopologyValue, "node", node.Name)
+		nodeConf := conf
+		nodeConf.NodeName = node.Name
+		err = r.createDiscoveryJob(ctx, nodeConf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeJobName returns the name of the discovery job of a node, hashing the node name if it would be too long
+func nodeJobName(topologyValue, nodeName string) string {
+	name := "bgp-peer-discovery-" + topologyValue + "-" + nodeName
+	if len(name) <= validation.DNS1123LabelMaxLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(nodeName))
+	name = "bgp-peer-discovery-" + topologyValue + "-" + hex.EncodeToString(sum[:])[:10]
+	if len(name) > validation.DNS1123LabelMaxLength {
+		name = strings.TrimRight(name[:validation.DNS1123LabelMaxLength], "-")
+	}
+	return name
+}
@@ -16,23 +16,41 @@ package bgp
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"os"
+	"slices"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
 	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/clients"
 	"github.com/sapcc/cni-nanny/internal/config"
 	"github.com/sapcc/cni-nanny/internal/discovery"
 )
 
+const (
+	// verifyAttempts is the number of direct probes a peer gets before it is reported unreachable
+	verifyAttempts = 3
+	// verifyRetryDelay is the time between direct probes of peers not answering
+	verifyRetryDelay = time.Second
+)
+
 type TracerouteDiscoveryReconciler struct {
 	client.Client
+	// APIReader reads around the cache, status patches refetch through it on conflicts
+	APIReader         client.Reader
 	Scheme            *runtime.Scheme
 	DefaultName       string
 	Namespace         string
@@ -54,24 +72,36 @@ type TracerouteDiscoveryReconciler struct {
 func (r *TracerouteDiscoveryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
 
-	peers, err := discovery.GetNeighbors(config.Cfg.TraceCount)
+	source, err := r.sourceAddress(ctx)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to determine probe source address")
+		os.Exit(1)
+	}
+	var sourceIP net.IP
+	if source.Address != "" {
+		sourceIP = net.ParseIP(source.Address)
+		log.FromContext(ctx).Info("using probe source address", "address", source.Address, "node ip", source.NodeIP)
+	}
+
+	peerList, method, err := r.discoverPeers(ctx, sourceIP, source.Address)
 	if err != nil {
 		log.FromContext(ctx).Error(err, "unable to discover peers")
 		os.Exit(1)
 	}
-	log.FromContext(ctx).Info("peers found", "peers", peers)
+	log.FromContext(ctx).Info("peers found", "peers", peerList, "method", method)
 
 	var bgpPeerDiscovery = new(bgpv1alpha1.BgpPeerDiscovery)
 	var nsName types.NamespacedName
-	var peerList []string
 
-	if len(peers) > 0 {
-		for _, v := range peers {
-			peerList = append(peerList, v.String())
+	if len(peerList) > 0 {
+		validations, err := validatePeers(peerList, method, sourceIP)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "unable to validate peers")
+			os.Exit(1)
 		}
 		nsName.Name = config.Cfg.NodeTopologyValue
 		nsName.Namespace = config.Cfg.Namespace
-		err := r.Get(ctx, nsName, bgpPeerDiscovery)
+		err = r.Get(ctx, nsName, bgpPeerDiscovery)
 		if err != nil {
 			if errors.IsNotFound(err) {
 				bgpPeerDisc := generateBgpPeerDiscovery(nsName, bgpPeerDiscovery)
@@ -81,13 +111,39 @@ func (r *TracerouteDiscoveryReconciler) Reconcile(ctx context.Context, req ctrl.
 					log.FromContext(ctx).Error(err, "error creating bgpPeerDiscovery")
 					return ctrl.Result{}, err
 				}
+				// the status patch is locked to the resource version of the created object
+				*bgpPeerDiscovery = bgpPeerDisc
 			} else {
 				log.FromContext(ctx).Error(err, "error getting bgpPeerDiscovery")
 				return ctrl.Result{}, err
 			}
 		}
-		patch := client.MergeFrom(bgpPeerDiscovery.DeepCopy())
-		err = r.updateStatus(ctx, peerList, patch, bgpPeerDiscovery)
+		if config.Cfg.DiscoveryPerNode {
+			err = r.updateNodeStatus(ctx, nsName, peerList, method, source, validations)
+		} else {
+			_, err = clients.PatchStatus(ctx, r.Client, r.APIReader, bgpPeerDiscovery, func(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) {
+				peers := buildPeers(bgpPeerDiscovery.Status.Peers, peerList, method, source, validations, metav1.Now())
+				setDiscovered(bgpPeerDiscovery, peerList, peers, "node "+config.Cfg.NodeName)
+			})
+		}
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error updating bgpPeerDiscovery status")
+		}
+	} else {
+		nsName.Name = config.Cfg.NodeTopologyValue
+		nsName.Namespace = config.Cfg.Namespace
+		err = r.Get(ctx, nsName, bgpPeerDiscovery)
+		switch {
+		case err == nil && config.Cfg.DiscoveryPerNode:
+			// the other nodes of the rack may still find peers, the condition is computed over all of them
+			err = r.updateNodeStatus(ctx, nsName, []string{}, method, source, nil)
+		case err == nil:
+			_, err = clients.PatchStatus(ctx, r.Client, r.APIReader, bgpPeerDiscovery, func(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) {
+				setNoPeersFound(bgpPeerDiscovery, "no peers found by node "+config.Cfg.NodeName)
+			})
+		case errors.IsNotFound(err):
+			err = nil
+		}
 		if err != nil {
 			log.FromContext(ctx).Error(err, "error updating bgpPeerDiscovery status")
 		}
@@ -114,11 +170,283 @@ func generateBgpPeerDiscovery(nsName types.NamespacedName, bgpPeerDiscovery *bgp
 	return *bgpPeerDiscovery
 }
 
-func (r *TracerouteDiscoveryReconciler) updateStatus(ctx context.Context, peers []string, patch client.Patch, bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) error {
-	bgpPeerDiscovery.Status.DiscoveredPeers = peers
-	err := r.Status().Patch(ctx, bgpPeerDiscovery, patch)
+// setDiscovered records the discovered peers of a rack and sets the Discovered condition, discoveredBy names the nodes
+func setDiscovered(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery, peerList []string, peers []bgpv1alpha1.DiscoveredPeer, discoveredBy string) {
+	bgpPeerDiscovery.Status.DiscoveredPeers = peerList
+	bgpPeerDiscovery.Status.Peers = peers
+	bgpPeerDiscovery.Status.ObservedGeneration = bgpPeerDiscovery.Generation
+	meta.SetStatusCondition(&bgpPeerDiscovery.Status.Conditions, metav1.Condition{
+		Type:               bgpv1alpha1.ConditionDiscovered,
+		Status:             metav1.ConditionTrue,
+		Reason:             bgpv1alpha1.ReasonPeersDiscovered,
+		Message:            fmt.Sprintf("%d peers discovered by %s", len(peers), discoveredBy),
+		ObservedGeneration: bgpPeerDiscovery.Generation,
+	})
+}
+
+// setNoPeersFound sets the Discovered condition of a rack without peers, the last discovered peers are kept
+func setNoPeersFound(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery, message string) {
+	bgpPeerDiscovery.Status.ObservedGeneration = bgpPeerDiscovery.Generation
+	meta.SetStatusCondition(&bgpPeerDiscovery.Status.Conditions, metav1.Condition{
+		Type:               bgpv1alpha1.ConditionDiscovered,
+		Status:             metav1.ConditionFalse,
+		Reason:             bgpv1alpha1.ReasonNoPeersFound,
+		Message:            message,
+		ObservedGeneration: bgpPeerDiscovery.Generation,
+	})
+}
+
+// updateNodeStatus records the peers discovered by this node next to the ones of the other nodes of the rack.
+// The Discovered condition covers all nodes, the rack has no peers only if no node found any.
+// Jobs of all nodes patch the same status, so the patch is retried on conflicts.
+func (r *TracerouteDiscoveryReconciler) updateNodeStatus(ctx context.Context, nsName types.NamespacedName, peerList []string,
+	method bgpv1alpha1.DiscoveryMethod, source bgpv1alpha1.PeerSource, validations map[string][]bgpv1alpha1.PeerValidation) error {
+
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		bgpPeerDiscovery := &bgpv1alpha1.BgpPeerDiscovery{}
+		err := r.Get(ctx, nsName, bgpPeerDiscovery)
+		if err != nil {
+			return err
+		}
+		patch := client.MergeFromWithOptions(bgpPeerDiscovery.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		now := metav1.Now()
+		if bgpPeerDiscovery.Status.NodePeers == nil {
+			bgpPeerDiscovery.Status.NodePeers = map[string]bgpv1alpha1.NodePeers{}
+		}
+		bgpPeerDiscovery.Status.NodePeers[config.Cfg.NodeName] = bgpv1alpha1.NodePeers{Peers: peerList, LastSeen: now}
+		own := buildPeers(bgpPeerDiscovery.Status.Peers, peerList, method, source, validations, now)
+		peers := mergeNodePeers(bgpPeerDiscovery.Status, own, config.Cfg.NodeName)
+		setNodeDiscovered(bgpPeerDiscovery, peers)
+		return r.Status().Patch(ctx, bgpPeerDiscovery, patch)
+	})
+}
+
+// setNodeDiscovered sets the merged peers of all nodes of a rack and the Discovered condition over all of them
+func setNodeDiscovered(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery, peers []bgpv1alpha1.DiscoveredPeer) {
+	if len(peers) == 0 {
+		setNoPeersFound(bgpPeerDiscovery, fmt.Sprintf("no peers found by any of %d nodes", len(bgpPeerDiscovery.Status.NodePeers)))
+		return
+	}
+	ips := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		ips = append(ips, peer.IP)
+	}
+	found := 0
+	for _, nodePeers := range bgpPeerDiscovery.Status.NodePeers {
+		if len(nodePeers.Peers) > 0 {
+			found++
+		}
+	}
+	setDiscovered(bgpPeerDiscovery, ips, peers, fmt.Sprintf("%d of %d nodes", found, len(bgpPeerDiscovery.Status.NodePeers)))
+}
+
+// mergeNodePeers returns the peers of a node followed by the known peers still discovered by any other node of the rack
+func mergeNodePeers(status bgpv1alpha1.BgpPeerDiscoveryStatus, own []bgpv1alpha1.DiscoveredPeer, nodeName string) []bgpv1alpha1.DiscoveredPeer {
+	others := map[string]bool{}
+	for node, nodePeers := range status.NodePeers {
+		if node == nodeName {
+			continue
+		}
+		for _, ip := range nodePeers.Peers {
+			others[ip] = true
+		}
+	}
+	peers := slices.Clone(own)
+	for _, peer := range status.Peers {
+		if !others[peer.IP] || slices.ContainsFunc(own, func(p bgpv1alpha1.DiscoveredPeer) bool { return p.IP == peer.IP }) {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// discoverPeers returns the next-hops of the node. In verify cached mode the cached peers are re-checked
+// and a full scan is only done if any of them no longer answers.
+func (r *TracerouteDiscoveryReconciler) discoverPeers(ctx context.Context, sourceIP net.IP, sourceAddress string) ([]string, bgpv1alpha1.DiscoveryMethod, error) {
+	if config.Cfg.CacheDir != "" && config.Cfg.VerifyCached {
+		cached, err := discovery.LoadResult(config.Cfg.CacheDir)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "unable to read cached discovery result, running full scan")
+		}
+		if cached != nil && cached.TopologyValue == config.Cfg.NodeTopologyValue &&
+			cached.SourceAddress == sourceAddress && len(cached.Peers) > 0 {
+			alive, err := discovery.VerifyNeighbors(cached.Peers, sourceIP)
+			if err != nil {
+				return nil, "", err
+			}
+			if len(alive) == len(cached.Peers) {
+				log.FromContext(ctx).Info("cached peers verified", "peers", cached.Peers, "cached at", cached.Timestamp)
+				// the timestamp records the last time the peers were seen, not the last full scan
+				cached.Timestamp = time.Now()
+				if err := discovery.SaveResult(config.Cfg.CacheDir, cached); err != nil {
+					log.FromContext(ctx).Error(err, "unable to refresh cached discovery result")
+				}
+				return cached.Peers, bgpv1alpha1.DiscoveryMethodCache, nil
+			}
+			log.FromContext(ctx).Info("cached peers no longer answer, running full scan", "cached", cached.Peers, "alive", alive)
+		}
+	}
+
+	peers, err := discovery.GetNeighbors(config.Cfg.TraceCount, sourceIP)
+	if err != nil {
+		return nil, "", err
+	}
+	peerList := make([]string, 0, len(peers))
+	for _, v := range peers {
+		peerList = append(peerList, v.String())
+	}
+	if config.Cfg.CacheDir != "" && len(peerList) > 0 {
+		result := &discovery.Result{
+			Timestamp:     time.Now(),
+			TopologyValue: config.Cfg.NodeTopologyValue,
+			SourceAddress: sourceAddress,
+			Peers:         peerList,
+		}
+		if err := discovery.SaveResult(config.Cfg.CacheDir, result); err != nil {
+			log.FromContext(ctx).Error(err, "unable to cache discovery result")
+		}
+	}
+	return peerList, bgpv1alpha1.DiscoveryMethodTraceroute, nil
+}
+
+// validatePeers checks that each peer answers direct probes and is on-link.
+// Peers re-verified from the cache already answered direct probes.
+func validatePeers(peerList []string, method bgpv1alpha1.DiscoveryMethod, sourceIP net.IP) (map[string][]bgpv1alpha1.PeerValidation, error) {
+	alive := peerList
+	if method != bgpv1alpha1.DiscoveryMethodCache {
+		var err error
+		alive, err = verifyPeers(peerList, sourceIP)
+		if err != nil {
+			return nil, err
+		}
+	}
+	validations := make(map[string][]bgpv1alpha1.PeerValidation, len(peerList))
+	for _, peer := range peerList {
+		reachable := bgpv1alpha1.PeerValidation{Type: bgpv1alpha1.ValidationReachable, Passed: slices.Contains(alive, peer)}
+		if !reachable.Passed {
+			reachable.Message = "no answer to direct probes"
+		}
+		connected := bgpv1alpha1.PeerValidation{Type: bgpv1alpha1.ValidationDirectlyConnected}
+		iface, err := discovery.InterfaceFor(net.ParseIP(peer))
+		switch {
+		case err != nil:
+			connected.Message = err.Error()
+		case iface == "":
+			connected.Message = "not inside a subnet of a local interface"
+		default:
+			connected.Passed = true
+			connected.Message = iface
+		}
+		validations[peer] = []bgpv1alpha1.PeerValidation{reachable, connected}
+	}
+	return validations, nil
+}
+
+// verifyPeers probes the peers directly and probes the ones not answering again, so a single lost probe does not
+// fail the validation of a peer
+func verifyPeers(peerList []string, sourceIP net.IP) ([]string, error) {
+	var alive []string
+	pending := peerList
+	for attempt := 1; attempt <= verifyAttempts && len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			time.Sleep(verifyRetryDelay)
+		}
+		answered, err := discovery.VerifyNeighbors(pending, sourceIP)
+		if err != nil {
+			return nil, err
+		}
+		alive = append(alive, answered...)
+		pending = slices.DeleteFunc(slices.Clone(pending), func(peer string) bool { return slices.Contains(answered, peer) })
+	}
+	return alive, nil
+}
+
+// buildPeers describes the discovered peers, keeping the first seen time of peers that were discovered before
+func buildPeers(existing []bgpv1alpha1.DiscoveredPeer, peerList []string, method bgpv1alpha1.DiscoveryMethod, source bgpv1alpha1.PeerSource,
+	validations map[string][]bgpv1alpha1.PeerValidation, now metav1.Time) []bgpv1alpha1.DiscoveredPeer {
+
+	firstSeen := make(map[string]metav1.Time, len(existing))
+	for _, p := range existing {
+		firstSeen[p.IP] = p.FirstSeen
+	}
+	peers := make([]bgpv1alpha1.DiscoveredPeer, 0, len(peerList))
+	for _, ip := range peerList {
+		peer := bgpv1alpha1.DiscoveredPeer{
+			IP:            ip,
+			AddressFamily: bgpv1alpha1.AddressFamilyOf(ip),
+			SourceNode:    config.Cfg.NodeName,
+			Source:        source,
+			FirstSeen:     now,
+			LastSeen:      now,
+			Method:        method,
+			Validations:   validations[ip],
+		}
+		if t, ok := firstSeen[ip]; ok && !t.IsZero() {
+			peer.FirstSeen = t
+		}
+		for _, v := range peer.Validations {
+			if v.Type == bgpv1alpha1.ValidationDirectlyConnected && v.Passed {
+				peer.Interface = v.Message
+			}
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// sourceAddress returns the probe source address, either set explicitly, resolved from an interface of this node
+// or derived from the node's Calico BGP address. An empty address leaves the choice to the kernel.
+// A set or resolved address is recorded as the node IP if it matches the node's Calico BGP address,
+// the generated BGPPeers then use the node IP as the session source like the probes did.
+func (r *TracerouteDiscoveryReconciler) sourceAddress(ctx context.Context) (bgpv1alpha1.PeerSource, error) {
+	var source bgpv1alpha1.PeerSource
+	var ip net.IP
+	switch {
+	case config.Cfg.SourceInterface != "":
+		addr, err := discovery.InterfaceAddress(config.Cfg.SourceInterface)
+		if err != nil {
+			return source, err
+		}
+		ip = addr
+	case config.Cfg.SourceAddress != "":
+		ip = net.ParseIP(config.Cfg.SourceAddress)
+		if ip == nil {
+			return source, fmt.Errorf("invalid source address %q", config.Cfg.SourceAddress)
+		}
+	case !config.Cfg.SourceFromCalico:
+		return source, nil
+	}
+	nodeIP, err := r.calicoNodeAddress(ctx, config.Cfg.NodeName)
+	if err != nil {
+		if ip == nil {
+			return source, err
+		}
+		// without a Calico address the set address is simply not the node IP
+		log.FromContext(ctx).Info("unable to read the calico node address", "error", err.Error())
+	}
+	if ip == nil {
+		ip = nodeIP
+	}
+	source.Address = ip.String()
+	source.NodeIP = ip.Equal(nodeIP)
+	return source, nil
+}
+
+// calicoNodeAddress reads the Calico BGP address of the given node from its annotations
+func (r *TracerouteDiscoveryReconciler) calicoNodeAddress(ctx context.Context, nodeName string) (net.IP, error) {
+	node := &corev1.Node{}
+	err := r.Get(ctx, types.NamespacedName{Name: nodeName}, node)
+	if err != nil {
+		return nil, err
+	}
+	addr, ok := node.Annotations[config.CalicoIPv4AddressAnnotation]
+	if !ok {
+		return nil, fmt.Errorf("node %s has no %s annotation", nodeName, config.CalicoIPv4AddressAnnotation)
+	}
+	ip, _, err := net.ParseCIDR(addr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return ip, nil
 }
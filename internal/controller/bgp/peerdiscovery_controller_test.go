@@ -0,0 +1,184 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+var _ = Describe("Per-node discovery", func() {
+
+	var (
+		reconciler *TracerouteDiscoveryReconciler
+		nsName     types.NamespacedName
+		nodeName   string
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(bgpv1alpha1.AddToScheme(scheme)).To(Succeed())
+		nsName = types.NamespacedName{Name: "rack1", Namespace: "cni-nanny"}
+		bgpPeerDiscovery := &bgpv1alpha1.BgpPeerDiscovery{}
+		bgpPeerDiscovery.Name = nsName.Name
+		bgpPeerDiscovery.Namespace = nsName.Namespace
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(bgpPeerDiscovery).
+			WithStatusSubresource(bgpPeerDiscovery).
+			Build()
+		reconciler = &TracerouteDiscoveryReconciler{Client: c, APIReader: c, Scheme: scheme}
+		nodeName = config.Cfg.NodeName
+		DeferCleanup(func() { config.Cfg.NodeName = nodeName })
+	})
+
+	discover := func(ctx SpecContext, node string, peers ...string) *bgpv1alpha1.BgpPeerDiscovery {
+		config.Cfg.NodeName = node
+		Expect(reconciler.updateNodeStatus(ctx, nsName, append([]string{}, peers...),
+			bgpv1alpha1.DiscoveryMethodTraceroute, bgpv1alpha1.PeerSource{}, nil)).To(Succeed())
+		bgpPeerDiscovery := &bgpv1alpha1.BgpPeerDiscovery{}
+		Expect(reconciler.Get(ctx, nsName, bgpPeerDiscovery)).To(Succeed())
+		return bgpPeerDiscovery
+	}
+
+	It("keeps the rack discovered if a single node finds no peers", func(ctx SpecContext) {
+		discover(ctx, "node-a", "10.0.0.1", "10.0.0.2")
+		bgpPeerDiscovery := discover(ctx, "node-b")
+
+		Expect(bgpPeerDiscovery.Status.NodePeers).To(HaveKeyWithValue("node-b", HaveField("Peers", BeEmpty())))
+		Expect(bgpPeerDiscovery.Status.DiscoveredPeers).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+		condition := meta.FindStatusCondition(bgpPeerDiscovery.Status.Conditions, bgpv1alpha1.ConditionDiscovered)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Message).To(Equal("2 peers discovered by 1 of 2 nodes"))
+	})
+
+	It("reports no peers once no node finds any", func(ctx SpecContext) {
+		discover(ctx, "node-a")
+		bgpPeerDiscovery := discover(ctx, "node-b")
+
+		condition := meta.FindStatusCondition(bgpPeerDiscovery.Status.Conditions, bgpv1alpha1.ConditionDiscovered)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(bgpv1alpha1.ReasonNoPeersFound))
+		Expect(condition.Message).To(Equal("no peers found by any of 2 nodes"))
+	})
+
+})
+
+var _ = Describe("mergeNodePeers", func() {
+
+	peer := func(ip string) bgpv1alpha1.DiscoveredPeer {
+		return bgpv1alpha1.DiscoveredPeer{IP: ip}
+	}
+	status := bgpv1alpha1.BgpPeerDiscoveryStatus{
+		Peers: []bgpv1alpha1.DiscoveredPeer{peer("10.0.0.1"), peer("10.0.0.2"), peer("10.0.0.3")},
+		NodePeers: map[string]bgpv1alpha1.NodePeers{
+			"node-a": {Peers: []string{"10.0.0.1", "10.0.0.2"}},
+			"node-b": {Peers: []string{"10.0.0.2", "10.0.0.3"}},
+		},
+	}
+
+	It("keeps the peers other nodes still report", func() {
+		Expect(mergeNodePeers(status, []bgpv1alpha1.DiscoveredPeer{peer("10.0.0.1")}, "node-b")).To(Equal(
+			[]bgpv1alpha1.DiscoveredPeer{peer("10.0.0.1"), peer("10.0.0.2")}))
+	})
+
+	It("drops the peers only the node reported before", func() {
+		Expect(mergeNodePeers(status, nil, "node-b")).To(Equal([]bgpv1alpha1.DiscoveredPeer{peer("10.0.0.1"), peer("10.0.0.2")}))
+	})
+
+	It("prefers the own record of a peer", func() {
+		own := bgpv1alpha1.DiscoveredPeer{IP: "10.0.0.2", Source: bgpv1alpha1.PeerSource{Address: "10.1.0.1"}}
+		Expect(mergeNodePeers(status, []bgpv1alpha1.DiscoveredPeer{own}, "node-a")).To(Equal(
+			[]bgpv1alpha1.DiscoveredPeer{own, peer("10.0.0.3")}))
+	})
+
+	It("takes the own peers of the first node", func() {
+		Expect(mergeNodePeers(bgpv1alpha1.BgpPeerDiscoveryStatus{}, []bgpv1alpha1.DiscoveredPeer{peer("10.0.0.1")}, "node-a")).To(Equal(
+			[]bgpv1alpha1.DiscoveredPeer{peer("10.0.0.1")}))
+	})
+
+})
+
+var _ = Describe("Probe source address", func() {
+
+	var reconciler *TracerouteDiscoveryReconciler
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		node := &corev1.Node{}
+		node.Name = "node-a"
+		node.Annotations = map[string]string{config.CalicoIPv4AddressAnnotation: "10.0.0.5/32"}
+		reconciler = &TracerouteDiscoveryReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(node).Build(), Scheme: scheme}
+		saved := config.Cfg
+		DeferCleanup(func() { config.Cfg = saved })
+		config.Cfg.NodeName = "node-a"
+		config.Cfg.SourceAddress = ""
+		config.Cfg.SourceInterface = ""
+		config.Cfg.SourceFromCalico = false
+	})
+
+	It("leaves the source to the kernel by default", func(ctx SpecContext) {
+		source, err := reconciler.sourceAddress(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal(bgpv1alpha1.PeerSource{}))
+	})
+
+	It("derives the source from the Calico address", func(ctx SpecContext) {
+		config.Cfg.SourceFromCalico = true
+		source, err := reconciler.sourceAddress(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal(bgpv1alpha1.PeerSource{Address: "10.0.0.5", NodeIP: true}))
+	})
+
+	It("recognizes a set address as the node IP without the Calico flag", func(ctx SpecContext) {
+		config.Cfg.SourceAddress = "10.0.0.5"
+		source, err := reconciler.sourceAddress(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal(bgpv1alpha1.PeerSource{Address: "10.0.0.5", NodeIP: true}))
+	})
+
+	It("keeps a set address that is not the node IP", func(ctx SpecContext) {
+		config.Cfg.SourceAddress = "10.1.0.5"
+		config.Cfg.NodeName = "unknown"
+		source, err := reconciler.sourceAddress(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal(bgpv1alpha1.PeerSource{Address: "10.1.0.5"}))
+	})
+
+	It("fails without a Calico address if it is the source", func(ctx SpecContext) {
+		config.Cfg.SourceFromCalico = true
+		config.Cfg.NodeName = "unknown"
+		_, err := reconciler.sourceAddress(ctx)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails for an unknown source interface", func(ctx SpecContext) {
+		config.Cfg.SourceInterface = "does-not-exist0"
+		_, err := reconciler.sourceAddress(ctx)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,165 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/clients"
+)
+
+// rediscover handles increased rediscover generations of the LabelDiscovery and of single BgpPeerDiscoveries.
+// Requested topology values are unfinalized and their old discovery jobs are deleted, so that new jobs get started.
+// The handled rediscover generations are recorded last, so a failed step is retried by the next reconcile.
+// It returns the reset topology values.
+func (r *BgpPeerDiscoveryReconciler) rediscover(ctx context.Context, labelDiscovery *topologyv1alpha1.LabelDiscovery) ([]string, error) {
+	all := labelDiscovery.Spec.RediscoverGeneration > labelDiscovery.Status.ObservedRediscoverGeneration
+	requested := map[string]struct{}{}
+	if all {
+		for value := range labelDiscovery.Status.DiscoveredTopologyValues {
+			requested[value] = struct{}{}
+		}
+	}
+
+	bgpPeerDiscoveries := &bgpv1alpha1.BgpPeerDiscoveryList{}
+	err := r.List(ctx, bgpPeerDiscoveries, client.InNamespace(labelDiscovery.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	var singles []*bgpv1alpha1.BgpPeerDiscovery
+	for i := range bgpPeerDiscoveries.Items {
+		bgpPeerDiscovery := &bgpPeerDiscoveries.Items[i]
+		single := bgpPeerDiscovery.Spec.RediscoverGeneration > bgpPeerDiscovery.Status.ObservedRediscoverGeneration
+		if !all && !single {
+			continue
+		}
+		// mark discovery as outdated first, so the calico controller does not finalize the old peers again
+		err = r.resetBgpPeerDiscovery(ctx, bgpPeerDiscovery)
+		if err != nil {
+			return nil, err
+		}
+		requested[bgpPeerDiscovery.Name] = struct{}{}
+		if single {
+			singles = append(singles, bgpPeerDiscovery)
+		}
+	}
+	if len(requested) == 0 && !all {
+		return nil, nil
+	}
+
+	var reset []string
+	for value := range requested {
+		err = r.deleteDiscoveryJobs(ctx, labelDiscovery.Namespace, value)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := labelDiscovery.Status.DiscoveredTopologyValues[value]; ok {
+			reset = append(reset, value)
+		}
+	}
+	slices.Sort(reset)
+
+	latest, err := clients.PatchStatus(ctx, r.Client, r.APIReader, labelDiscovery, func(labelDiscovery *topologyv1alpha1.LabelDiscovery) {
+		for _, value := range reset {
+			labelDiscovery.Status.DiscoveredTopologyValues[value] = topologyv1alpha1.DiscoveredTopologyValue{Finalized: false}
+		}
+		if all {
+			labelDiscovery.Status.ObservedRediscoverGeneration = labelDiscovery.Spec.RediscoverGeneration
+		}
+		if len(reset) > 0 {
+			meta.SetStatusCondition(&labelDiscovery.Status.Conditions, metav1.Condition{
+				Type:               topologyv1alpha1.ConditionPeersApplied,
+				Status:             metav1.ConditionFalse,
+				Reason:             topologyv1alpha1.ReasonPeersPending,
+				Message:            "rediscovery requested for " + strings.Join(reset, ", "),
+				ObservedGeneration: labelDiscovery.Generation,
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	*labelDiscovery = *latest
+
+	for _, bgpPeerDiscovery := range singles {
+		err = r.observeRediscoverGeneration(ctx, bgpPeerDiscovery)
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.FromContext(ctx).Info("rediscovery requested", "topology values", reset)
+	return reset, nil
+}
+
+// resetBgpPeerDiscovery marks the discovered peers as outdated
+func (r *BgpPeerDiscoveryReconciler) resetBgpPeerDiscovery(ctx context.Context, bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) error {
+	latest, err := clients.PatchStatus(ctx, r.Client, r.APIReader, bgpPeerDiscovery, func(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) {
+		meta.SetStatusCondition(&bgpPeerDiscovery.Status.Conditions, metav1.Condition{
+			Type:               bgpv1alpha1.ConditionDiscovered,
+			Status:             metav1.ConditionFalse,
+			Reason:             bgpv1alpha1.ReasonRediscoveryRequested,
+			Message:            "waiting for a new discovery job",
+			ObservedGeneration: bgpPeerDiscovery.Generation,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	*bgpPeerDiscovery = *latest
+	return nil
+}
+
+// observeRediscoverGeneration records the handled rediscover generation once its rack has been reset
+func (r *BgpPeerDiscoveryReconciler) observeRediscoverGeneration(ctx context.Context, bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) error {
+	_, err := clients.PatchStatus(ctx, r.Client, r.APIReader, bgpPeerDiscovery, func(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) {
+		if bgpPeerDiscovery.Spec.RediscoverGeneration > bgpPeerDiscovery.Status.ObservedRediscoverGeneration {
+			bgpPeerDiscovery.Status.ObservedRediscoverGeneration = bgpPeerDiscovery.Spec.RediscoverGeneration
+		}
+	})
+	return err
+}
+
+// deleteDiscoveryJobs deletes the discovery jobs of a topology value, including finished ones kept for their TTL
+func (r *BgpPeerDiscoveryReconciler) deleteDiscoveryJobs(ctx context.Context, namespace, value string) error {
+	jobList := batchv1.JobList{}
+	err := r.List(ctx, &jobList, client.InNamespace(namespace), client.MatchingLabels{topologyv1alpha1.TopologyValue: value})
+	if err != nil {
+		return err
+	}
+	for i := range jobList.Items {
+		err = r.Delete(ctx, &jobList.Items[i], client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelDiscoveryForBgpPeerDiscovery maps a BgpPeerDiscovery to the LabelDiscovery its discovery jobs are managed by
+func (r *BgpPeerDiscoveryReconciler) labelDiscoveryForBgpPeerDiscovery(_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: r.DefaultName, Namespace: obj.GetNamespace()}}}
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bgp
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+)
+
+var _ = Describe("rediscover", func() {
+
+	var (
+		labelDiscovery   *topologyv1alpha1.LabelDiscovery
+		bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery
+		job              *batchv1.Job
+		failDelete       bool
+		reconciler       *BgpPeerDiscoveryReconciler
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(bgpv1alpha1.AddToScheme(scheme)).To(Succeed())
+		Expect(topologyv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		labelDiscovery = &topologyv1alpha1.LabelDiscovery{}
+		labelDiscovery.Name = "default"
+		labelDiscovery.Namespace = "cni-nanny"
+		labelDiscovery.Status.DiscoveredTopologyValues = map[string]topologyv1alpha1.DiscoveredTopologyValue{
+			"rack1": {Finalized: true},
+			"rack2": {Finalized: true},
+		}
+		bgpPeerDiscovery = &bgpv1alpha1.BgpPeerDiscovery{}
+		bgpPeerDiscovery.Name = "rack1"
+		bgpPeerDiscovery.Namespace = "cni-nanny"
+		bgpPeerDiscovery.Spec.RediscoverGeneration = 1
+		job = &batchv1.Job{}
+		job.Name = "discovery-rack1"
+		job.Namespace = "cni-nanny"
+		job.Labels = map[string]string{topologyv1alpha1.TopologyValue: "rack1"}
+
+		failDelete = true
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(labelDiscovery, bgpPeerDiscovery, job).
+			WithStatusSubresource(labelDiscovery, bgpPeerDiscovery).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+					if failDelete {
+						return errors.New("delete failed")
+					}
+					return c.Delete(ctx, obj, opts...)
+				},
+			}).
+			Build()
+		reconciler = &BgpPeerDiscoveryReconciler{Client: c, APIReader: c, Scheme: scheme, DefaultName: "default"}
+	})
+
+	latestLabelDiscovery := func(ctx context.Context) *topologyv1alpha1.LabelDiscovery {
+		latest := &topologyv1alpha1.LabelDiscovery{}
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(labelDiscovery), latest)).To(Succeed())
+		return latest
+	}
+
+	latestBgpPeerDiscovery := func(ctx context.Context) *bgpv1alpha1.BgpPeerDiscovery {
+		latest := &bgpv1alpha1.BgpPeerDiscovery{}
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(bgpPeerDiscovery), latest)).To(Succeed())
+		return latest
+	}
+
+	It("keeps the rediscover generation unobserved until the jobs are deleted", func(ctx SpecContext) {
+		_, err := reconciler.rediscover(ctx, latestLabelDiscovery(ctx))
+		Expect(err).To(MatchError("delete failed"))
+
+		latest := latestBgpPeerDiscovery(ctx)
+		Expect(latest.Status.ObservedRediscoverGeneration).To(BeZero())
+		Expect(meta.IsStatusConditionFalse(latest.Status.Conditions, bgpv1alpha1.ConditionDiscovered)).To(BeTrue())
+		Expect(latestLabelDiscovery(ctx).Status.DiscoveredTopologyValues["rack1"].Finalized).To(BeTrue())
+	})
+
+	It("resets the rack when retried", func(ctx SpecContext) {
+		_, err := reconciler.rediscover(ctx, latestLabelDiscovery(ctx))
+		Expect(err).To(HaveOccurred())
+
+		failDelete = false
+		reset, err := reconciler.rediscover(ctx, latestLabelDiscovery(ctx))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reset).To(Equal([]string{"rack1"}))
+
+		Expect(latestBgpPeerDiscovery(ctx).Status.ObservedRediscoverGeneration).To(Equal(int64(1)))
+		values := latestLabelDiscovery(ctx).Status.DiscoveredTopologyValues
+		Expect(values["rack1"].Finalized).To(BeFalse())
+		Expect(values["rack2"].Finalized).To(BeTrue())
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(job), &batchv1.Job{})).ToNot(Succeed())
+
+		reset, err = reconciler.rediscover(ctx, latestLabelDiscovery(ctx))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reset).To(BeEmpty())
+	})
+
+})
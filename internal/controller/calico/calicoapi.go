@@ -0,0 +1,125 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"fmt"
+	"slices"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// APIMode selects the API group the Calico resources are read and written in
+type APIMode string
+
+const (
+	// APIModeAuto detects the API group from the APIs served by the cluster
+	APIModeAuto APIMode = "Auto"
+	// APIModeAPIServer uses projectcalico.org/v3 served by the Calico API server
+	APIModeAPIServer APIMode = "APIServer"
+	// APIModeCRD uses the crd.projectcalico.org/v1 CRDs of the Calico Kubernetes datastore
+	APIModeCRD APIMode = "CRD"
+	// APIModeNone disables the Calico controllers, only topology and peer discovery run
+	APIModeNone APIMode = "None"
+)
+
+// CRDGroupVersion is the group version of the Calico CRDs backing the Kubernetes datastore
+var CRDGroupVersion = schema.GroupVersion{Group: "crd.projectcalico.org", Version: "v1"}
+
+//+kubebuilder:rbac:groups=crd.projectcalico.org,resources=bgpconfigurations;bgpfilters;bgppeers;caliconodestatuses;ippools,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=crd.projectcalico.org,resources=hostendpoints,verbs=get;list;watch;create;update;patch
+
+// Valid reports whether the API mode is supported
+func (m APIMode) Valid() bool {
+	switch m {
+	case APIModeAuto, APIModeAPIServer, APIModeCRD, APIModeNone:
+		return true
+	}
+	return false
+}
+
+// DetectAPIMode resolves APIModeAuto by discovery, the Calico API server is preferred over the CRDs and
+// APIModeNone is returned if neither serves BGPPeers. Other modes are returned as they are.
+func DetectAPIMode(cfg *rest.Config, mode APIMode) (APIMode, error) {
+	if mode != APIModeAuto {
+		return mode, nil
+	}
+	client, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	return detectAPIMode(client)
+}
+
+// detectAPIMode returns the mode of the first group version serving BGPPeers
+func detectAPIMode(client discovery.DiscoveryInterface) (APIMode, error) {
+	for _, candidate := range []struct {
+		mode         APIMode
+		groupVersion schema.GroupVersion
+	}{{APIModeAPIServer, v3.SchemeGroupVersion}, {APIModeCRD, CRDGroupVersion}} {
+		served, err := servesBGPPeers(client, candidate.groupVersion)
+		if err != nil {
+			return "", err
+		}
+		if served {
+			return candidate.mode, nil
+		}
+	}
+	return APIModeNone, nil
+}
+
+// servesBGPPeers reports whether the cluster serves BGPPeers in a group version. An aggregated API that is registered
+// but unavailable, like a Calico API server that is down, is treated as not served.
+func servesBGPPeers(client discovery.DiscoveryInterface, groupVersion schema.GroupVersion) (bool, error) {
+	resources, err := client.ServerResourcesForGroupVersion(groupVersion.String())
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if k8serrors.IsServiceUnavailable(err) {
+		log.Log.Info("calico API unavailable, treating it as not served", "group version", groupVersion.String(), "error", err.Error())
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error discovering %s: %w", groupVersion, err)
+	}
+	return slices.ContainsFunc(resources.APIResources, func(resource metav1.APIResource) bool {
+		return resource.Name == "bgppeers"
+	}), nil
+}
+
+// AddToScheme registers the Calico v3 types in the group version of an API mode. The CRDs share the kinds and
+// fields of projectcalico.org/v3, so the same types are used for both. In CRD mode objects bypass the defaulting and
+// validation of the Calico API server, so everything written to the CRDs has to be fully specified: rack IPPools get
+// an explicit block size, BGPPeers, BGPFilters and BGPConfigurations only set fields that need no default.
+func AddToScheme(scheme *runtime.Scheme, mode APIMode) error {
+	switch mode {
+	case APIModeAPIServer:
+		return v3.AddToScheme(scheme)
+	case APIModeCRD:
+		scheme.AddKnownTypes(CRDGroupVersion, v3.AllKnownTypes...)
+		metav1.AddToGroupVersion(scheme, CRDGroupVersion)
+		return nil
+	case APIModeNone:
+		return nil
+	}
+	return fmt.Errorf("unsupported calico API mode %q", mode)
+}
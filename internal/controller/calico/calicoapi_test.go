@@ -0,0 +1,121 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Calico API", func() {
+
+	Describe("detectAPIMode", func() {
+
+		bgpPeers := func(groupVersion schema.GroupVersion) *metav1.APIResourceList {
+			return &metav1.APIResourceList{
+				GroupVersion: groupVersion.String(),
+				APIResources: []metav1.APIResource{{Name: "bgppeers", Kind: "BGPPeer"}},
+			}
+		}
+
+		newDiscovery := func(resources ...*metav1.APIResourceList) *fakediscovery.FakeDiscovery {
+			return &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: resources}}
+		}
+
+		// failFirst fails the first discovery request, which asks for projectcalico.org/v3
+		failFirst := func(discovery *fakediscovery.FakeDiscovery, err error) {
+			failed := false
+			discovery.PrependReactor("get", "resource", func(k8stesting.Action) (bool, runtime.Object, error) {
+				if failed {
+					return false, nil, nil
+				}
+				failed = true
+				return true, nil, err
+			})
+		}
+
+		It("prefers the Calico API server", func() {
+			Expect(detectAPIMode(newDiscovery(bgpPeers(CRDGroupVersion), bgpPeers(v3.SchemeGroupVersion)))).To(Equal(APIModeAPIServer))
+		})
+
+		It("falls back to the CRDs", func() {
+			Expect(detectAPIMode(newDiscovery(bgpPeers(CRDGroupVersion)))).To(Equal(APIModeCRD))
+		})
+
+		It("needs BGPPeers to be served", func() {
+			resources := &metav1.APIResourceList{
+				GroupVersion: v3.SchemeGroupVersion.String(),
+				APIResources: []metav1.APIResource{{Name: "ippools", Kind: "IPPool"}},
+			}
+			Expect(detectAPIMode(newDiscovery(resources))).To(Equal(APIModeNone))
+		})
+
+		It("treats an unavailable Calico API server as not served", func() {
+			discovery := newDiscovery(bgpPeers(CRDGroupVersion))
+			failFirst(discovery, k8serrors.NewServiceUnavailable("the server is currently unable to handle the request"))
+			Expect(detectAPIMode(discovery)).To(Equal(APIModeCRD))
+		})
+
+		It("fails on other errors", func() {
+			discovery := newDiscovery(bgpPeers(CRDGroupVersion))
+			failFirst(discovery, errors.New("connection refused"))
+			_, err := detectAPIMode(discovery)
+			Expect(err).To(MatchError(ContainSubstring("connection refused")))
+		})
+
+	})
+
+	Describe("AddToScheme", func() {
+
+		It("registers the v3 types in the CRD group in mode CRD", func() {
+			scheme := runtime.NewScheme()
+			Expect(AddToScheme(scheme, APIModeCRD)).To(Succeed())
+			gvks, _, err := scheme.ObjectKinds(&v3.BGPPeer{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gvks).To(ConsistOf(CRDGroupVersion.WithKind("BGPPeer")))
+			Expect(scheme.IsGroupRegistered(v3.SchemeGroupVersion.Group)).To(BeFalse())
+			Expect(scheme.Recognizes(CRDGroupVersion.WithKind("IPPoolList"))).To(BeTrue())
+		})
+
+		It("registers the v3 types in their own group in mode APIServer", func() {
+			scheme := runtime.NewScheme()
+			Expect(AddToScheme(scheme, APIModeAPIServer)).To(Succeed())
+			gvks, _, err := scheme.ObjectKinds(&v3.BGPPeer{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gvks).To(ConsistOf(v3.SchemeGroupVersion.WithKind("BGPPeer")))
+		})
+
+		It("registers nothing in mode None", func() {
+			scheme := runtime.NewScheme()
+			Expect(AddToScheme(scheme, APIModeNone)).To(Succeed())
+			Expect(scheme.AllKnownTypes()).To(BeEmpty())
+		})
+
+		It("rejects mode Auto", func() {
+			Expect(AddToScheme(runtime.NewScheme(), APIModeAuto)).To(MatchError(ContainSubstring("unsupported")))
+		})
+
+	})
+
+})
@@ -18,33 +18,57 @@ package calico
 
 import (
 	"context"
-	"fmt"
-
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
 	"github.com/projectcalico/api/pkg/lib/numorstring"
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
 	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/clients"
 	"github.com/sapcc/cni-nanny/internal/config"
 )
 
 // CalicoBgpReconciler reconciles a BgpPeerDiscovery object
 type CalicoBgpReconciler struct {
 	client.Client
+	// APIReader reads around the cache, status patches refetch through it on conflicts
+	APIReader         client.Reader
 	Scheme            *runtime.Scheme
 	DefaultName       string
 	Namespace         string
 	NodeTopologyLabel string
 	BgpRemoteAs       int
+	// RolloutTimeout is the time after which a replaced BGPPeer without established sessions is reported as degraded
+	RolloutTimeout time.Duration
+	// SessionStatusNodes is the number of nodes per rack BGP session state is reported for, 0 for all and negative to disable
+	SessionStatusNodes int
+	// StalePeerGracePeriod is the time BGPPeers of peers no longer effective are kept before they are deleted
+	StalePeerGracePeriod time.Duration
+	// DeletionPolicy decides whether the BGPPeers of a deleted BgpPeerDiscovery are deleted or orphaned
+	DeletionPolicy bgpv1alpha1.DeletionPolicy
+	// Passwords configures the BGP passwords of the BGPPeers
+	Passwords PasswordConfig
+	// RemoteASConfigMap is the ConfigMap in the operator namespace holding the remote AS mapping rules, none if empty
+	RemoteASConfigMap string
 }
 
 //+kubebuilder:rbac:groups=bgp.cninanny.sap.cc,resources=bgppeerdiscoveries,verbs=get;list;watch;create;update;patch;delete
@@ -53,7 +77,16 @@ type CalicoBgpReconciler struct {
 //+kubebuilder:rbac:groups=topology.cninanny.sap.cc,resources=labeldiscoveries,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=topology.cninanny.sap.cc,resources=labeldiscoveries/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=topology.cninanny.sap.cc,resources=labeldiscoveries/finalizers,verbs=update
-//+kubebuilder:rbac:groups=projectcalico.org,resources=bgppeers,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=bgp.cninanny.sap.cc,resources=peeringprofiles,verbs=get;list;watch
+//+kubebuilder:rbac:groups=projectcalico.org,resources=bgppeers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=projectcalico.org,resources=caliconodestatuses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=projectcalico.org,resources=bgpconfigurations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=nodes;configmaps,verbs=get;list;watch
+// The namespaces below are the defaults of --namespace and --calico-namespace. The namespace of config/default
+// replaces cni-nanny, config/calico-rbac sets the calico-node namespace, main verifies both at startup.
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch,namespace=cni-nanny
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete,namespace=kube-system
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete,namespace=kube-system
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -72,76 +105,391 @@ func (r *CalicoBgpReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 	err := r.Get(ctx, req.NamespacedName, bgpPeerDiscovery)
 	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			// the rack may be gone without being finalized, e.g. after its finalizer was removed
+			deleteSessionMetrics(req.Name)
+			return ctrl.Result{}, nil
+		}
 		log.FromContext(ctx).Error(err, "error getting bgpPeerDiscovery")
 		return ctrl.Result{}, err
 	}
-	if len(bgpPeerDiscovery.Status.DiscoveredPeers) > 0 {
-		for _, v := range bgpPeerDiscovery.Status.DiscoveredPeers {
-			var calicoBgpPeer v3.BGPPeer
-			nsName.Name = "bgp-peer-" + req.Name + "-" + v
-			nsName.Namespace = config.Cfg.Namespace
-			asNumber, err := intToUint32(config.Cfg.BgpRemoteAs)
-			if err != nil {
-				log.FromContext(ctx).Error(err, "error converting BgpRemoteAs to uint32")
-				return ctrl.Result{}, err
+	if !bgpPeerDiscovery.DeletionTimestamp.IsZero() {
+		err = r.finalize(ctx, bgpPeerDiscovery)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error finalizing bgpPeerDiscovery")
+		}
+		return ctrl.Result{}, err
+	}
+	if controllerutil.AddFinalizer(bgpPeerDiscovery, bgpPeerFinalizer) {
+		err = r.Update(ctx, bgpPeerDiscovery)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error adding finalizer to bgpPeerDiscovery")
+			return ctrl.Result{}, err
+		}
+	}
+	peers, origins, excluded := mergePeers(bgpPeerDiscovery)
+	if len(peers) > 0 {
+		profile, err := r.peeringProfile(ctx, req.Name)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error selecting peering profile")
+			return ctrl.Result{}, err
+		}
+		rack, err := r.rackNodes(ctx, bgpPeerDiscovery)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error listing rack nodes")
+			return ctrl.Result{}, err
+		}
+		result := peerResult{profile: profile, excluded: excluded, exceptions: rack.exceptions}
+		rules, err := r.remoteASRules(ctx)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error reading remote AS mapping")
+			if condErr := r.setPeerConditions(ctx, bgpPeerDiscovery, result, err); condErr != nil {
+				log.FromContext(ctx).Error(condErr, "error updating bgpPeerDiscovery conditions")
+			}
+			return ctrl.Result{}, err
+		}
+		rollout := &peerRollout{}
+		for _, ip := range excluded {
+			log.FromContext(ctx).Info("skipping excluded peer", "peer", ip)
+		}
+		for _, exception := range rack.exceptions {
+			log.FromContext(ctx).Info("node peers differ from rack", "node", exception.Node, "peers", exception.Peers)
+		}
+		var kept []string
+		var checks []peerCheck
+		for _, scoped := range rack.scopes(peers, origins) {
+			for _, peer := range scoped.peers {
+				name := scoped.scope.name(req.Name, peer.IP)
+				origin := origins[peer.IP]
+				if origin == bgpv1alpha1.PeerOriginDiscovered && peer.Failed(bgpv1alpha1.ValidationReachable) {
+					log.FromContext(ctx).Info("skipping unreachable peer", "peer", peer.IP, "source node", peer.SourceNode)
+					if !slices.Contains(result.skipped, peer.IP) {
+						result.skipped = append(result.skipped, peer.IP)
+					}
+					kept = append(kept, name)
+					continue
+				}
+				peerAS, err := resolveRemoteAS(rules, req.Name, peer.IP, profile)
+				if err == nil {
+					err = r.applyPeer(ctx, req.Name, scoped.scope, peer, profile, peerAS, rollout)
+				}
+				if err != nil {
+					if condErr := r.setPeerConditions(ctx, bgpPeerDiscovery, result, err); condErr != nil {
+						log.FromContext(ctx).Error(condErr, "error updating bgpPeerDiscovery conditions")
+					}
+					return ctrl.Result{}, err
+				}
+				kept = append(kept, name)
+				checks = append(checks, peerCheck{ip: peer.IP, nodes: scoped.nodes})
+				if !slices.ContainsFunc(result.effective, func(effective bgpv1alpha1.EffectivePeer) bool { return effective.IP == peer.IP }) {
+					result.effective = append(result.effective, bgpv1alpha1.EffectivePeer{IP: peer.IP, Origin: origin,
+						RemoteAS: int64(peerAS.asNumber), RemoteASSource: peerAS.source})
+				}
 			}
-			spec := v3.BGPPeerSpec{
-				PeerIP:       v,
-				ASNumber:     numorstring.ASNumber(asNumber),
-				NodeSelector: config.Cfg.NodeTopologyLabel + " == " + fmt.Sprintf("%q", req.Name),
+		}
+		err = r.syncNodeConfigurations(ctx, req.Name, profile)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error syncing calico node configurations")
+			if condErr := r.setPeerConditions(ctx, bgpPeerDiscovery, result, err); condErr != nil {
+				log.FromContext(ctx).Error(condErr, "error updating bgpPeerDiscovery conditions")
 			}
-			if len(config.Cfg.BgpFilters) > 0 {
-				spec.Filters = config.Cfg.BgpFilters
+			return ctrl.Result{}, err
+		}
+		result.rollout, err = r.rollPeers(ctx, req.Name, rollout, rack.names)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error replacing calico peers")
+			if condErr := r.setPeerConditions(ctx, bgpPeerDiscovery, result, err); condErr != nil {
+				log.FromContext(ctx).Error(condErr, "error updating bgpPeerDiscovery conditions")
 			}
-			err = r.Get(ctx, nsName, &calicoBgpPeer)
+			return ctrl.Result{}, err
+		}
+		if result.rollout == nil {
+			result.stale, err = r.retireStalePeers(ctx, req.Name, kept, checks)
 			if err != nil {
-				if k8serrors.IsNotFound(err) {
-					calicoPeer := generateCalicoBgpPeer(nsName, spec, &calicoBgpPeer)
-					log.FromContext(ctx).Info("creating calico peer", calicoPeer.Name, calicoPeer.Spec.PeerIP)
-					err = r.Create(ctx, calicoPeer)
-					if err != nil && !k8serrors.IsAlreadyExists(err) {
-						log.FromContext(ctx).Error(err, "error creating calicoBgpPeer")
-						return ctrl.Result{}, err
-					}
-				} else {
-					log.FromContext(ctx).Error(err, "error getting calicoBgpPeer")
+				log.FromContext(ctx).Error(err, "error retiring stale calico peers")
+				return ctrl.Result{}, err
+			}
+			if r.Passwords.enabled() {
+				err = r.retirePasswords(ctx)
+				if err != nil {
+					log.FromContext(ctx).Error(err, "error retiring BGP password copies")
 					return ctrl.Result{}, err
 				}
 			}
 		}
+		statuses, err := r.syncNodeStatuses(ctx, req.Name, result.rollout != nil || result.stale != nil)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error syncing calico node statuses")
+			return ctrl.Result{}, err
+		}
+		result.sessions = aggregateSessions(result.effective, statuses)
+		updateSessionMetrics(req.Name, result.sessions)
+		err = r.setPeerConditions(ctx, bgpPeerDiscovery, result, nil)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error updating bgpPeerDiscovery conditions")
+			return ctrl.Result{}, err
+		}
+		var res ctrl.Result
+		switch {
+		case result.rollout != nil:
+			res.RequeueAfter = rolloutPollInterval
+		case result.stale != nil:
+			res.RequeueAfter = result.stale.requeueAfter
+		case r.SessionStatusNodes >= 0:
+			res.RequeueAfter = sessionPollInterval
+		}
+
+		if meta.IsStatusConditionFalse(bgpPeerDiscovery.Status.Conditions, bgpv1alpha1.ConditionDiscovered) {
+			// a rediscovery is pending, the topology value is finalized once the new discovery reported peers
+			log.FromContext(ctx).Info("waiting for discovery before finalizing", "topology value", req.Name)
+			return res, nil
+		}
+		if len(result.skipped) > 0 {
+			// discovery jobs keep running for the topology value until the skipped peers pass validation and are applied
+			log.FromContext(ctx).Info("waiting for unreachable peers before finalizing", "topology value", req.Name, "peers", result.skipped)
+			return res, nil
+		}
 
 		labelDiscovery := &topologyv1alpha1.LabelDiscovery{}
 		nsName.Name = config.Cfg.DefaultName
 		nsName.Namespace = config.Cfg.Namespace
-		err := r.Get(ctx, nsName, labelDiscovery)
+		err = r.Get(ctx, nsName, labelDiscovery)
 		if err != nil {
 			log.FromContext(ctx).Error(err, "could not get client from manager")
 			return reconcile.Result{}, err
 		}
-		patch := client.MergeFrom(labelDiscovery.DeepCopy())
-		ls := labelDiscovery.Status.DiscoveredTopologyValues
-		for k, v := range labelDiscovery.Status.DiscoveredTopologyValues {
-			ls[k] = v
-			if k == req.Name && !v.Finalized {
+		_, err = clients.PatchStatus(ctx, r.Client, r.APIReader, labelDiscovery, func(labelDiscovery *topologyv1alpha1.LabelDiscovery) {
+			if v, ok := labelDiscovery.Status.DiscoveredTopologyValues[req.Name]; ok && !v.Finalized {
 				v.Finalized = true
-				ls[k] = v
+				labelDiscovery.Status.DiscoveredTopologyValues[req.Name] = v
 			}
-		}
-		labelDiscovery.Status.DiscoveredTopologyValues = ls
-		err = r.Status().Patch(ctx, labelDiscovery, patch)
+			setLabelDiscoveryPeersApplied(labelDiscovery)
+		})
 		if err != nil {
 			log.FromContext(ctx).Error(err, "could not patch labelDiscovery")
 		}
+		return res, nil
 	}
+	deleteSessionMetrics(req.Name)
 	return ctrl.Result{}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CalicoBgpReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	controller := ctrl.NewControllerManagedBy(mgr).
 		Named("calico bgp controller").
 		For(&bgpv1alpha1.BgpPeerDiscovery{}).
-		Complete(r)
+		Watches(&bgpv1alpha1.PeeringProfile{}, handler.EnqueueRequestsFromMapFunc(r.allBgpPeerDiscoveries)).
+		Watches(&v3.BGPPeer{}, handler.EnqueueRequestsFromMapFunc(bgpPeerDiscoveryForPeer),
+			builder.WithPredicates(predicate.NewPredicateFuncs(isManaged))).
+		Watches(&v3.BGPFilter{}, handler.EnqueueRequestsFromMapFunc(r.allBgpPeerDiscoveries)).
+		Watches(&v3.BGPConfiguration{}, handler.EnqueueRequestsFromMapFunc(bgpPeerDiscoveryForPeer),
+			builder.WithPredicates(predicate.NewPredicateFuncs(isManaged))).
+		Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(bgpPeerDiscoveryForNode),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}))
+	if r.Passwords.enabled() {
+		controller = controller.Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.allBgpPeerDiscoveries),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.Passwords.isSource)))
+	}
+	if r.RemoteASConfigMap != "" {
+		controller = controller.Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.allBgpPeerDiscoveries),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.isRemoteASConfigMap)))
+	}
+	return controller.Complete(r)
+}
+
+// applyPeer creates the Calico BGPPeer for a discovered peer of a topology value in scope, rendered from profile if set.
+// Existing BGPPeers are recorded in rollout, outdated ones are replaced by rollPeers.
+func (r *CalicoBgpReconciler) applyPeer(ctx context.Context, topologyValue string, scope peerScope, peer bgpv1alpha1.DiscoveredPeer, profile *bgpv1alpha1.PeeringProfile, remoteAS remoteAS, rollout *peerRollout) error {
+	var calicoBgpPeer v3.BGPPeer
+	var nsName types.NamespacedName
+	nsName.Name = scope.name(topologyValue, peer.IP)
+	nsName.Namespace = config.Cfg.Namespace
+	spec := v3.BGPPeerSpec{
+		PeerIP:   peer.IP,
+		ASNumber: numorstring.ASNumber(remoteAS.asNumber),
+	}
+	spec.Node, spec.NodeSelector = scope.selector(topologyValue)
+	if len(config.Cfg.BgpFilters) > 0 {
+		spec.Filters = config.Cfg.BgpFilters
+	}
+	if peer.Source.Address != "" {
+		spec.SourceAddress = peerSourceAddress(peer.Source)
+	}
+	var err error
+	// a password of the profile template takes precedence, the password Secret is not read then
+	if profile == nil || !hasPassword(profile.Spec.Template) {
+		spec.Password, err = r.peerPassword(ctx, topologyValue, peer.IP)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error getting BGP password", "peer", peer.IP)
+			return err
+		}
+	}
+	if profile != nil {
+		err = applyTemplate(&spec, profile.Spec.Template)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error rendering peering profile", "profile", profile.Name)
+			return err
+		}
+	}
+	err = r.checkFilters(ctx, spec.Filters)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error checking BGP filters", "peer", peer.IP)
+		return err
+	}
+	err = r.Get(ctx, nsName, &calicoBgpPeer)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			calicoPeer := generateCalicoBgpPeer(nsName, topologyValue, spec, peer, &calicoBgpPeer)
+			if profile != nil {
+				calicoPeer.Annotations[bgpv1alpha1.PeeringProfileAnnotation] = profile.Name
+			}
+			log.FromContext(ctx).Info("creating calico peer", calicoPeer.Name, calicoPeer.Spec.PeerIP)
+			err = r.Create(ctx, calicoPeer)
+			if err != nil && !k8serrors.IsAlreadyExists(err) {
+				log.FromContext(ctx).Error(err, "error creating calicoBgpPeer")
+				return err
+			}
+			return nil
+		}
+		log.FromContext(ctx).Error(err, "error getting calicoBgpPeer")
+		return err
+	}
+	err = r.ensurePeerMetadata(ctx, &calicoBgpPeer, topologyValue, profile)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error patching calicoBgpPeer metadata")
+		return err
+	}
+	if !rollout.add(&calicoBgpPeer, spec) {
+		log.FromContext(ctx).Info("calico peer outdated", "peer", calicoBgpPeer.Name)
+	}
+	return nil
+}
+
+// ensurePeerMetadata patches the ownership labels and the peering profile annotation of an existing BGPPeer
+func (r *CalicoBgpReconciler) ensurePeerMetadata(ctx context.Context, calicoBgpPeer *v3.BGPPeer, topologyValue string, profile *bgpv1alpha1.PeeringProfile) error {
+	profileName := ""
+	if profile != nil {
+		profileName = profile.Name
+	}
+	if calicoBgpPeer.Labels[topologyv1alpha1.TopologyValue] == topologyValue &&
+		calicoBgpPeer.Labels[config.KubeLabelManaged] == config.KubeApp &&
+		calicoBgpPeer.Annotations[bgpv1alpha1.PeeringProfileAnnotation] == profileName {
+		return nil
+	}
+	patch := client.MergeFrom(calicoBgpPeer.DeepCopy())
+	if calicoBgpPeer.Labels == nil {
+		calicoBgpPeer.Labels = map[string]string{}
+	}
+	calicoBgpPeer.Labels[config.KubeLabelManaged] = config.KubeApp
+	calicoBgpPeer.Labels[topologyv1alpha1.TopologyValue] = topologyValue
+	if profileName == "" {
+		delete(calicoBgpPeer.Annotations, bgpv1alpha1.PeeringProfileAnnotation)
+	} else {
+		if calicoBgpPeer.Annotations == nil {
+			calicoBgpPeer.Annotations = map[string]string{}
+		}
+		calicoBgpPeer.Annotations[bgpv1alpha1.PeeringProfileAnnotation] = profileName
+	}
+	log.FromContext(ctx).Info("patching calico peer metadata", "peer", calicoBgpPeer.Name)
+	return r.Patch(ctx, calicoBgpPeer, patch)
+}
+
+// setPeerConditions sets the PeersApplied and Degraded conditions, the effective peers and the peering profile of a BgpPeerDiscovery
+func (r *CalicoBgpReconciler) setPeerConditions(ctx context.Context, bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery, result peerResult, applyErr error) error {
+	latest, err := clients.PatchStatus(ctx, r.Client, r.APIReader, bgpPeerDiscovery, func(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) {
+		r.setPeerStatus(bgpPeerDiscovery, result, applyErr)
+	})
+	if err != nil {
+		return err
+	}
+	*bgpPeerDiscovery = *latest
+	return nil
+}
+
+// setPeerStatus renders the peer status and conditions of a BgpPeerDiscovery from the result of applying its peers
+func (r *CalicoBgpReconciler) setPeerStatus(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery, result peerResult, applyErr error) {
+	generation := bgpPeerDiscovery.Generation
+	bgpPeerDiscovery.Status.ObservedGeneration = generation
+	bgpPeerDiscovery.Status.EffectivePeers = result.effective
+	bgpPeerDiscovery.Status.NodeExceptions = result.exceptions
+	if applyErr == nil {
+		bgpPeerDiscovery.Status.Sessions = result.sessions
+	}
+	bgpPeerDiscovery.Status.PeeringProfile = ""
+	if result.profile != nil {
+		bgpPeerDiscovery.Status.PeeringProfile = result.profile.Name
+	}
+	message := fmt.Sprintf("%d BGPPeers applied", len(result.effective))
+	if len(result.excluded) > 0 {
+		message += ", excluded " + strings.Join(result.excluded, ", ")
+	}
+
+	peersApplied := metav1.Condition{
+		Type:               bgpv1alpha1.ConditionPeersApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             bgpv1alpha1.ReasonPeersApplied,
+		Message:            message,
+		ObservedGeneration: generation,
+	}
+	degraded := metav1.Condition{
+		Type:               bgpv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             bgpv1alpha1.ReasonAsExpected,
+		Message:            "all discovered peers applied",
+		ObservedGeneration: generation,
+	}
+	switch {
+	case applyErr != nil:
+		peersApplied.Status = metav1.ConditionFalse
+		peersApplied.Reason = bgpv1alpha1.ReasonApplyFailed
+		if errors.Is(applyErr, errFilterMissing) {
+			peersApplied.Reason = bgpv1alpha1.ReasonFilterMissing
+		}
+		peersApplied.Message = applyErr.Error()
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = peersApplied.Reason
+		degraded.Message = applyErr.Error()
+	case result.rollout != nil && result.rollout.timedOut:
+		peersApplied.Status = metav1.ConditionFalse
+		peersApplied.Reason = bgpv1alpha1.ReasonPeersReplacing
+		peersApplied.Message = result.rollout.message()
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = bgpv1alpha1.ReasonSessionNotEstablished
+		degraded.Message = fmt.Sprintf("sessions to replaced BGPPeer %s not established within %s", result.rollout.peer, r.RolloutTimeout)
+	case result.rollout != nil:
+		peersApplied.Status = metav1.ConditionFalse
+		peersApplied.Reason = bgpv1alpha1.ReasonPeersReplacing
+		peersApplied.Message = result.rollout.message()
+	case result.stale != nil:
+		peersApplied.Reason = bgpv1alpha1.ReasonStalePeersRetiring
+		peersApplied.Message += ", " + result.stale.message()
+	case len(result.skipped) > 0:
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = bgpv1alpha1.ReasonUnreachablePeers
+		degraded.Message = "skipped unreachable peers " + strings.Join(result.skipped, ", ")
+	}
+	meta.SetStatusCondition(&bgpPeerDiscovery.Status.Conditions, peersApplied)
+	meta.SetStatusCondition(&bgpPeerDiscovery.Status.Conditions, degraded)
+}
+
+// setLabelDiscoveryPeersApplied sets the PeersApplied condition of a LabelDiscovery from its finalized topology values
+func setLabelDiscoveryPeersApplied(labelDiscovery *topologyv1alpha1.LabelDiscovery) {
+	generation := labelDiscovery.Generation
+	labelDiscovery.Status.ObservedGeneration = generation
+	condition := metav1.Condition{
+		Type:               topologyv1alpha1.ConditionPeersApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             topologyv1alpha1.ReasonPeersApplied,
+		Message:            "all topology values finalized",
+		ObservedGeneration: generation,
+	}
+	if pending := labelDiscovery.Status.PendingTopologyValues(); len(pending) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = topologyv1alpha1.ReasonPeersPending
+		condition.Message = "waiting for topology values " + strings.Join(pending, ", ")
+	}
+	meta.SetStatusCondition(&labelDiscovery.Status.Conditions, condition)
 }
 
 func intToUint32(value int) (uint32, error) {
@@ -151,12 +499,64 @@ func intToUint32(value int) (uint32, error) {
 	return uint32(value), nil
 }
 
-func generateCalicoBgpPeer(nsName types.NamespacedName, spec v3.BGPPeerSpec, calicoBgpPeer *v3.BGPPeer) *v3.BGPPeer {
+func int64ToUint32(value int64) (uint32, error) {
+	if value < 0 || value > int64(^uint32(0)) {
+		return 0, errors.New("integer overflow: value out of range for uint32")
+	}
+	return uint32(value), nil
+}
+
+func generateCalicoBgpPeer(nsName types.NamespacedName, topologyValue string, spec v3.BGPPeerSpec, peer bgpv1alpha1.DiscoveredPeer, calicoBgpPeer *v3.BGPPeer) *v3.BGPPeer {
 	calicoBgpPeer.Name = nsName.Name
 	calicoBgpPeer.Namespace = nsName.Namespace
 	calicoBgpPeer.Spec = spec
 	calicoBgpPeer.Labels = map[string]string{}
 	calicoBgpPeer.Labels[config.KubeLabelComponent] = "BgpPeer"
 	calicoBgpPeer.Labels[config.KubeLabelManaged] = config.KubeApp
+	calicoBgpPeer.Labels[topologyv1alpha1.TopologyValue] = topologyValue
+	calicoBgpPeer.Annotations = map[string]string{}
+	if peer.Method != "" {
+		calicoBgpPeer.Annotations[bgpv1alpha1.PeerDiscoveryMethod] = string(peer.Method)
+	}
+	if peer.SourceNode != "" {
+		calicoBgpPeer.Annotations[bgpv1alpha1.PeerSourceNode] = peer.SourceNode
+	}
+	if peer.Interface != "" {
+		calicoBgpPeer.Annotations[bgpv1alpha1.PeerInterface] = peer.Interface
+	}
+	if peer.Source.Address != "" {
+		calicoBgpPeer.Annotations[bgpv1alpha1.PeerSourceAddress] = peer.Source.Address
+	}
 	return calicoBgpPeer
 }
+
+// peerSourceAddress maps the probe source of a peer to the matching Calico source address mode
+func peerSourceAddress(source bgpv1alpha1.PeerSource) v3.SourceAddress {
+	if source.NodeIP {
+		return v3.SourceAddressUseNodeIP
+	}
+	return v3.SourceAddressNone
+}
+
+// isManaged filters the Calico objects managed by cni-nanny
+func isManaged(obj client.Object) bool {
+	return obj.GetLabels()[config.KubeLabelManaged] == config.KubeApp
+}
+
+// bgpPeerDiscoveryForNode enqueues the rack of a node, so nodes joining or leaving a rack get their node-specific objects
+func bgpPeerDiscoveryForNode(_ context.Context, obj client.Object) []reconcile.Request {
+	topologyValue, ok := obj.GetLabels()[config.Cfg.NodeTopologyLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: config.Cfg.Namespace, Name: topologyValue}}}
+}
+
+// bgpPeerDiscoveryForPeer enqueues the rack of a managed BGPPeer or BGPConfiguration, so changed and deleted ones are reconciled
+func bgpPeerDiscoveryForPeer(_ context.Context, obj client.Object) []reconcile.Request {
+	topologyValue, ok := obj.GetLabels()[topologyv1alpha1.TopologyValue]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: config.Cfg.Namespace, Name: topologyValue}}}
+}
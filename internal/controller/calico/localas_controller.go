@@ -0,0 +1,363 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+// LocalASScope selects whether each node or each rack gets its own local AS number
+type LocalASScope string
+
+const (
+	LocalASScopeNode LocalASScope = "Node"
+	LocalASScopeRack LocalASScope = "Rack"
+)
+
+const localASComponent = "AsnAllocation"
+
+// errASRangesExhausted is returned if all AS numbers of the configured ranges are allocated
+var errASRangesExhausted = errors.New("local AS number ranges exhausted")
+
+// Valid reports whether the local AS scope is supported
+func (s LocalASScope) Valid() bool {
+	switch s {
+	case LocalASScopeNode, LocalASScopeRack:
+		return true
+	}
+	return false
+}
+
+// ASRange is an inclusive range of AS numbers
+type ASRange struct {
+	First int64
+	Last  int64
+}
+
+// contains reports whether an AS number is within the range
+func (r ASRange) contains(asNumber int64) bool {
+	return asNumber >= r.First && asNumber <= r.Last
+}
+
+// ParseASRanges parses a comma-separated list of AS numbers and inclusive ranges like 64512-64999
+func ParseASRanges(value string) ([]ASRange, error) {
+	var ranges []ASRange
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		if !isRange {
+			last = first
+		}
+		var asRange ASRange
+		var err error
+		asRange.First, err = parseASNumber(first)
+		if err != nil {
+			return nil, err
+		}
+		asRange.Last, err = parseASNumber(last)
+		if err != nil {
+			return nil, err
+		}
+		if asRange.First > asRange.Last {
+			return nil, fmt.Errorf("invalid AS number range %s", part)
+		}
+		for _, other := range ranges {
+			if asRange.First <= other.Last && other.First <= asRange.Last {
+				return nil, fmt.Errorf("AS number range %s overlaps %d-%d", part, other.First, other.Last)
+			}
+		}
+		ranges = append(ranges, asRange)
+	}
+	slices.SortFunc(ranges, func(a, b ASRange) int {
+		return cmp.Compare(a.First, b.First)
+	})
+	return ranges, nil
+}
+
+// parseASNumber parses a 32-bit AS number
+func parseASNumber(value string) (int64, error) {
+	asNumber, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AS number %q: %w", value, err)
+	}
+	if _, err := int64ToUint32(asNumber); err != nil || asNumber == 0 {
+		return 0, fmt.Errorf("invalid AS number %d", asNumber)
+	}
+	return asNumber, nil
+}
+
+// LocalASReconciler allocates local AS numbers to nodes or racks from configured ranges and sets them on the Calico nodes.
+// The numbers are written to the projectcalico.org/ASNumber annotation of the nodes, which Calico only reads with the
+// Kubernetes datastore, with etcd the annotation has no effect.
+type LocalASReconciler struct {
+	client.Client
+	Scheme            *runtime.Scheme
+	NodeTopologyLabel string
+	Ranges            []ASRange
+	Scope             LocalASScope
+}
+
+//+kubebuilder:rbac:groups=bgp.cninanny.sap.cc,resources=asnallocations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;patch
+
+// Reconcile allocates the local AS number of a node or rack, the request name is the node name or the topology value.
+// The allocation is stored as an AsnAllocation named after the AS number, so the API server rejects a second
+// allocation of the same number. Allocations of nodes or racks without nodes are freed, and so are the allocations of
+// the other scope left behind by a changed --local-as-scope.
+func (r *LocalASReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	nodes, err := r.ownerNodes(ctx, req.Name)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error listing nodes")
+		return ctrl.Result{}, err
+	}
+	allocations := &bgpv1alpha1.AsnAllocationList{}
+	err = r.List(ctx, allocations, client.InNamespace(config.Cfg.Namespace))
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error listing AS number allocations")
+		return ctrl.Result{}, err
+	}
+	var owned []bgpv1alpha1.AsnAllocation
+	allocated := map[int64]struct{}{}
+	for _, allocation := range allocations.Items {
+		owner := r.owner(allocation.Spec)
+		if owner == "" {
+			// the number is set on the nodes until their owner allocates anew, allocate keeps it then if it is free
+			log.FromContext(ctx).Info("freeing AS number of another scope", "as number", allocation.Spec.ASNumber)
+			err = client.IgnoreNotFound(r.Delete(ctx, &allocation))
+			if err != nil {
+				log.FromContext(ctx).Error(err, "error freeing AS number")
+				return ctrl.Result{}, err
+			}
+			continue
+		}
+		allocated[allocation.Spec.ASNumber] = struct{}{}
+		if owner == req.Name {
+			owned = append(owned, allocation)
+		}
+	}
+	slices.SortFunc(owned, func(a, b bgpv1alpha1.AsnAllocation) int {
+		return cmp.Compare(a.Spec.ASNumber, b.Spec.ASNumber)
+	})
+
+	if len(nodes) == 0 {
+		for _, allocation := range owned {
+			log.FromContext(ctx).Info("freeing AS number", "owner", req.Name, "as number", allocation.Spec.ASNumber)
+			err = client.IgnoreNotFound(r.Delete(ctx, &allocation))
+			if err != nil {
+				log.FromContext(ctx).Error(err, "error freeing AS number")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	var asNumber int64
+	if len(owned) > 0 {
+		// a previous allocation is kept even if the ranges changed, duplicates of concurrent allocations are freed
+		asNumber = owned[0].Spec.ASNumber
+		for _, allocation := range owned[1:] {
+			log.FromContext(ctx).Info("freeing duplicate AS number", "owner", req.Name, "as number", allocation.Spec.ASNumber)
+			err = client.IgnoreNotFound(r.Delete(ctx, &allocation))
+			if err != nil {
+				log.FromContext(ctx).Error(err, "error freeing AS number")
+				return ctrl.Result{}, err
+			}
+		}
+	} else {
+		asNumber, err = r.allocate(ctx, req.Name, nodes, allocated)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error allocating AS number", "owner", req.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	value := strconv.FormatInt(asNumber, 10)
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Annotations[config.CalicoASNumberAnnotation] == value {
+			continue
+		}
+		patch := client.MergeFrom(node.DeepCopy())
+		if node.Annotations == nil {
+			node.Annotations = map[string]string{}
+		}
+		node.Annotations[config.CalicoASNumberAnnotation] = value
+		err = r.Patch(ctx, node, patch)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error setting AS number", "node", node.Name)
+			return ctrl.Result{}, err
+		}
+		log.FromContext(ctx).Info("AS number set", "node", node.Name, "as number", asNumber)
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *LocalASReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("local as controller").
+		// status updates of nodes are frequent, only their topology label and AS number annotation matter
+		Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(r.ownerOfNode),
+			builder.WithPredicates(predicate.Or(predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Watches(&bgpv1alpha1.AsnAllocation{}, handler.EnqueueRequestsFromMapFunc(r.ownerOfAllocation)).
+		Complete(r)
+}
+
+// allocate allocates the lowest free AS number to an owner, an AS number already set on one of its nodes is kept if
+// it is within the ranges and free
+func (r *LocalASReconciler) allocate(ctx context.Context, owner string, nodes []corev1.Node, allocated map[int64]struct{}) (int64, error) {
+	var candidates []int64
+	for _, node := range nodes {
+		asNumber, err := strconv.ParseInt(node.Annotations[config.CalicoASNumberAnnotation], 10, 64)
+		if err == nil && r.inRanges(asNumber) {
+			candidates = append(candidates, asNumber)
+		}
+	}
+	for _, candidate := range candidates {
+		if _, ok := allocated[candidate]; ok {
+			continue
+		}
+		created, err := r.createAllocation(ctx, owner, candidate)
+		if err != nil || created {
+			return candidate, err
+		}
+		allocated[candidate] = struct{}{}
+	}
+	for _, asRange := range r.Ranges {
+		for candidate := asRange.First; candidate <= asRange.Last; candidate++ {
+			if _, ok := allocated[candidate]; ok {
+				continue
+			}
+			created, err := r.createAllocation(ctx, owner, candidate)
+			if err != nil || created {
+				return candidate, err
+			}
+			// the cache did not know the allocation yet, try the next AS number
+			allocated[candidate] = struct{}{}
+		}
+	}
+	return 0, errASRangesExhausted
+}
+
+// createAllocation creates the AsnAllocation of an AS number, it reports false if the AS number is already allocated
+func (r *LocalASReconciler) createAllocation(ctx context.Context, owner string, asNumber int64) (bool, error) {
+	allocation := &bgpv1alpha1.AsnAllocation{}
+	allocation.Name = bgpv1alpha1.AsnAllocationName(asNumber)
+	allocation.Namespace = config.Cfg.Namespace
+	allocation.Labels = map[string]string{
+		config.KubeLabelComponent: localASComponent,
+		config.KubeLabelManaged:   config.KubeApp,
+	}
+	allocation.Spec.ASNumber = asNumber
+	if r.Scope == LocalASScopeRack {
+		allocation.Spec.TopologyValue = owner
+	} else {
+		allocation.Spec.Node = owner
+	}
+	err := r.Create(ctx, allocation)
+	if k8serrors.IsAlreadyExists(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	log.FromContext(ctx).Info("AS number allocated", "owner", owner, "as number", asNumber)
+	return true, nil
+}
+
+// inRanges reports whether an AS number is within the configured ranges
+func (r *LocalASReconciler) inRanges(asNumber int64) bool {
+	return slices.ContainsFunc(r.Ranges, func(asRange ASRange) bool {
+		return asRange.contains(asNumber)
+	})
+}
+
+// ownerNodes returns the nodes of an owner, the node of the name or the nodes of the topology value
+func (r *LocalASReconciler) ownerNodes(ctx context.Context, owner string) ([]corev1.Node, error) {
+	if r.Scope == LocalASScopeRack {
+		nodes := &corev1.NodeList{}
+		err := r.List(ctx, nodes, client.MatchingLabels{r.NodeTopologyLabel: owner})
+		if err != nil {
+			return nil, err
+		}
+		return nodes.Items, nil
+	}
+	node := &corev1.Node{}
+	err := r.Get(ctx, types.NamespacedName{Name: owner}, node)
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []corev1.Node{*node}, nil
+}
+
+// owner returns the node name or topology value an allocation belongs to
+func (r *LocalASReconciler) owner(spec bgpv1alpha1.AsnAllocationSpec) string {
+	if r.Scope == LocalASScopeRack {
+		return spec.TopologyValue
+	}
+	return spec.Node
+}
+
+// ownerOfNode enqueues the owner of a node, nodes without topology value get no AS number per rack
+func (r *LocalASReconciler) ownerOfNode(_ context.Context, obj client.Object) []reconcile.Request {
+	owner := obj.GetName()
+	if r.Scope == LocalASScopeRack {
+		owner = obj.GetLabels()[r.NodeTopologyLabel]
+	}
+	if owner == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: owner}}}
+}
+
+// ownerOfAllocation enqueues the owner of an allocation, so allocations of owners deleted meanwhile are freed
+func (r *LocalASReconciler) ownerOfAllocation(_ context.Context, obj client.Object) []reconcile.Request {
+	allocation, ok := obj.(*bgpv1alpha1.AsnAllocation)
+	if !ok || allocation.Namespace != config.Cfg.Namespace {
+		return nil
+	}
+	owner := r.owner(allocation.Spec)
+	if owner == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: owner}}}
+}
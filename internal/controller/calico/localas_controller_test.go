@@ -0,0 +1,187 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+var _ = Describe("ParseASRanges", func() {
+
+	DescribeTable("parses AS numbers and ranges sorted by their first number",
+		func(value string, expected []ASRange) {
+			ranges, err := ParseASRanges(value)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ranges).To(Equal(expected))
+		},
+		Entry("empty", "", nil),
+		Entry("single AS number", "64512", []ASRange{{First: 64512, Last: 64512}}),
+		Entry("range", "64512-64999", []ASRange{{First: 64512, Last: 64999}}),
+		Entry("4-byte range", "4200000000-4294967294", []ASRange{{First: 4200000000, Last: 4294967294}}),
+		Entry("unsorted with spaces and empty parts", " 65100 , 64512 - 64999,,",
+			[]ASRange{{First: 64512, Last: 64999}, {First: 65100, Last: 65100}}),
+		Entry("adjacent ranges", "64512-64599,64600-64699",
+			[]ASRange{{First: 64512, Last: 64599}, {First: 64600, Last: 64699}}),
+	)
+
+	DescribeTable("rejects invalid ranges",
+		func(value, message string) {
+			_, err := ParseASRanges(value)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("not a number", "as64512", `invalid AS number "as64512"`),
+		Entry("AS number 0", "0-10", "invalid AS number 0"),
+		Entry("AS number too large", "4294967296", "invalid AS number 4294967296"),
+		Entry("negative", "-5", `invalid AS number ""`),
+		Entry("reversed", "64999-64512", "invalid AS number range 64999-64512"),
+		Entry("overlapping", "64512-64999,64900-65100", "AS number range 64900-65100 overlaps 64512-64999"),
+		Entry("duplicate", "64512,64512", "AS number range 64512 overlaps 64512-64512"),
+	)
+
+})
+
+var _ = Describe("LocalASReconciler", func() {
+
+	const topologyLabel = "topology.kubernetes.io/rack"
+
+	node := func(name, rack, asNumber string) *corev1.Node {
+		node := &corev1.Node{}
+		node.Name = name
+		node.Labels = map[string]string{topologyLabel: rack}
+		if asNumber != "" {
+			node.Annotations = map[string]string{config.CalicoASNumberAnnotation: asNumber}
+		}
+		return node
+	}
+
+	allocation := func(asNumber int64, spec bgpv1alpha1.AsnAllocationSpec) *bgpv1alpha1.AsnAllocation {
+		allocation := &bgpv1alpha1.AsnAllocation{Spec: spec}
+		allocation.Name = bgpv1alpha1.AsnAllocationName(asNumber)
+		allocation.Namespace = "cni-nanny"
+		allocation.Spec.ASNumber = asNumber
+		return allocation
+	}
+
+	newReconciler := func(scope LocalASScope, objects ...client.Object) *LocalASReconciler {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(bgpv1alpha1.AddToScheme(scheme)).To(Succeed())
+		return &LocalASReconciler{
+			Client:            fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+			Scheme:            scheme,
+			NodeTopologyLabel: topologyLabel,
+			Ranges:            []ASRange{{First: 64512, Last: 64514}},
+			Scope:             scope,
+		}
+	}
+
+	reconcile := func(ctx SpecContext, r *LocalASReconciler, owner string) error {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: owner}})
+		return err
+	}
+
+	owners := func(ctx SpecContext, r *LocalASReconciler) map[int64]bgpv1alpha1.AsnAllocationSpec {
+		allocations := &bgpv1alpha1.AsnAllocationList{}
+		Expect(r.List(ctx, allocations)).To(Succeed())
+		result := map[int64]bgpv1alpha1.AsnAllocationSpec{}
+		for _, allocation := range allocations.Items {
+			result[allocation.Spec.ASNumber] = allocation.Spec
+		}
+		return result
+	}
+
+	asNumberOf := func(ctx SpecContext, r *LocalASReconciler, name string) string {
+		node := &corev1.Node{}
+		Expect(r.Get(ctx, types.NamespacedName{Name: name}, node)).To(Succeed())
+		return node.Annotations[config.CalicoASNumberAnnotation]
+	}
+
+	BeforeEach(func() {
+		namespace := config.Cfg.Namespace
+		config.Cfg.Namespace = "cni-nanny"
+		DeferCleanup(func() { config.Cfg.Namespace = namespace })
+	})
+
+	It("allocates the lowest free AS number and sets it on the node", func(ctx SpecContext) {
+		r := newReconciler(LocalASScopeNode, node("node-a", "rack1", ""), node("node-b", "rack1", ""),
+			allocation(64512, bgpv1alpha1.AsnAllocationSpec{Node: "node-a"}))
+		Expect(reconcile(ctx, r, "node-b")).To(Succeed())
+		Expect(owners(ctx, r)).To(HaveKeyWithValue(int64(64513), bgpv1alpha1.AsnAllocationSpec{ASNumber: 64513, Node: "node-b"}))
+		Expect(asNumberOf(ctx, r, "node-b")).To(Equal("64513"))
+	})
+
+	It("keeps a free AS number the node already has", func(ctx SpecContext) {
+		r := newReconciler(LocalASScopeNode, node("node-a", "rack1", "64514"))
+		Expect(reconcile(ctx, r, "node-a")).To(Succeed())
+		Expect(owners(ctx, r)).To(HaveKey(int64(64514)))
+		Expect(asNumberOf(ctx, r, "node-a")).To(Equal("64514"))
+	})
+
+	It("allocates one AS number for all nodes of a rack", func(ctx SpecContext) {
+		r := newReconciler(LocalASScopeRack, node("node-a", "rack1", ""), node("node-b", "rack1", ""))
+		Expect(reconcile(ctx, r, "rack1")).To(Succeed())
+		Expect(owners(ctx, r)).To(Equal(map[int64]bgpv1alpha1.AsnAllocationSpec{64512: {ASNumber: 64512, TopologyValue: "rack1"}}))
+		Expect(asNumberOf(ctx, r, "node-a")).To(Equal("64512"))
+		Expect(asNumberOf(ctx, r, "node-b")).To(Equal("64512"))
+	})
+
+	It("fails once the ranges are exhausted", func(ctx SpecContext) {
+		r := newReconciler(LocalASScopeNode, node("node-d", "rack1", ""),
+			allocation(64512, bgpv1alpha1.AsnAllocationSpec{Node: "node-a"}),
+			allocation(64513, bgpv1alpha1.AsnAllocationSpec{Node: "node-b"}),
+			allocation(64514, bgpv1alpha1.AsnAllocationSpec{Node: "node-c"}),
+			node("node-a", "rack1", ""), node("node-b", "rack1", ""), node("node-c", "rack1", ""))
+		Expect(reconcile(ctx, r, "node-d")).To(MatchError(errASRangesExhausted))
+	})
+
+	It("keeps the lowest of duplicate allocations and frees the others", func(ctx SpecContext) {
+		r := newReconciler(LocalASScopeNode, node("node-a", "rack1", "64514"),
+			allocation(64513, bgpv1alpha1.AsnAllocationSpec{Node: "node-a"}),
+			allocation(64514, bgpv1alpha1.AsnAllocationSpec{Node: "node-a"}))
+		Expect(reconcile(ctx, r, "node-a")).To(Succeed())
+		Expect(owners(ctx, r)).To(Equal(map[int64]bgpv1alpha1.AsnAllocationSpec{64513: {ASNumber: 64513, Node: "node-a"}}))
+		Expect(asNumberOf(ctx, r, "node-a")).To(Equal("64513"))
+	})
+
+	It("frees the allocations of an owner without nodes", func(ctx SpecContext) {
+		r := newReconciler(LocalASScopeRack, node("node-a", "rack1", "64512"),
+			allocation(64512, bgpv1alpha1.AsnAllocationSpec{TopologyValue: "rack1"}),
+			allocation(64513, bgpv1alpha1.AsnAllocationSpec{TopologyValue: "rack2"}))
+		Expect(reconcile(ctx, r, "rack2")).To(Succeed())
+		Expect(owners(ctx, r)).To(Equal(map[int64]bgpv1alpha1.AsnAllocationSpec{64512: {ASNumber: 64512, TopologyValue: "rack1"}}))
+	})
+
+	It("frees the allocations of the other scope and keeps a number of the rack's nodes", func(ctx SpecContext) {
+		r := newReconciler(LocalASScopeRack, node("node-a", "rack1", "64513"), node("node-b", "rack1", "64514"),
+			allocation(64513, bgpv1alpha1.AsnAllocationSpec{Node: "node-a"}),
+			allocation(64514, bgpv1alpha1.AsnAllocationSpec{Node: "node-b"}),
+			allocation(64512, bgpv1alpha1.AsnAllocationSpec{}))
+		Expect(reconcile(ctx, r, "rack1")).To(Succeed())
+		Expect(owners(ctx, r)).To(Equal(map[int64]bgpv1alpha1.AsnAllocationSpec{64513: {ASNumber: 64513, TopologyValue: "rack1"}}))
+		Expect(asNumberOf(ctx, r, "node-a")).To(Equal("64513"))
+		Expect(asNumberOf(ctx, r, "node-b")).To(Equal("64513"))
+	})
+})
@@ -0,0 +1,136 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"fmt"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+const (
+	nodeConfigurationComponent = "BgpConfiguration"
+	// nodeConfigurationPrefix is the name prefix of node-specific Calico BGPConfigurations
+	nodeConfigurationPrefix = "node."
+)
+
+// syncNodeConfigurations applies the BGPConfiguration template of a profile to the node-specific BGPConfigurations of
+// the nodes of a rack and deletes the managed ones of nodes no longer in the rack or without template
+func (r *CalicoBgpReconciler) syncNodeConfigurations(ctx context.Context, topologyValue string, profile *bgpv1alpha1.PeeringProfile) error {
+	desired := map[string]struct{}{}
+	if profile != nil && profile.Spec.BGPConfiguration != nil {
+		spec, err := renderNodeConfiguration(*profile.Spec.BGPConfiguration)
+		if err != nil {
+			return fmt.Errorf("error rendering BGPConfiguration of peering profile %s: %w", profile.Name, err)
+		}
+		nodes := &corev1.NodeList{}
+		err = r.List(ctx, nodes, client.MatchingLabels{config.Cfg.NodeTopologyLabel: topologyValue})
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes.Items {
+			name := nodeConfigurationPrefix + node.Name
+			desired[name] = struct{}{}
+			err = r.applyNodeConfiguration(ctx, name, topologyValue, spec)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	configurations, err := r.ownedNodeConfigurations(ctx, topologyValue)
+	if err != nil {
+		return err
+	}
+	for i := range configurations {
+		configuration := &configurations[i]
+		if _, ok := desired[configuration.Name]; ok {
+			continue
+		}
+		log.FromContext(ctx).Info("deleting calico node configuration", "configuration", configuration.Name)
+		err = client.IgnoreNotFound(r.Delete(ctx, configuration))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyNodeConfiguration creates or patches a node-specific BGPConfiguration. Like BGPPeers, existing ones are adopted,
+// so configurations orphaned by a deleted BgpPeerDiscovery are managed again by a new one.
+func (r *CalicoBgpReconciler) applyNodeConfiguration(ctx context.Context, name, topologyValue string, spec v3.BGPConfigurationSpec) error {
+	configuration := &v3.BGPConfiguration{}
+	configuration.Name = name
+	result, err := controllerutil.CreateOrPatch(ctx, r.Client, configuration, func() error {
+		if configuration.Labels == nil {
+			configuration.Labels = map[string]string{}
+		}
+		configuration.Labels[config.KubeLabelComponent] = nodeConfigurationComponent
+		configuration.Labels[config.KubeLabelManaged] = config.KubeApp
+		configuration.Labels[topologyv1alpha1.TopologyValue] = topologyValue
+		configuration.Spec = spec
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("calico node configuration reconciled", "configuration", name, "operation", result)
+	}
+	return nil
+}
+
+// ownedNodeConfigurations lists the node-specific BGPConfigurations managed for the nodes of a topology value
+func (r *CalicoBgpReconciler) ownedNodeConfigurations(ctx context.Context, topologyValue string) ([]v3.BGPConfiguration, error) {
+	configurations := &v3.BGPConfigurationList{}
+	err := r.List(ctx, configurations, client.MatchingLabels{
+		config.KubeLabelManaged:        config.KubeApp,
+		topologyv1alpha1.TopologyValue: topologyValue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return configurations.Items, nil
+}
+
+// renderNodeConfiguration renders the spec of a node-specific BGPConfiguration from a profile template
+func renderNodeConfiguration(template bgpv1alpha1.BGPConfigurationTemplate) (v3.BGPConfigurationSpec, error) {
+	spec := v3.BGPConfigurationSpec{}
+	if template.ListenPort != nil {
+		if *template.ListenPort < 1 || *template.ListenPort > 65535 {
+			return spec, fmt.Errorf("listen port %d out of range", *template.ListenPort)
+		}
+		spec.ListenPort = uint16(*template.ListenPort)
+	}
+	for _, community := range template.Communities {
+		spec.Communities = append(spec.Communities, v3.Community{Name: community.Name, Value: community.Value})
+	}
+	for _, advertisement := range template.PrefixAdvertisements {
+		spec.PrefixAdvertisements = append(spec.PrefixAdvertisements, v3.PrefixAdvertisement{
+			CIDR:        advertisement.CIDR,
+			Communities: advertisement.Communities,
+		})
+	}
+	return spec, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+var _ = Describe("syncNodeConfigurations", func() {
+
+	var (
+		reconciler *CalicoBgpReconciler
+		profile    *bgpv1alpha1.PeeringProfile
+	)
+
+	configuration := func(name string, labels map[string]string) *v3.BGPConfiguration {
+		configuration := &v3.BGPConfiguration{}
+		configuration.Name = name
+		configuration.Labels = labels
+		return configuration
+	}
+
+	BeforeEach(func() {
+		topologyLabel := config.Cfg.NodeTopologyLabel
+		config.Cfg.NodeTopologyLabel = "topology.kubernetes.io/rack"
+		DeferCleanup(func() { config.Cfg.NodeTopologyLabel = topologyLabel })
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v3.AddToScheme(scheme)).To(Succeed())
+		node := &corev1.Node{}
+		node.Name = "node-a"
+		node.Labels = map[string]string{config.Cfg.NodeTopologyLabel: "rack1"}
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(node,
+				// orphaned with a deleted BgpPeerDiscovery
+				configuration(nodeConfigurationPrefix+"node-a", map[string]string{config.KubeLabelComponent: nodeConfigurationComponent}),
+				// of a node that left the rack
+				configuration(nodeConfigurationPrefix+"node-b", map[string]string{
+					config.KubeLabelManaged:        config.KubeApp,
+					topologyv1alpha1.TopologyValue: "rack1",
+				}),
+			).
+			Build()
+		reconciler = &CalicoBgpReconciler{Client: c, APIReader: c}
+		profile = &bgpv1alpha1.PeeringProfile{}
+		profile.Name = "rack1"
+		listenPort := int32(1179)
+		profile.Spec.BGPConfiguration = &bgpv1alpha1.BGPConfigurationTemplate{ListenPort: &listenPort}
+	})
+
+	getConfiguration := func(ctx context.Context, name string) (*v3.BGPConfiguration, error) {
+		configuration := &v3.BGPConfiguration{}
+		err := reconciler.Get(ctx, client.ObjectKey{Name: name}, configuration)
+		return configuration, err
+	}
+
+	It("adopts orphaned node configurations and deletes those of nodes that left", func(ctx SpecContext) {
+		Expect(reconciler.syncNodeConfigurations(ctx, "rack1", profile)).To(Succeed())
+
+		adopted, err := getConfiguration(ctx, nodeConfigurationPrefix+"node-a")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(adopted.Labels).To(HaveKeyWithValue(config.KubeLabelManaged, config.KubeApp))
+		Expect(adopted.Labels).To(HaveKeyWithValue(topologyv1alpha1.TopologyValue, "rack1"))
+		Expect(adopted.Spec.ListenPort).To(Equal(uint16(1179)))
+
+		_, err = getConfiguration(ctx, nodeConfigurationPrefix+"node-b")
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("deletes the managed node configurations without template", func(ctx SpecContext) {
+		Expect(reconciler.syncNodeConfigurations(ctx, "rack1", profile)).To(Succeed())
+		Expect(reconciler.syncNodeConfigurations(ctx, "rack1", nil)).To(Succeed())
+
+		_, err := getConfiguration(ctx, nodeConfigurationPrefix+"node-a")
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+})
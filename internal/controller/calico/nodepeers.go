@@ -0,0 +1,171 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+// peerScope are the nodes a BGPPeer applies to: a single node, or all nodes of the rack except the exceptions
+type peerScope struct {
+	// node is set for node-specific BGPPeers
+	node string
+	// excludedHostnames are the hostnames of the exception nodes, excluded from the BGPPeers of the rack
+	excludedHostnames []string
+}
+
+// name returns the name of the BGPPeer of a peer in this scope
+func (s peerScope) name(topologyValue, ip string) string {
+	if s.node != "" {
+		return peerName(topologyValue+"-"+s.node, ip)
+	}
+	return peerName(topologyValue, ip)
+}
+
+// selector returns the node and node selector of a BGPPeer in this scope
+func (s peerScope) selector(topologyValue string) (node, nodeSelector string) {
+	if s.node != "" {
+		return s.node, ""
+	}
+	nodeSelector = config.Cfg.NodeTopologyLabel + " == " + fmt.Sprintf("%q", topologyValue)
+	if len(s.excludedHostnames) > 0 {
+		quoted := make([]string, 0, len(s.excludedHostnames))
+		for _, hostname := range s.excludedHostnames {
+			quoted = append(quoted, fmt.Sprintf("%q", hostname))
+		}
+		nodeSelector += " && " + corev1.LabelHostname + " not in {" + strings.Join(quoted, ", ") + "}"
+	}
+	return "", nodeSelector
+}
+
+// rackNodes describes the nodes of a rack and the ones whose peers differ from the rack majority
+type rackNodes struct {
+	// names are the nodes using the BGPPeers of the rack
+	names []string
+	// majority are the peers found by most nodes, nil without per-node discovery results
+	majority []string
+	// exceptions are the nodes getting node-specific BGPPeers
+	exceptions []bgpv1alpha1.NodeException
+	// scope is the scope of the BGPPeers of the rack
+	scope peerScope
+}
+
+// rackNodes lists the nodes of a rack and compares their discovered peers with the rack majority
+func (r *CalicoBgpReconciler) rackNodes(ctx context.Context, bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) (*rackNodes, error) {
+	nodes := &corev1.NodeList{}
+	err := r.List(ctx, nodes, client.MatchingLabels{config.Cfg.NodeTopologyLabel: bgpPeerDiscovery.Name})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(nodes.Items, func(a, b corev1.Node) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	rack := &rackNodes{}
+	nodePeers := map[string][]string{}
+	for _, node := range nodes.Items {
+		if peers, ok := bgpPeerDiscovery.Status.NodePeers[node.Name]; ok && len(peers.Peers) > 0 {
+			nodePeers[node.Name] = sortedPeers(peers.Peers)
+		}
+	}
+	rack.majority = majorityPeers(nodePeers)
+	for _, node := range nodes.Items {
+		peers, ok := nodePeers[node.Name]
+		if !ok || slices.Equal(peers, rack.majority) {
+			rack.names = append(rack.names, node.Name)
+			continue
+		}
+		rack.exceptions = append(rack.exceptions, bgpv1alpha1.NodeException{Node: node.Name, Peers: peers})
+		hostname := node.Labels[corev1.LabelHostname]
+		if hostname == "" {
+			hostname = node.Name
+		}
+		rack.scope.excludedHostnames = append(rack.scope.excludedHostnames, hostname)
+	}
+	return rack, nil
+}
+
+// inMajority reports whether the BGPPeers of the rack are applied for a discovered peer
+func (r *rackNodes) inMajority(ip string) bool {
+	return r.majority == nil || slices.Contains(r.majority, ip)
+}
+
+// scopedPeers are the peers applied in a scope and the nodes using them
+type scopedPeers struct {
+	scope peerScope
+	nodes []string
+	peers []bgpv1alpha1.DiscoveredPeer
+}
+
+// scopes splits the merged peers of a rack into the BGPPeers of the rack and the node-specific ones of its exceptions.
+// Discovered peers only found by exception nodes are left out of the BGPPeers of the rack, static peers apply to every node.
+func (r *rackNodes) scopes(peers []bgpv1alpha1.DiscoveredPeer, origins map[string]bgpv1alpha1.PeerOrigin) []scopedPeers {
+	rackPeers := scopedPeers{scope: r.scope, nodes: r.names}
+	for _, peer := range peers {
+		if origins[peer.IP] == bgpv1alpha1.PeerOriginDiscovered && !r.inMajority(peer.IP) {
+			continue
+		}
+		rackPeers.peers = append(rackPeers.peers, peer)
+	}
+	scopes := []scopedPeers{rackPeers}
+	for _, exception := range r.exceptions {
+		nodePeers := scopedPeers{scope: peerScope{node: exception.Node}, nodes: []string{exception.Node}}
+		for _, peer := range peers {
+			if origins[peer.IP] == bgpv1alpha1.PeerOriginStatic || slices.Contains(exception.Peers, peer.IP) {
+				nodePeers.peers = append(nodePeers.peers, peer)
+			}
+		}
+		scopes = append(scopes, nodePeers)
+	}
+	return scopes
+}
+
+// majorityPeers returns the peer set found by most nodes, ties are broken by the larger and then the lower set
+func majorityPeers(nodePeers map[string][]string) []string {
+	counts := map[string]int{}
+	sets := map[string][]string{}
+	for _, peers := range nodePeers {
+		key := strings.Join(peers, ",")
+		counts[key]++
+		sets[key] = peers
+	}
+	var best string
+	found := false
+	for key, count := range counts {
+		if !found || count > counts[best] ||
+			count == counts[best] && (len(sets[key]) > len(sets[best]) || len(sets[key]) == len(sets[best]) && key < best) {
+			best = key
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return sets[best]
+}
+
+func sortedPeers(peers []string) []string {
+	sorted := slices.Clone(peers)
+	slices.Sort(sorted)
+	return slices.Compact(sorted)
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+)
+
+// OrphanReconciler removes the BGPPeer finalizer of deleted BgpPeerDiscoveries while the calico controllers are
+// disabled. The Calico objects of the rack cannot be read without Calico API, so they are always orphaned.
+type OrphanReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// Reconcile removes the finalizer of a deleted BgpPeerDiscovery
+func (r *OrphanReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	bgpPeerDiscovery := &bgpv1alpha1.BgpPeerDiscovery{}
+	err := r.Get(ctx, req.NamespacedName, bgpPeerDiscovery)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if bgpPeerDiscovery.DeletionTimestamp.IsZero() || !controllerutil.ContainsFinalizer(bgpPeerDiscovery, bgpPeerFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	log.FromContext(ctx).Info("orphaning calico objects of deleted bgpPeerDiscovery, the calico controllers are disabled",
+		"bgpPeerDiscovery", bgpPeerDiscovery.Name)
+	controllerutil.RemoveFinalizer(bgpPeerDiscovery, bgpPeerFinalizer)
+	err = r.Update(ctx, bgpPeerDiscovery)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error removing finalizer of bgpPeerDiscovery")
+	}
+	return ctrl.Result{}, client.IgnoreNotFound(err)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *OrphanReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("calico orphan controller").
+		For(&bgpv1alpha1.BgpPeerDiscovery{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return controllerutil.ContainsFinalizer(obj, bgpPeerFinalizer)
+		}))).
+		Complete(r)
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+)
+
+var _ = Describe("OrphanReconciler", func() {
+
+	var reconciler *OrphanReconciler
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(bgpv1alpha1.AddToScheme(scheme)).To(Succeed())
+		reconciler = &OrphanReconciler{Scheme: scheme}
+	})
+
+	bgpPeerDiscovery := func() *bgpv1alpha1.BgpPeerDiscovery {
+		bgpPeerDiscovery := &bgpv1alpha1.BgpPeerDiscovery{}
+		bgpPeerDiscovery.Name = "rack1"
+		bgpPeerDiscovery.Namespace = "cni-nanny"
+		bgpPeerDiscovery.Finalizers = []string{bgpPeerFinalizer}
+		return bgpPeerDiscovery
+	}
+
+	reconcile := func(ctx SpecContext, bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery, deleted bool) {
+		reconciler.Client = fake.NewClientBuilder().WithScheme(reconciler.Scheme).WithObjects(bgpPeerDiscovery).Build()
+		if deleted {
+			Expect(reconciler.Delete(ctx, bgpPeerDiscovery)).To(Succeed())
+		}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(bgpPeerDiscovery)})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("removes the finalizer of a deleted BgpPeerDiscovery", func(ctx SpecContext) {
+		deleted := bgpPeerDiscovery()
+		reconcile(ctx, deleted, true)
+
+		err := reconciler.Get(ctx, client.ObjectKeyFromObject(deleted), &bgpv1alpha1.BgpPeerDiscovery{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("keeps the finalizer of an existing BgpPeerDiscovery", func(ctx SpecContext) {
+		existing := bgpPeerDiscovery()
+		reconcile(ctx, existing, false)
+
+		latest := &bgpv1alpha1.BgpPeerDiscovery{}
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(existing), latest)).To(Succeed())
+		Expect(latest.Finalizers).To(ConsistOf(bgpPeerFinalizer))
+	})
+
+	It("ignores deleted BgpPeerDiscoveries", func(ctx SpecContext) {
+		reconciler.Client = fake.NewClientBuilder().WithScheme(reconciler.Scheme).Build()
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(bgpPeerDiscovery())})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+})
@@ -0,0 +1,127 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+// bgpPeerFinalizer keeps a BgpPeerDiscovery until its BGPPeers were cleaned up or orphaned
+const bgpPeerFinalizer = "bgp.cninanny.sap.cc/bgppeers"
+
+// ownedPeers lists the BGPPeers owned by the BgpPeerDiscovery of a topology value.
+// BGPPeers are cluster-scoped, so ownership is tracked by labels instead of owner references. Managed BGPPeers
+// created before the topology value label are owned by the topology value in their name.
+func (r *CalicoBgpReconciler) ownedPeers(ctx context.Context, topologyValue string) ([]v3.BGPPeer, error) {
+	peers := &v3.BGPPeerList{}
+	err := r.List(ctx, peers, client.MatchingLabels{config.KubeLabelManaged: config.KubeApp})
+	if err != nil {
+		return nil, err
+	}
+	var owned []v3.BGPPeer
+	for _, peer := range peers.Items {
+		value, labeled := peer.Labels[topologyv1alpha1.TopologyValue]
+		if value == topologyValue || !labeled && peer.Name == peerName(topologyValue, peer.Spec.PeerIP) {
+			owned = append(owned, peer)
+		}
+	}
+	return owned, nil
+}
+
+// deletionPolicy returns the deletion policy of a BgpPeerDiscovery, the annotation overrides the configured default
+func (r *CalicoBgpReconciler) deletionPolicy(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) bgpv1alpha1.DeletionPolicy {
+	if policy := bgpv1alpha1.DeletionPolicy(bgpPeerDiscovery.Annotations[bgpv1alpha1.DeletionPolicyAnnotation]); policy.Valid() {
+		return policy
+	}
+	if r.DeletionPolicy.Valid() {
+		return r.DeletionPolicy
+	}
+	return bgpv1alpha1.DeletionPolicyOrphan
+}
+
+// finalize cleans up or orphans the BGPPeers and node-specific BGPConfigurations of a deleted BgpPeerDiscovery and removes its finalizer
+func (r *CalicoBgpReconciler) finalize(ctx context.Context, bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) error {
+	if !controllerutil.ContainsFinalizer(bgpPeerDiscovery, bgpPeerFinalizer) {
+		return nil
+	}
+	topologyValue := bgpPeerDiscovery.Name
+	policy := r.deletionPolicy(bgpPeerDiscovery)
+	peers, err := r.ownedPeers(ctx, topologyValue)
+	if err != nil {
+		return err
+	}
+	for i := range peers {
+		peer := &peers[i]
+		switch policy {
+		case bgpv1alpha1.DeletionPolicyCleanup:
+			log.FromContext(ctx).Info("deleting calico peer of deleted bgpPeerDiscovery", "peer", peer.Name)
+			err = r.Delete(ctx, peer)
+			if k8serrors.IsNotFound(err) {
+				err = nil
+			}
+		case bgpv1alpha1.DeletionPolicyOrphan:
+			log.FromContext(ctx).Info("orphaning calico peer of deleted bgpPeerDiscovery", "peer", peer.Name)
+			patch := client.MergeFrom(peer.DeepCopy())
+			delete(peer.Labels, config.KubeLabelManaged)
+			delete(peer.Labels, topologyv1alpha1.TopologyValue)
+			delete(peer.Annotations, bgpv1alpha1.PeerReplacedAt)
+			delete(peer.Annotations, bgpv1alpha1.PeerSessionReset)
+			delete(peer.Annotations, bgpv1alpha1.PeerStaleSince)
+			err = r.Patch(ctx, peer, patch)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	configurations, err := r.ownedNodeConfigurations(ctx, topologyValue)
+	if err != nil {
+		return err
+	}
+	for i := range configurations {
+		configuration := &configurations[i]
+		switch policy {
+		case bgpv1alpha1.DeletionPolicyCleanup:
+			log.FromContext(ctx).Info("deleting calico node configuration of deleted bgpPeerDiscovery", "configuration", configuration.Name)
+			err = client.IgnoreNotFound(r.Delete(ctx, configuration))
+		case bgpv1alpha1.DeletionPolicyOrphan:
+			log.FromContext(ctx).Info("orphaning calico node configuration of deleted bgpPeerDiscovery", "configuration", configuration.Name)
+			patch := client.MergeFrom(configuration.DeepCopy())
+			delete(configuration.Labels, config.KubeLabelManaged)
+			delete(configuration.Labels, topologyv1alpha1.TopologyValue)
+			err = r.Patch(ctx, configuration, patch)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = r.deleteNodeStatuses(ctx, topologyValue, nil)
+	if err != nil {
+		return err
+	}
+	deleteSessionMetrics(topologyValue)
+
+	controllerutil.RemoveFinalizer(bgpPeerDiscovery, bgpPeerFinalizer)
+	return r.Update(ctx, bgpPeerDiscovery)
+}
@@ -0,0 +1,280 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+// PasswordScope selects whether all peers, the peers of a rack or each peer use their own password Secret
+type PasswordScope string
+
+const (
+	PasswordScopeGlobal PasswordScope = "Global"
+	PasswordScopeRack   PasswordScope = "Rack"
+	PasswordScopePeer   PasswordScope = "Peer"
+)
+
+const (
+	// passwordRoleName is the name of the Role and RoleBinding letting calico-node read the password copies
+	passwordRoleName  = "cni-nanny-bgp-passwords"
+	passwordComponent = "BgpPassword"
+)
+
+// Valid reports whether the password scope is supported
+func (s PasswordScope) Valid() bool {
+	switch s {
+	case PasswordScopeGlobal, PasswordScopeRack, PasswordScopePeer:
+		return true
+	}
+	return false
+}
+
+// PasswordConfig configures the BGP passwords of the generated BGPPeers
+type PasswordConfig struct {
+	// Secret is the name of the password Secret in the operator namespace, passwords are disabled if empty.
+	// With scope Rack the Secrets are named <Secret>-<topology value>, with scope Peer <Secret>-<topology value>-<peer ip>.
+	Secret string
+	// Key is the key of the password in the Secret
+	Key string
+	// Scope selects one Secret for all peers, per rack or per peer
+	Scope PasswordScope
+	// Namespace is the namespace of calico-node the passwords are copied to
+	Namespace string
+	// ServiceAccount is the service account of calico-node
+	ServiceAccount string
+}
+
+// RequiredAccess lists the permissions the passwords need in the operator namespace and in the calico-node namespace
+func (c PasswordConfig) RequiredAccess(namespace string) []authorizationv1.ResourceAttributes {
+	access := []authorizationv1.ResourceAttributes{}
+	for _, verb := range []string{"get", "list", "watch"} {
+		access = append(access, authorizationv1.ResourceAttributes{Namespace: namespace, Verb: verb, Resource: "secrets"})
+	}
+	for _, verb := range []string{"get", "list", "watch", "create", "update", "patch", "delete"} {
+		access = append(access,
+			authorizationv1.ResourceAttributes{Namespace: c.Namespace, Verb: verb, Resource: "secrets"},
+			authorizationv1.ResourceAttributes{Namespace: c.Namespace, Verb: verb, Group: rbacv1.GroupName, Resource: "roles"},
+			authorizationv1.ResourceAttributes{Namespace: c.Namespace, Verb: verb, Group: rbacv1.GroupName, Resource: "rolebindings"},
+		)
+	}
+	return access
+}
+
+// enabled reports whether the BGPPeers get a password
+func (c PasswordConfig) enabled() bool {
+	return c.Secret != ""
+}
+
+// sourceName returns the name of the password Secret of a peer of a topology value
+func (c PasswordConfig) sourceName(topologyValue, ip string) string {
+	switch c.Scope {
+	case PasswordScopeRack:
+		return c.Secret + "-" + topologyValue
+	case PasswordScopePeer:
+		return c.Secret + "-" + topologyValue + "-" + strings.ReplaceAll(ip, ":", "-")
+	}
+	return c.Secret
+}
+
+// isSource filters the password Secrets in the operator namespace
+func (c PasswordConfig) isSource(obj client.Object) bool {
+	return obj.GetNamespace() == config.Cfg.Namespace && strings.HasPrefix(obj.GetName(), c.Secret) &&
+		obj.GetLabels()[config.KubeLabelManaged] != config.KubeApp
+}
+
+// peerPassword returns the password reference of a peer. calico-node only reads Secrets in its own namespace, so
+// the password is copied there. A rotated password gets a new copy, which changes the rendered BGPPeers and
+// makes rollPeers replace them one at a time, one side of the rack after the other.
+func (r *CalicoBgpReconciler) peerPassword(ctx context.Context, topologyValue, ip string) (*v3.BGPPassword, error) {
+	if !r.Passwords.enabled() {
+		return nil, nil
+	}
+	name := r.Passwords.sourceName(topologyValue, ip)
+	source := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: config.Cfg.Namespace, Name: name}, source)
+	if err != nil {
+		return nil, fmt.Errorf("error getting BGP password secret %s: %w", name, err)
+	}
+	password := source.Data[r.Passwords.Key]
+	if len(password) == 0 {
+		return nil, fmt.Errorf("BGP password secret %s has no key %s", name, r.Passwords.Key)
+	}
+	copies, err := r.passwordCopies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	index := slices.IndexFunc(copies, func(secret corev1.Secret) bool {
+		return secret.Annotations[bgpv1alpha1.PasswordSource] == name && bytes.Equal(secret.Data[r.Passwords.Key], password)
+	})
+	var copyName string
+	if index >= 0 {
+		copyName = copies[index].Name
+	} else {
+		// the resource version changes with the password, without disclosing anything about it
+		passwordCopy := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name + "-" + source.ResourceVersion,
+				Namespace: r.Passwords.Namespace,
+				Labels: map[string]string{
+					config.KubeLabelComponent: passwordComponent,
+					config.KubeLabelManaged:   config.KubeApp,
+				},
+				Annotations: map[string]string{bgpv1alpha1.PasswordSource: name},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{r.Passwords.Key: password},
+		}
+		log.FromContext(ctx).Info("copying BGP password secret", "secret", name, "copy", passwordCopy.Name)
+		err = r.Create(ctx, passwordCopy)
+		if err != nil && !k8serrors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		copyName = passwordCopy.Name
+		// calico-node has to be able to read the copy before any BGPPeer references it
+		err = r.ensurePasswordRole(ctx, append(copies, *passwordCopy))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &v3.BGPPassword{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: copyName},
+			Key:                  r.Passwords.Key,
+		},
+	}, nil
+}
+
+// passwordCopies lists the password copies in the calico-node namespace
+func (r *CalicoBgpReconciler) passwordCopies(ctx context.Context) ([]corev1.Secret, error) {
+	secrets := &corev1.SecretList{}
+	err := r.List(ctx, secrets, client.InNamespace(r.Passwords.Namespace), client.MatchingLabels{
+		config.KubeLabelComponent: passwordComponent,
+		config.KubeLabelManaged:   config.KubeApp,
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(secrets.Items, func(a, b corev1.Secret) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return secrets.Items, nil
+}
+
+// retirePasswords deletes the password copies no BGPPeer references that no longer match their Secret,
+// copies of the current passwords are kept for racks whose rollout did not reach them yet
+func (r *CalicoBgpReconciler) retirePasswords(ctx context.Context) error {
+	peers := &v3.BGPPeerList{}
+	err := r.List(ctx, peers)
+	if err != nil {
+		return err
+	}
+	referenced := map[string]struct{}{}
+	for _, peer := range peers.Items {
+		if peer.Spec.Password != nil && peer.Spec.Password.SecretKeyRef != nil {
+			referenced[peer.Spec.Password.SecretKeyRef.Name] = struct{}{}
+		}
+	}
+	copies, err := r.passwordCopies(ctx)
+	if err != nil {
+		return err
+	}
+	kept := make([]corev1.Secret, 0, len(copies))
+	for i := range copies {
+		passwordCopy := &copies[i]
+		if _, ok := referenced[passwordCopy.Name]; ok {
+			kept = append(kept, *passwordCopy)
+			continue
+		}
+		source := &corev1.Secret{}
+		err = r.Get(ctx, types.NamespacedName{Namespace: config.Cfg.Namespace, Name: passwordCopy.Annotations[bgpv1alpha1.PasswordSource]}, source)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		if err == nil && bytes.Equal(source.Data[r.Passwords.Key], passwordCopy.Data[r.Passwords.Key]) {
+			kept = append(kept, *passwordCopy)
+			continue
+		}
+		log.FromContext(ctx).Info("deleting outdated BGP password copy", "copy", passwordCopy.Name)
+		err = r.Delete(ctx, passwordCopy)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return r.ensurePasswordRole(ctx, kept)
+}
+
+// ensurePasswordRole lets the calico-node service account read exactly the password copies
+func (r *CalicoBgpReconciler) ensurePasswordRole(ctx context.Context, copies []corev1.Secret) error {
+	names := make([]string, 0, len(copies))
+	for _, passwordCopy := range copies {
+		names = append(names, passwordCopy.Name)
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+	labels := map[string]string{
+		config.KubeLabelComponent: passwordComponent,
+		config.KubeLabelManaged:   config.KubeApp,
+	}
+
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: passwordRoleName, Namespace: r.Passwords.Namespace}}
+	_, err := controllerutil.CreateOrPatch(ctx, r.Client, role, func() error {
+		role.Labels = labels
+		// a rule without resource names would grant access to all Secrets of the namespace
+		role.Rules = nil
+		if len(names) > 0 {
+			role.Rules = []rbacv1.PolicyRule{{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: names,
+				Verbs:         []string{"get", "list", "watch"},
+			}}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	roleBinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: passwordRoleName, Namespace: r.Passwords.Namespace}}
+	_, err = controllerutil.CreateOrPatch(ctx, r.Client, roleBinding, func() error {
+		roleBinding.Labels = labels
+		roleBinding.RoleRef = rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: passwordRoleName}
+		roleBinding.Subjects = []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      r.Passwords.ServiceAccount,
+			Namespace: r.Passwords.Namespace,
+		}}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+var _ = Describe("PasswordConfig", func() {
+
+	DescribeTable("sourceName",
+		func(scope PasswordScope, ip, expected string) {
+			passwords := PasswordConfig{Secret: "bgp-password", Scope: scope}
+			Expect(passwords.sourceName("rack1", ip)).To(Equal(expected))
+		},
+		Entry("one Secret for all peers", PasswordScopeGlobal, "10.0.0.1", "bgp-password"),
+		Entry("a Secret per rack", PasswordScopeRack, "10.0.0.1", "bgp-password-rack1"),
+		Entry("a Secret per peer", PasswordScopePeer, "10.0.0.1", "bgp-password-rack1-10.0.0.1"),
+		Entry("a Secret per IPv6 peer", PasswordScopePeer, "2001:db8::1", "bgp-password-rack1-2001-db8--1"),
+	)
+
+	It("requires read access in the operator namespace and write access in the calico-node namespace", func() {
+		access := PasswordConfig{Namespace: "calico-system"}.RequiredAccess("operator")
+		Expect(access).To(ContainElements(
+			authorizationv1.ResourceAttributes{Namespace: "operator", Verb: "watch", Resource: "secrets"},
+			authorizationv1.ResourceAttributes{Namespace: "calico-system", Verb: "create", Resource: "secrets"},
+			authorizationv1.ResourceAttributes{Namespace: "calico-system", Verb: "patch", Group: rbacv1.GroupName, Resource: "roles"},
+			authorizationv1.ResourceAttributes{Namespace: "calico-system", Verb: "patch", Group: rbacv1.GroupName, Resource: "rolebindings"},
+		))
+		Expect(access).NotTo(ContainElement(HaveField("Namespace", Not(BeElementOf("operator", "calico-system")))))
+		Expect(access).NotTo(ContainElement(SatisfyAll(HaveField("Namespace", "operator"), HaveField("Verb", "create"))))
+	})
+})
+
+var _ = Describe("BGP password copies", func() {
+
+	var reconciler *CalicoBgpReconciler
+
+	sourceKey := types.NamespacedName{Namespace: "cni-nanny", Name: "bgp-password"}
+
+	BeforeEach(func() {
+		namespace := config.Cfg.Namespace
+		config.Cfg.Namespace = sourceKey.Namespace
+		DeferCleanup(func() { config.Cfg.Namespace = namespace })
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v3.AddToScheme(scheme)).To(Succeed())
+		source := &corev1.Secret{Data: map[string][]byte{"password": []byte("secret-1")}}
+		source.Name = sourceKey.Name
+		source.Namespace = sourceKey.Namespace
+		reconciler = &CalicoBgpReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(source).Build(),
+			Scheme: scheme,
+			Passwords: PasswordConfig{
+				Secret:         "bgp-password",
+				Key:            "password",
+				Scope:          PasswordScopeGlobal,
+				Namespace:      "kube-system",
+				ServiceAccount: "calico-node",
+			},
+		}
+	})
+
+	resourceVersion := func(ctx SpecContext) string {
+		source := &corev1.Secret{}
+		Expect(reconciler.Get(ctx, sourceKey, source)).To(Succeed())
+		return source.ResourceVersion
+	}
+
+	rotate := func(ctx SpecContext, password string) {
+		source := &corev1.Secret{}
+		Expect(reconciler.Get(ctx, sourceKey, source)).To(Succeed())
+		source.Data["password"] = []byte(password)
+		Expect(reconciler.Update(ctx, source)).To(Succeed())
+	}
+
+	copyNames := func(ctx SpecContext) []string {
+		copies, err := reconciler.passwordCopies(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		for _, passwordCopy := range copies {
+			names = append(names, passwordCopy.Name)
+		}
+		return names
+	}
+
+	roleNames := func(ctx SpecContext) []string {
+		role := &rbacv1.Role{}
+		Expect(reconciler.Get(ctx, types.NamespacedName{Namespace: "kube-system", Name: passwordRoleName}, role)).To(Succeed())
+		if len(role.Rules) == 0 {
+			return nil
+		}
+		Expect(role.Rules).To(HaveLen(1))
+		Expect(role.Rules[0].Resources).To(Equal([]string{"secrets"}))
+		return role.Rules[0].ResourceNames
+	}
+
+	reference := func(ctx SpecContext, name string) {
+		peer := &v3.BGPPeer{}
+		peer.Name = "rack1-10.0.0.1"
+		peer.Spec.Password = &v3.BGPPassword{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			Key:                  "password",
+		}}
+		Expect(reconciler.Create(ctx, peer)).To(Succeed())
+	}
+
+	It("copies the password named by the resource version and grants calico-node access to the copy", func(ctx SpecContext) {
+		copyName := "bgp-password-" + resourceVersion(ctx)
+		password, err := reconciler.peerPassword(ctx, "rack1", "10.0.0.1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password.SecretKeyRef.Name).To(Equal(copyName))
+		Expect(password.SecretKeyRef.Key).To(Equal("password"))
+
+		passwordCopy := &corev1.Secret{}
+		Expect(reconciler.Get(ctx, types.NamespacedName{Namespace: "kube-system", Name: copyName}, passwordCopy)).To(Succeed())
+		Expect(passwordCopy.Annotations).To(HaveKeyWithValue(bgpv1alpha1.PasswordSource, "bgp-password"))
+		Expect(passwordCopy.Data).To(HaveKeyWithValue("password", []byte("secret-1")))
+		Expect(roleNames(ctx)).To(Equal([]string{copyName}))
+
+		roleBinding := &rbacv1.RoleBinding{}
+		Expect(reconciler.Get(ctx, types.NamespacedName{Namespace: "kube-system", Name: passwordRoleName}, roleBinding)).To(Succeed())
+		Expect(roleBinding.Subjects).To(ConsistOf(HaveField("Name", "calico-node")))
+
+		By("reusing the copy for the next peer")
+		password, err = reconciler.peerPassword(ctx, "rack1", "10.0.0.2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password.SecretKeyRef.Name).To(Equal(copyName))
+		Expect(copyNames(ctx)).To(Equal([]string{copyName}))
+	})
+
+	It("copies a rotated password and keeps the old copy while a BGPPeer references it", func(ctx SpecContext) {
+		oldCopy := "bgp-password-" + resourceVersion(ctx)
+		_, err := reconciler.peerPassword(ctx, "rack1", "10.0.0.1")
+		Expect(err).NotTo(HaveOccurred())
+		reference(ctx, oldCopy)
+
+		rotate(ctx, "secret-2")
+		newCopy := "bgp-password-" + resourceVersion(ctx)
+		Expect(newCopy).NotTo(Equal(oldCopy))
+		password, err := reconciler.peerPassword(ctx, "rack1", "10.0.0.1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password.SecretKeyRef.Name).To(Equal(newCopy))
+		Expect(roleNames(ctx)).To(ConsistOf(oldCopy, newCopy))
+
+		Expect(reconciler.retirePasswords(ctx)).To(Succeed())
+		Expect(copyNames(ctx)).To(ConsistOf(oldCopy, newCopy))
+		Expect(roleNames(ctx)).To(ConsistOf(oldCopy, newCopy))
+
+		By("deleting the old copy once the BGPPeer moved on")
+		Expect(reconciler.DeleteAllOf(ctx, &v3.BGPPeer{})).To(Succeed())
+		Expect(reconciler.retirePasswords(ctx)).To(Succeed())
+		Expect(copyNames(ctx)).To(Equal([]string{newCopy}))
+		Expect(roleNames(ctx)).To(Equal([]string{newCopy}))
+	})
+
+	It("deletes the copies of a deleted Secret and leaves the Role without rules", func(ctx SpecContext) {
+		_, err := reconciler.peerPassword(ctx, "rack1", "10.0.0.1")
+		Expect(err).NotTo(HaveOccurred())
+		source := &corev1.Secret{}
+		source.Name = sourceKey.Name
+		source.Namespace = sourceKey.Namespace
+		Expect(reconciler.Delete(ctx, source)).To(Succeed())
+
+		Expect(reconciler.retirePasswords(ctx)).To(Succeed())
+		Expect(copyNames(ctx)).To(BeEmpty())
+		Expect(roleNames(ctx)).To(BeNil())
+	})
+
+	It("fails if the Secret has no password key", func(ctx SpecContext) {
+		reconciler.Passwords.Key = "other"
+		_, err := reconciler.peerPassword(ctx, "rack1", "10.0.0.1")
+		Expect(err).To(MatchError(ContainSubstring("has no key other")))
+		Expect(copyNames(ctx)).To(BeEmpty())
+	})
+})
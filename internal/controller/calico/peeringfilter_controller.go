@@ -0,0 +1,287 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/clients"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+const (
+	filterComponent = "BgpFilter"
+	// defaultBgpConfiguration is the cluster-wide Calico BGPConfiguration holding the service LoadBalancer CIDRs
+	defaultBgpConfiguration = "default"
+)
+
+// errFilterMissing is returned for BGPPeers referencing a BGPFilter that does not exist
+var errFilterMissing = errors.New("BGPFilter not found")
+
+// PeeringFilterReconciler renders PeeringFilters into Calico BGPFilters
+type PeeringFilterReconciler struct {
+	client.Client
+	// APIReader reads around the cache, status patches refetch through it on conflicts
+	APIReader client.Reader
+	Scheme    *runtime.Scheme
+	Recorder  record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=bgp.cninanny.sap.cc,resources=peeringfilters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=bgp.cninanny.sap.cc,resources=peeringfilters/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=projectcalico.org,resources=bgpfilters,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=projectcalico.org,resources=ippools;bgpconfigurations,verbs=get;list;watch
+
+// Reconcile renders a PeeringFilter into the Calico BGPFilter of the same name and deletes the BGPFilter with it
+func (r *PeeringFilterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.Namespace != config.Cfg.Namespace {
+		return ctrl.Result{}, nil
+	}
+	filter := &bgpv1alpha1.PeeringFilter{}
+	err := r.Get(ctx, req.NamespacedName, filter)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			err = r.deleteBgpFilter(ctx, req.Name)
+			if err != nil {
+				log.FromContext(ctx).Error(err, "error deleting calico filter")
+			}
+			return ctrl.Result{}, err
+		}
+		log.FromContext(ctx).Error(err, "error getting peeringFilter")
+		return ctrl.Result{}, err
+	}
+	spec, invalid, err := r.renderFilter(ctx, filter.Spec)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error rendering peeringFilter")
+		return ctrl.Result{}, err
+	}
+	if len(invalid) > 0 {
+		// the BGPFilter keeps its previous rules, dropping a CIDR could withdraw or leak routes
+		message := "invalid CIDRs: " + strings.Join(invalid, ", ")
+		log.FromContext(ctx).Error(errors.New(message), "skipping peeringFilter")
+		r.Recorder.Event(filter, corev1.EventTypeWarning, bgpv1alpha1.ReasonInvalidCIDRs, message)
+		return ctrl.Result{}, r.setFilterApplied(ctx, filter, metav1.ConditionFalse, bgpv1alpha1.ReasonInvalidCIDRs, message)
+	}
+
+	bgpFilter := &v3.BGPFilter{}
+	err = r.Get(ctx, types.NamespacedName{Name: filter.Name}, bgpFilter)
+	if err == nil && !isManaged(bgpFilter) {
+		// an existing filter of the same name is left alone, BGPPeers referencing it keep working
+		message := fmt.Sprintf("BGPFilter %s is not managed by %s", filter.Name, config.KubeApp)
+		log.FromContext(ctx).Error(errors.New(message), "skipping peeringFilter")
+		return ctrl.Result{}, r.setFilterApplied(ctx, filter, metav1.ConditionFalse, bgpv1alpha1.ReasonFilterNotManaged, message)
+	}
+	if client.IgnoreNotFound(err) != nil {
+		log.FromContext(ctx).Error(err, "error getting calico filter")
+		return ctrl.Result{}, err
+	}
+	bgpFilter.Name = filter.Name
+	result, err := controllerutil.CreateOrPatch(ctx, r.Client, bgpFilter, func() error {
+		if bgpFilter.Labels == nil {
+			bgpFilter.Labels = map[string]string{}
+		}
+		bgpFilter.Labels[config.KubeLabelComponent] = filterComponent
+		bgpFilter.Labels[config.KubeLabelManaged] = config.KubeApp
+		bgpFilter.Spec = spec
+		return nil
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error applying calico filter", "filter", filter.Name)
+		return ctrl.Result{}, err
+	}
+	if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("calico filter reconciled", "filter", filter.Name, "operation", result)
+	}
+	return ctrl.Result{}, r.setFilterApplied(ctx, filter, metav1.ConditionTrue, bgpv1alpha1.ReasonFilterApplied, "BGPFilter "+filter.Name+" applied")
+}
+
+// setFilterApplied sets the FilterApplied condition of a PeeringFilter
+func (r *PeeringFilterReconciler) setFilterApplied(ctx context.Context, filter *bgpv1alpha1.PeeringFilter, status metav1.ConditionStatus, reason, message string) error {
+	if meta.IsStatusConditionPresentAndEqual(filter.Status.Conditions, bgpv1alpha1.ConditionFilterApplied, status) {
+		condition := meta.FindStatusCondition(filter.Status.Conditions, bgpv1alpha1.ConditionFilterApplied)
+		if condition.Reason == reason && condition.Message == message && condition.ObservedGeneration == filter.Generation {
+			return nil
+		}
+	}
+	_, err := clients.PatchStatus(ctx, r.Client, r.APIReader, filter, func(filter *bgpv1alpha1.PeeringFilter) {
+		meta.SetStatusCondition(&filter.Status.Conditions, metav1.Condition{
+			Type:               bgpv1alpha1.ConditionFilterApplied,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: filter.Generation,
+		})
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error updating peeringFilter status")
+	}
+	return err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PeeringFilterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("calico filter controller").
+		For(&bgpv1alpha1.PeeringFilter{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&v3.BGPFilter{}, handler.EnqueueRequestsFromMapFunc(peeringFilterForBgpFilter),
+			builder.WithPredicates(predicate.NewPredicateFuncs(isManaged))).
+		Watches(&v3.IPPool{}, handler.EnqueueRequestsFromMapFunc(r.allPeeringFilters)).
+		Watches(&v3.BGPConfiguration{}, handler.EnqueueRequestsFromMapFunc(r.allPeeringFilters)).
+		Complete(r)
+}
+
+// renderFilter renders the rules of a Calico BGPFilter from a PeeringFilter, it also returns the CIDRs that could not be parsed
+func (r *PeeringFilterReconciler) renderFilter(ctx context.Context, spec bgpv1alpha1.PeeringFilterSpec) (v3.BGPFilterSpec, []string, error) {
+	var podCIDRs, loadBalancerCIDRs []string
+	if spec.Import.PodCIDRs || spec.Export.PodCIDRs {
+		pools := &v3.IPPoolList{}
+		err := r.List(ctx, pools)
+		if err != nil {
+			return v3.BGPFilterSpec{}, nil, err
+		}
+		for _, pool := range pools.Items {
+			if !pool.Spec.Disabled {
+				podCIDRs = append(podCIDRs, pool.Spec.CIDR)
+			}
+		}
+	}
+	if spec.Import.LoadBalancerIPs || spec.Export.LoadBalancerIPs {
+		bgpConfiguration := &v3.BGPConfiguration{}
+		err := r.Get(ctx, types.NamespacedName{Name: defaultBgpConfiguration}, bgpConfiguration)
+		if client.IgnoreNotFound(err) != nil {
+			return v3.BGPFilterSpec{}, nil, err
+		}
+		for _, block := range bgpConfiguration.Spec.ServiceLoadBalancerIPs {
+			loadBalancerCIDRs = append(loadBalancerCIDRs, block.CIDR)
+		}
+	}
+	filterSpec := v3.BGPFilterSpec{}
+	var invalidImport, invalidExport []string
+	filterSpec.ImportV4, filterSpec.ImportV6, invalidImport = selectionRules(spec.Import, podCIDRs, loadBalancerCIDRs)
+	filterSpec.ExportV4, filterSpec.ExportV6, invalidExport = selectionRules(spec.Export, podCIDRs, loadBalancerCIDRs)
+	invalid := append(invalidImport, invalidExport...)
+	slices.Sort(invalid)
+	return filterSpec, slices.Compact(invalid), nil
+}
+
+// selectionRules renders a route selection into rules accepting the selected prefixes followed by a rule rejecting all others,
+// CIDRs that cannot be parsed are left out and returned
+func selectionRules(selection bgpv1alpha1.RouteSelection, podCIDRs, loadBalancerCIDRs []string) ([]v3.BGPFilterRuleV4, []v3.BGPFilterRuleV6, []string) {
+	if selection.Empty() {
+		return nil, nil, nil
+	}
+	var rulesV4 []v3.BGPFilterRuleV4
+	var rulesV6 []v3.BGPFilterRuleV6
+	var invalid []string
+	accept := func(cidr string, operator v3.BGPFilterMatchOperator) {
+		ip, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			invalid = append(invalid, cidr)
+			return
+		}
+		if ip.To4() != nil {
+			rulesV4 = append(rulesV4, v3.BGPFilterRuleV4{CIDR: ipNet.String(), MatchOperator: operator, Action: v3.Accept})
+		} else {
+			rulesV6 = append(rulesV6, v3.BGPFilterRuleV6{CIDR: ipNet.String(), MatchOperator: operator, Action: v3.Accept})
+		}
+	}
+	if selection.DefaultRoute {
+		accept("0.0.0.0/0", v3.MatchOperatorEqual)
+		accept("::/0", v3.MatchOperatorEqual)
+	}
+	cidrs := slices.Clone(selection.CIDRs)
+	if selection.PodCIDRs {
+		cidrs = append(cidrs, podCIDRs...)
+	}
+	if selection.LoadBalancerIPs {
+		cidrs = append(cidrs, loadBalancerCIDRs...)
+	}
+	for _, cidr := range cidrs {
+		accept(cidr, v3.MatchOperatorIn)
+	}
+	rulesV4 = append(rulesV4, v3.BGPFilterRuleV4{Action: v3.Reject})
+	rulesV6 = append(rulesV6, v3.BGPFilterRuleV6{Action: v3.Reject})
+	return rulesV4, rulesV6, invalid
+}
+
+// deleteBgpFilter deletes the Calico BGPFilter of a deleted PeeringFilter if it is managed by cni-nanny
+func (r *PeeringFilterReconciler) deleteBgpFilter(ctx context.Context, name string) error {
+	bgpFilter := &v3.BGPFilter{}
+	err := r.Get(ctx, types.NamespacedName{Name: name}, bgpFilter)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !isManaged(bgpFilter) {
+		return nil
+	}
+	log.FromContext(ctx).Info("deleting calico filter of deleted peeringFilter", "filter", name)
+	return client.IgnoreNotFound(r.Delete(ctx, bgpFilter))
+}
+
+// allPeeringFilters enqueues all PeeringFilters, their rules may depend on the changed IPPools or BGPConfiguration
+func (r *PeeringFilterReconciler) allPeeringFilters(ctx context.Context, _ client.Object) []reconcile.Request {
+	filters := &bgpv1alpha1.PeeringFilterList{}
+	if err := r.List(ctx, filters, client.InNamespace(config.Cfg.Namespace)); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(filters.Items))
+	for _, filter := range filters.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&filter)})
+	}
+	return requests
+}
+
+// peeringFilterForBgpFilter enqueues the PeeringFilter of a managed BGPFilter, so changed and deleted filters are restored
+func peeringFilterForBgpFilter(_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: config.Cfg.Namespace, Name: obj.GetName()}}}
+}
+
+// checkFilters verifies that the BGPFilters referenced by a BGPPeer exist, calico-node does not report missing ones
+func (r *CalicoBgpReconciler) checkFilters(ctx context.Context, filters []string) error {
+	for _, name := range filters {
+		err := r.Get(ctx, types.NamespacedName{Name: name}, &v3.BGPFilter{})
+		if k8serrors.IsNotFound(err) {
+			return fmt.Errorf("%w: %s", errFilterMissing, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
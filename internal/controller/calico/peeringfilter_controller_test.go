@@ -0,0 +1,149 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+var _ = Describe("PeeringFilterReconciler", func() {
+
+	var (
+		reconciler *PeeringFilterReconciler
+		recorder   *record.FakeRecorder
+		filter     *bgpv1alpha1.PeeringFilter
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(v3.AddToScheme(scheme)).To(Succeed())
+		Expect(bgpv1alpha1.AddToScheme(scheme)).To(Succeed())
+		filter = &bgpv1alpha1.PeeringFilter{}
+		filter.Name = "export"
+		filter.Namespace = config.Cfg.Namespace
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(filter).
+			WithStatusSubresource(filter).
+			Build()
+		recorder = record.NewFakeRecorder(10)
+		reconciler = &PeeringFilterReconciler{Client: c, APIReader: c, Scheme: scheme, Recorder: recorder}
+	})
+
+	reconcile := func(ctx SpecContext, cidrs ...string) *metav1.Condition {
+		latest := &bgpv1alpha1.PeeringFilter{}
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(filter), latest)).To(Succeed())
+		latest.Spec.Export.CIDRs = cidrs
+		Expect(reconciler.Update(ctx, latest)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(filter)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(filter), latest)).To(Succeed())
+		return meta.FindStatusCondition(latest.Status.Conditions, bgpv1alpha1.ConditionFilterApplied)
+	}
+
+	It("applies a valid filter", func(ctx SpecContext) {
+		condition := reconcile(ctx, "10.0.0.0/8")
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+
+		bgpFilter := &v3.BGPFilter{}
+		Expect(reconciler.Get(ctx, client.ObjectKey{Name: filter.Name}, bgpFilter)).To(Succeed())
+		Expect(bgpFilter.Spec.ExportV4).To(HaveLen(2))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("reports invalid CIDRs and keeps the previous rules", func(ctx SpecContext) {
+		reconcile(ctx, "10.0.0.0/8")
+		condition := reconcile(ctx, "10.0.0.0/8", "10.0.0.300/32", "fd00::/ab")
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(bgpv1alpha1.ReasonInvalidCIDRs))
+		Expect(condition.Message).To(Equal("invalid CIDRs: 10.0.0.300/32, fd00::/ab"))
+		Expect(recorder.Events).To(Receive(Equal("Warning InvalidCIDRs invalid CIDRs: 10.0.0.300/32, fd00::/ab")))
+
+		bgpFilter := &v3.BGPFilter{}
+		Expect(reconciler.Get(ctx, client.ObjectKey{Name: filter.Name}, bgpFilter)).To(Succeed())
+		Expect(bgpFilter.Spec.ExportV4).To(Equal([]v3.BGPFilterRuleV4{
+			{CIDR: "10.0.0.0/8", MatchOperator: v3.MatchOperatorIn, Action: v3.Accept},
+			{Action: v3.Reject},
+		}))
+	})
+
+})
+
+var _ = Describe("selectionRules", func() {
+
+	podCIDRs := []string{"10.100.0.0/16", "fd00:100::/48"}
+	loadBalancerCIDRs := []string{"10.200.0.0/24"}
+
+	It("renders no rules for an empty selection", func() {
+		rulesV4, rulesV6, invalid := selectionRules(bgpv1alpha1.RouteSelection{}, podCIDRs, loadBalancerCIDRs)
+		Expect(rulesV4).To(BeNil())
+		Expect(rulesV6).To(BeNil())
+		Expect(invalid).To(BeNil())
+	})
+
+	It("accepts the selected prefixes by family and rejects all others", func() {
+		selection := bgpv1alpha1.RouteSelection{
+			DefaultRoute:    true,
+			PodCIDRs:        true,
+			LoadBalancerIPs: true,
+			CIDRs:           []string{"192.168.1.7/24", "fd00:200::/64"},
+		}
+		rulesV4, rulesV6, invalid := selectionRules(selection, podCIDRs, loadBalancerCIDRs)
+		Expect(invalid).To(BeEmpty())
+		Expect(rulesV4).To(Equal([]v3.BGPFilterRuleV4{
+			{CIDR: "0.0.0.0/0", MatchOperator: v3.MatchOperatorEqual, Action: v3.Accept},
+			{CIDR: "192.168.1.0/24", MatchOperator: v3.MatchOperatorIn, Action: v3.Accept},
+			{CIDR: "10.100.0.0/16", MatchOperator: v3.MatchOperatorIn, Action: v3.Accept},
+			{CIDR: "10.200.0.0/24", MatchOperator: v3.MatchOperatorIn, Action: v3.Accept},
+			{Action: v3.Reject},
+		}))
+		Expect(rulesV6).To(Equal([]v3.BGPFilterRuleV6{
+			{CIDR: "::/0", MatchOperator: v3.MatchOperatorEqual, Action: v3.Accept},
+			{CIDR: "fd00:200::/64", MatchOperator: v3.MatchOperatorIn, Action: v3.Accept},
+			{CIDR: "fd00:100::/48", MatchOperator: v3.MatchOperatorIn, Action: v3.Accept},
+			{Action: v3.Reject},
+		}))
+	})
+
+	It("leaves out pod and load balancer CIDRs that are not selected", func() {
+		rulesV4, rulesV6, _ := selectionRules(bgpv1alpha1.RouteSelection{CIDRs: []string{"10.0.0.0/8"}}, podCIDRs, loadBalancerCIDRs)
+		Expect(rulesV4).To(Equal([]v3.BGPFilterRuleV4{
+			{CIDR: "10.0.0.0/8", MatchOperator: v3.MatchOperatorIn, Action: v3.Accept},
+			{Action: v3.Reject},
+		}))
+		Expect(rulesV6).To(Equal([]v3.BGPFilterRuleV6{{Action: v3.Reject}}))
+	})
+
+	It("returns the invalid CIDRs", func() {
+		rulesV4, _, invalid := selectionRules(bgpv1alpha1.RouteSelection{CIDRs: []string{"10.0.0.0/8", "10.0.0.1", "fd00::/129"}}, nil, nil)
+		Expect(invalid).To(Equal([]string{"10.0.0.1", "fd00::/129"}))
+		Expect(rulesV4).To(HaveLen(2))
+	})
+
+})
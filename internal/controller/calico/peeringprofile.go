@@ -0,0 +1,124 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package calico
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	"github.com/projectcalico/api/pkg/lib/numorstring"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+// peeringProfile returns the PeeringProfile selecting a topology value, or nil if none does
+func (r *CalicoBgpReconciler) peeringProfile(ctx context.Context, topologyValue string) (*bgpv1alpha1.PeeringProfile, error) {
+	profiles := &bgpv1alpha1.PeeringProfileList{}
+	err := r.List(ctx, profiles, client.InNamespace(config.Cfg.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	if len(profiles.Items) == 0 {
+		return nil, nil
+	}
+	nodes := &corev1.NodeList{}
+	err = r.List(ctx, nodes, client.MatchingLabels{config.Cfg.NodeTopologyLabel: topologyValue})
+	if err != nil {
+		return nil, err
+	}
+	return selectProfile(profiles.Items, topologyValue, nodes.Items)
+}
+
+// selectProfile picks the profile for a rack. Profiles listing the topology value win over
+// profiles matching a node of the rack by selector, ties are broken by name.
+func selectProfile(profiles []bgpv1alpha1.PeeringProfile, topologyValue string, nodes []corev1.Node) (*bgpv1alpha1.PeeringProfile, error) {
+	var byValue, bySelector []*bgpv1alpha1.PeeringProfile
+	for i := range profiles {
+		profile := &profiles[i]
+		if slices.Contains(profile.Spec.TopologyValues, topologyValue) {
+			byValue = append(byValue, profile)
+			continue
+		}
+		if profile.Spec.NodeSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(profile.Spec.NodeSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node selector of peering profile %s: %w", profile.Name, err)
+		}
+		if selector.Empty() {
+			continue
+		}
+		for _, node := range nodes {
+			if selector.Matches(labels.Set(node.Labels)) {
+				bySelector = append(bySelector, profile)
+				break
+			}
+		}
+	}
+	for _, matches := range [][]*bgpv1alpha1.PeeringProfile{byValue, bySelector} {
+		if len(matches) > 0 {
+			return slices.MinFunc(matches, func(a, b *bgpv1alpha1.PeeringProfile) int {
+				return strings.Compare(a.Name, b.Name)
+			}), nil
+		}
+	}
+	return nil, nil
+}
+
+// applyTemplate sets the fields of a profile template on a BGPPeer spec, unset fields keep the global defaults
+func applyTemplate(spec *v3.BGPPeerSpec, template bgpv1alpha1.BGPPeerTemplate) error {
+	if template.ASNumber != nil {
+		asNumber, err := int64ToUint32(*template.ASNumber)
+		if err != nil {
+			return err
+		}
+		spec.ASNumber = numorstring.ASNumber(asNumber)
+	}
+	if len(template.Filters) > 0 {
+		spec.Filters = template.Filters
+	}
+	spec.KeepOriginalNextHop = template.KeepOriginalNextHop
+	spec.MaxRestartTime = template.MaxRestartTime
+	if template.TTLSecurity != nil {
+		if *template.TTLSecurity < 0 || *template.TTLSecurity > 255 {
+			return fmt.Errorf("ttl security %d out of range", *template.TTLSecurity)
+		}
+		ttl := uint8(*template.TTLSecurity)
+		spec.TTLSecurity = &ttl
+	}
+	if hasPassword(template) {
+		spec.Password = &v3.BGPPassword{SecretKeyRef: template.Password.SecretKeyRef.DeepCopy()}
+	}
+	spec.NumAllowedLocalASNumbers = template.NumAllowedLocalASNumbers
+	spec.ReachableBy = template.ReachableBy
+	return nil
+}
+
+// hasPassword reports whether a profile template sets the password of its BGPPeers
+func hasPassword(template bgpv1alpha1.BGPPeerTemplate) bool {
+	return template.Password != nil && template.Password.SecretKeyRef != nil
+}
+
+// allBgpPeerDiscoveries enqueues all racks, any of them may be affected by a changed profile, filter or password Secret
+func (r *CalicoBgpReconciler) allBgpPeerDiscoveries(ctx context.Context, _ client.Object) []reconcile.Request {
+	bgpPeerDiscoveries := &bgpv1alpha1.BgpPeerDiscoveryList{}
+	if err := r.List(ctx, bgpPeerDiscoveries, client.InNamespace(config.Cfg.Namespace)); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(bgpPeerDiscoveries.Items))
+	for _, bgpPeerDiscovery := range bgpPeerDiscoveries.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&bgpPeerDiscovery)})
+	}
+	return requests
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	"github.com/projectcalico/api/pkg/lib/numorstring"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+)
+
+var _ = Describe("Peering profiles", func() {
+
+	profile := func(name string, topologyValues []string, matchLabels map[string]string) bgpv1alpha1.PeeringProfile {
+		profile := bgpv1alpha1.PeeringProfile{}
+		profile.Name = name
+		profile.Spec.TopologyValues = topologyValues
+		if matchLabels != nil {
+			profile.Spec.NodeSelector = &metav1.LabelSelector{MatchLabels: matchLabels}
+		}
+		return profile
+	}
+
+	node := func(labels map[string]string) corev1.Node {
+		node := corev1.Node{}
+		node.Name = "node-a"
+		node.Labels = labels
+		return node
+	}
+
+	DescribeTable("selectProfile",
+		func(profiles []bgpv1alpha1.PeeringProfile, labels map[string]string, expected string) {
+			selected, err := selectProfile(profiles, "rack1", []corev1.Node{node(labels)})
+			Expect(err).ToNot(HaveOccurred())
+			if expected == "" {
+				Expect(selected).To(BeNil())
+				return
+			}
+			Expect(selected).NotTo(BeNil())
+			Expect(selected.Name).To(Equal(expected))
+		},
+		Entry("no profiles", nil, nil, ""),
+		Entry("neither value nor selector match",
+			[]bgpv1alpha1.PeeringProfile{profile("a", []string{"rack2"}, map[string]string{"pod": "b"})},
+			map[string]string{"pod": "a"}, ""),
+		Entry("topology value",
+			[]bgpv1alpha1.PeeringProfile{profile("a", []string{"rack2", "rack1"}, nil)}, nil, "a"),
+		Entry("node selector",
+			[]bgpv1alpha1.PeeringProfile{profile("a", nil, map[string]string{"pod": "a"})},
+			map[string]string{"pod": "a"}, "a"),
+		Entry("an empty selector matches nothing",
+			[]bgpv1alpha1.PeeringProfile{profile("a", nil, map[string]string{})}, map[string]string{"pod": "a"}, ""),
+		Entry("topology value wins over an earlier selector match",
+			[]bgpv1alpha1.PeeringProfile{
+				profile("a-selector", nil, map[string]string{"pod": "a"}),
+				profile("z-value", []string{"rack1"}, nil),
+			},
+			map[string]string{"pod": "a"}, "z-value"),
+		Entry("topology value ties are broken by name",
+			[]bgpv1alpha1.PeeringProfile{
+				profile("c", []string{"rack1"}, nil),
+				profile("b", []string{"rack1"}, nil),
+				profile("a", nil, map[string]string{"pod": "a"}),
+			},
+			map[string]string{"pod": "a"}, "b"),
+		Entry("selector ties are broken by name",
+			[]bgpv1alpha1.PeeringProfile{
+				profile("d", nil, map[string]string{"pod": "a"}),
+				profile("c", nil, map[string]string{"row": "1"}),
+			},
+			map[string]string{"pod": "a", "row": "1"}, "c"),
+	)
+
+	It("rejects an invalid node selector", func() {
+		invalid := profile("a", nil, nil)
+		invalid.Spec.NodeSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "pod", Operator: "Bogus"}}}
+		_, err := selectProfile([]bgpv1alpha1.PeeringProfile{invalid}, "rack1", []corev1.Node{node(nil)})
+		Expect(err).To(MatchError(ContainSubstring("invalid node selector of peering profile a")))
+	})
+
+	defaults := func() v3.BGPPeerSpec {
+		return v3.BGPPeerSpec{
+			PeerIP:        "10.0.0.1",
+			ASNumber:      numorstring.ASNumber(65000),
+			Filters:       []string{"global"},
+			SourceAddress: v3.SourceAddressUseNodeIP,
+		}
+	}
+
+	DescribeTable("applyTemplate",
+		func(template bgpv1alpha1.BGPPeerTemplate, expected func(*v3.BGPPeerSpec)) {
+			spec := defaults()
+			Expect(applyTemplate(&spec, template)).To(Succeed())
+			want := defaults()
+			expected(&want)
+			Expect(spec).To(Equal(want))
+		},
+		Entry("an empty template keeps the flag defaults", bgpv1alpha1.BGPPeerTemplate{}, func(*v3.BGPPeerSpec) {}),
+		Entry("the AS number overrides --bgp-remote-as",
+			bgpv1alpha1.BGPPeerTemplate{ASNumber: int64Value(65100)},
+			func(spec *v3.BGPPeerSpec) { spec.ASNumber = numorstring.ASNumber(65100) }),
+		Entry("filters override --bgp-filters",
+			bgpv1alpha1.BGPPeerTemplate{Filters: []string{"rack"}},
+			func(spec *v3.BGPPeerSpec) { spec.Filters = []string{"rack"} }),
+		Entry("session settings are set",
+			bgpv1alpha1.BGPPeerTemplate{
+				KeepOriginalNextHop:      true,
+				MaxRestartTime:           &metav1.Duration{Duration: 2 * time.Minute},
+				TTLSecurity:              int32Value(1),
+				NumAllowedLocalASNumbers: int32Value(2),
+				ReachableBy:              "10.0.0.254",
+			},
+			func(spec *v3.BGPPeerSpec) {
+				spec.KeepOriginalNextHop = true
+				spec.MaxRestartTime = &metav1.Duration{Duration: 2 * time.Minute}
+				ttl := uint8(1)
+				spec.TTLSecurity = &ttl
+				spec.NumAllowedLocalASNumbers = int32Value(2)
+				spec.ReachableBy = "10.0.0.254"
+			}),
+		Entry("the password overrides --bgp-password-secret",
+			bgpv1alpha1.BGPPeerTemplate{Password: &bgpv1alpha1.BGPPassword{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "rack-password"}, Key: "password"}}},
+			func(spec *v3.BGPPeerSpec) {
+				spec.Password = &v3.BGPPassword{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "rack-password"}, Key: "password"}}
+			}),
+	)
+
+	DescribeTable("applyTemplate rejects out of range values",
+		func(template bgpv1alpha1.BGPPeerTemplate) {
+			spec := defaults()
+			Expect(applyTemplate(&spec, template)).NotTo(Succeed())
+		},
+		Entry("AS number", bgpv1alpha1.BGPPeerTemplate{ASNumber: int64Value(4294967296)}),
+		Entry("ttl security", bgpv1alpha1.BGPPeerTemplate{TTLSecurity: int32Value(256)}),
+	)
+})
+
+func int64Value(value int64) *int64 {
+	return &value
+}
+
+func int32Value(value int32) *int32 {
+	return &value
+}
@@ -0,0 +1,49 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package calico
+
+import (
+	"slices"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+)
+
+// peerResult collects the outcome of applying the peers of a rack
+type peerResult struct {
+	profile   *bgpv1alpha1.PeeringProfile
+	effective []bgpv1alpha1.EffectivePeer
+	skipped   []string
+	excluded  []string
+	rollout   *rolloutState
+	stale     *staleState
+	sessions  []bgpv1alpha1.PeerSession
+	// exceptions are the nodes with node-specific BGPPeers
+	exceptions []bgpv1alpha1.NodeException
+}
+
+// mergePeers merges the discovered peers of a rack with its static and excluded peers.
+// Excluded peers are dropped from the discovered ones, static peers are always kept.
+func mergePeers(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) (peers []bgpv1alpha1.DiscoveredPeer, origins map[string]bgpv1alpha1.PeerOrigin, excluded []string) {
+	spec := bgpPeerDiscovery.Spec
+	origins = map[string]bgpv1alpha1.PeerOrigin{}
+	for _, peer := range bgpPeerDiscovery.Status.PeerList() {
+		origin := bgpv1alpha1.PeerOriginDiscovered
+		if slices.Contains(spec.StaticPeers, peer.IP) {
+			origin = bgpv1alpha1.PeerOriginStatic
+		} else if spec.Excludes(peer.IP) {
+			excluded = append(excluded, peer.IP)
+			continue
+		}
+		origins[peer.IP] = origin
+		peers = append(peers, peer)
+	}
+	for _, ip := range spec.StaticPeers {
+		if _, ok := origins[ip]; ok {
+			continue
+		}
+		origins[ip] = bgpv1alpha1.PeerOriginStatic
+		peers = append(peers, bgpv1alpha1.DiscoveredPeer{IP: ip, AddressFamily: bgpv1alpha1.AddressFamilyOf(ip)})
+	}
+	return peers, origins, excluded
+}
@@ -0,0 +1,328 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+const (
+	rackPoolComponent = "IPPool"
+	// rackPoolPrefix is the name prefix of the IPPools of racks
+	rackPoolPrefix = "rack-"
+	// defaultBlockSizeV4 and defaultBlockSizeV6 are Calico's default IPAM block sizes
+	defaultBlockSizeV4 = 26
+	defaultBlockSizeV6 = 122
+)
+
+// errPoolCIDRExhausted is returned if the parent CIDR has no free subnet left for a rack
+var errPoolCIDRExhausted = errors.New("rack IPPool CIDR exhausted")
+
+// RackIPPoolReconciler gives every rack of the LabelDiscovery its own Calico IPPool carved from a parent CIDR
+type RackIPPoolReconciler struct {
+	client.Client
+	Scheme            *runtime.Scheme
+	NodeTopologyLabel string
+	// ParentCIDR is the CIDR the rack IPPools are allocated from
+	ParentCIDR netip.Prefix
+	// PrefixLength is the prefix length of the IPPool of a rack
+	PrefixLength int
+	// RetireGracePeriod is the time the disabled IPPool of an empty rack is kept before it is deleted
+	RetireGracePeriod time.Duration
+}
+
+//+kubebuilder:rbac:groups=projectcalico.org,resources=ippools,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile creates an IPPool for each topology value of the LabelDiscovery that has nodes and retires the IPPools
+// of racks without nodes: they are disabled first and deleted after the grace period, unless nodes return.
+// Without LabelDiscovery nothing is done, the pools of racks that still have nodes are never retired.
+// The IPPools themselves record the allocations, a new rack gets the lowest subnet overlapping no IPPool.
+func (r *RackIPPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.Namespace != config.Cfg.Namespace || req.Name != config.Cfg.DefaultName {
+		return ctrl.Result{}, nil
+	}
+	labelDiscovery := &topologyv1alpha1.LabelDiscovery{}
+	err := r.Get(ctx, req.NamespacedName, labelDiscovery)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.FromContext(ctx).Error(err, "error getting labelDiscovery")
+		return ctrl.Result{}, err
+	}
+	nodes := &corev1.NodeList{}
+	err = r.List(ctx, nodes, client.HasLabels{r.NodeTopologyLabel})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error listing nodes")
+		return ctrl.Result{}, err
+	}
+	populated := map[string]struct{}{}
+	for _, node := range nodes.Items {
+		populated[node.Labels[r.NodeTopologyLabel]] = struct{}{}
+	}
+	pools := &v3.IPPoolList{}
+	err = r.List(ctx, pools)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error listing calico pools")
+		return ctrl.Result{}, err
+	}
+	rackPools := map[string]*v3.IPPool{}
+	for i := range pools.Items {
+		pool := &pools.Items[i]
+		if isManaged(pool) && pool.Labels[topologyv1alpha1.TopologyValue] != "" {
+			rackPools[pool.Labels[topologyv1alpha1.TopologyValue]] = pool
+		}
+	}
+
+	values := make([]string, 0, len(labelDiscovery.Status.DiscoveredTopologyValues))
+	for value := range labelDiscovery.Status.DiscoveredTopologyValues {
+		values = append(values, value)
+	}
+	slices.Sort(values)
+	var res ctrl.Result
+	for _, value := range values {
+		if _, ok := populated[value]; !ok {
+			continue
+		}
+		if pool, ok := rackPools[value]; ok {
+			err = r.activatePool(ctx, value, pool)
+		} else {
+			err = r.createPool(ctx, value, pools)
+		}
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error applying calico pool", "topology value", value)
+			return ctrl.Result{}, err
+		}
+	}
+	for value, pool := range rackPools {
+		if _, ok := populated[value]; ok {
+			continue
+		}
+		requeueAfter, err := r.retirePool(ctx, pool)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error retiring calico pool", "pool", pool.Name)
+			return ctrl.Result{}, err
+		}
+		if requeueAfter > 0 && (res.RequeueAfter == 0 || requeueAfter < res.RequeueAfter) {
+			res.RequeueAfter = requeueAfter
+		}
+	}
+	return res, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RackIPPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("calico rack pool controller").
+		For(&topologyv1alpha1.LabelDiscovery{}).
+		Watches(&v3.IPPool{}, handler.EnqueueRequestsFromMapFunc(defaultLabelDiscovery),
+			builder.WithPredicates(predicate.NewPredicateFuncs(isManaged))).
+		Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(defaultLabelDiscovery),
+			builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Complete(r)
+}
+
+// createPool allocates the lowest free subnet of the parent CIDR to a rack and creates its IPPool
+func (r *RackIPPoolReconciler) createPool(ctx context.Context, topologyValue string, pools *v3.IPPoolList) error {
+	cidr, err := r.freeSubnet(pools.Items)
+	if err != nil {
+		return err
+	}
+	pool := &v3.IPPool{}
+	pool.Name = rackPoolName(topologyValue, pools.Items)
+	pool.Labels = map[string]string{
+		config.KubeLabelComponent:      rackPoolComponent,
+		config.KubeLabelManaged:        config.KubeApp,
+		topologyv1alpha1.TopologyValue: topologyValue,
+	}
+	pool.Spec.CIDR = cidr.String()
+	pool.Spec.NodeSelector = r.nodeSelector(topologyValue)
+	// the Calico CRDs are not defaulted like the objects of the Calico API server
+	pool.Spec.BlockSize = defaultBlockSizeV4
+	if cidr.Addr().Is6() {
+		pool.Spec.BlockSize = defaultBlockSizeV6
+	}
+	pool.Spec.IPIPMode = v3.IPIPModeNever
+	pool.Spec.VXLANMode = v3.VXLANModeNever
+	// pods of the rack need the same encapsulation and egress as the pods of the other racks
+	if template := templatePool(cidr, pools.Items); template != nil {
+		pool.Spec.IPIPMode = template.Spec.IPIPMode
+		pool.Spec.VXLANMode = template.Spec.VXLANMode
+		pool.Spec.NATOutgoing = template.Spec.NATOutgoing
+	}
+	err = r.Create(ctx, pool)
+	if err != nil {
+		return err
+	}
+	// later racks of this reconcile must not get the same subnet
+	pools.Items = append(pools.Items, *pool)
+	log.FromContext(ctx).Info("calico pool created", "pool", pool.Name, "cidr", pool.Spec.CIDR)
+	return nil
+}
+
+// activatePool enables the IPPool of a rack with nodes again and restores its node selector
+func (r *RackIPPoolReconciler) activatePool(ctx context.Context, topologyValue string, pool *v3.IPPool) error {
+	_, retiring := pool.Annotations[bgpv1alpha1.PoolRetiringSince]
+	nodeSelector := r.nodeSelector(topologyValue)
+	if !retiring && !pool.Spec.Disabled && pool.Spec.NodeSelector == nodeSelector {
+		return nil
+	}
+	patch := client.MergeFrom(pool.DeepCopy())
+	delete(pool.Annotations, bgpv1alpha1.PoolRetiringSince)
+	pool.Spec.Disabled = false
+	pool.Spec.NodeSelector = nodeSelector
+	log.FromContext(ctx).Info("activating calico pool", "pool", pool.Name)
+	return r.Patch(ctx, pool, patch)
+}
+
+// retirePool disables the IPPool of an empty rack and deletes it once the grace period passed.
+// It returns the time until the pool is due for deletion.
+func (r *RackIPPoolReconciler) retirePool(ctx context.Context, pool *v3.IPPool) (time.Duration, error) {
+	since, err := time.Parse(time.RFC3339, pool.Annotations[bgpv1alpha1.PoolRetiringSince])
+	if err != nil || !pool.Spec.Disabled {
+		patch := client.MergeFrom(pool.DeepCopy())
+		if pool.Annotations == nil {
+			pool.Annotations = map[string]string{}
+		}
+		if err != nil {
+			since = time.Now().UTC()
+			pool.Annotations[bgpv1alpha1.PoolRetiringSince] = since.Format(time.RFC3339)
+		}
+		pool.Spec.Disabled = true
+		log.FromContext(ctx).Info("disabling calico pool of empty rack", "pool", pool.Name)
+		err = r.Patch(ctx, pool, patch)
+		if err != nil {
+			return 0, err
+		}
+	}
+	remaining := time.Until(since.Add(r.RetireGracePeriod))
+	if remaining > 0 {
+		return remaining, nil
+	}
+	log.FromContext(ctx).Info("deleting calico pool of empty rack", "pool", pool.Name, "cidr", pool.Spec.CIDR)
+	return 0, client.IgnoreNotFound(r.Delete(ctx, pool))
+}
+
+// freeSubnet returns the lowest subnet of the parent CIDR overlapping none of the IPPools
+func (r *RackIPPoolReconciler) freeSubnet(pools []v3.IPPool) (netip.Prefix, error) {
+	var used []netip.Prefix
+	for _, pool := range pools {
+		prefix, err := netip.ParsePrefix(pool.Spec.CIDR)
+		if err == nil {
+			used = append(used, prefix.Masked())
+		}
+	}
+	subnet := netip.PrefixFrom(r.ParentCIDR.Masked().Addr(), r.PrefixLength)
+	for r.ParentCIDR.Contains(subnet.Addr()) {
+		if !slices.ContainsFunc(used, subnet.Overlaps) {
+			return subnet, nil
+		}
+		next, ok := nextSubnet(subnet)
+		if !ok {
+			break
+		}
+		subnet = next
+	}
+	return netip.Prefix{}, fmt.Errorf("%w: %s", errPoolCIDRExhausted, r.ParentCIDR)
+}
+
+// templatePool returns the IPPool the encapsulation and outgoing NAT of a new rack pool are copied from: the first
+// enabled pool of the cluster by name that is not a rack pool and has the address family of the rack's subnet.
+// The parent CIDR is no pool itself, it would overlap the rack pools.
+func templatePool(subnet netip.Prefix, pools []v3.IPPool) *v3.IPPool {
+	var template *v3.IPPool
+	for i := range pools {
+		pool := &pools[i]
+		if isManaged(pool) || pool.Spec.Disabled {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(pool.Spec.CIDR)
+		if err != nil || prefix.Addr().Is4() != subnet.Addr().Is4() {
+			continue
+		}
+		if template == nil || pool.Name < template.Name {
+			template = pool
+		}
+	}
+	return template
+}
+
+// nodeSelector selects the nodes of a rack
+func (r *RackIPPoolReconciler) nodeSelector(topologyValue string) string {
+	return r.NodeTopologyLabel + " == " + fmt.Sprintf("%q", topologyValue)
+}
+
+// nextSubnet returns the subnet of the same size following a subnet, false if the address space ends
+func nextSubnet(subnet netip.Prefix) (netip.Prefix, bool) {
+	addr := subnet.Addr().AsSlice()
+	bit := len(addr)*8 - subnet.Bits()
+	carry := byte(1) << (bit % 8)
+	for i := len(addr) - 1 - bit/8; i >= 0 && carry > 0; i-- {
+		sum := uint16(addr[i]) + uint16(carry)
+		addr[i] = byte(sum)
+		carry = byte(sum >> 8)
+	}
+	if carry > 0 {
+		return netip.Prefix{}, false
+	}
+	next, _ := netip.AddrFromSlice(addr)
+	return netip.PrefixFrom(next, subnet.Bits()), true
+}
+
+// rackPoolName returns the IPPool name of a rack. Topology values may contain characters invalid in names, and the
+// name may be taken by another pool, the value is sanitized and hashed then so no two racks get the same name.
+func rackPoolName(topologyValue string, pools []v3.IPPool) string {
+	name := rackPoolPrefix + topologyValue
+	taken := slices.ContainsFunc(pools, func(pool v3.IPPool) bool {
+		return pool.Name == name
+	})
+	if !taken && len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(topologyValue))
+	sanitized := strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(topologyValue))
+	return rackPoolPrefix + sanitized + "-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// defaultLabelDiscovery enqueues the LabelDiscovery the racks are taken from
+func defaultLabelDiscovery(_ context.Context, _ client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: config.Cfg.Namespace, Name: config.Cfg.DefaultName}}}
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+var _ = Describe("Rack IPPools", func() {
+
+	ipPool := func(name, cidr string) v3.IPPool {
+		pool := v3.IPPool{}
+		pool.Name = name
+		pool.Spec.CIDR = cidr
+		return pool
+	}
+
+	DescribeTable("nextSubnet",
+		func(subnet, expected string) {
+			next, ok := nextSubnet(netip.MustParsePrefix(subnet))
+			if expected == "" {
+				Expect(ok).To(BeFalse())
+				return
+			}
+			Expect(ok).To(BeTrue())
+			Expect(next).To(Equal(netip.MustParsePrefix(expected)))
+		},
+		Entry("IPv4", "10.0.0.0/24", "10.0.1.0/24"),
+		Entry("IPv4 with carry", "10.0.255.0/24", "10.1.0.0/24"),
+		Entry("IPv4 within a byte", "10.0.0.64/26", "10.0.0.128/26"),
+		Entry("IPv4 across bytes", "10.0.0.0/20", "10.0.16.0/20"),
+		Entry("IPv4 end", "255.255.255.0/24", ""),
+		Entry("IPv6", "fd00::/120", "fd00::100/120"),
+		Entry("IPv6 with carry", "fd00:0:0:ffff::/64", "fd00:0:1::/64"),
+		Entry("IPv6 end", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00/120", ""),
+	)
+
+	Describe("freeSubnet", func() {
+
+		reconciler := &RackIPPoolReconciler{ParentCIDR: netip.MustParsePrefix("10.180.0.0/22"), PrefixLength: 24}
+
+		It("returns the first subnet of the parent CIDR", func() {
+			Expect(reconciler.freeSubnet(nil)).To(Equal(netip.MustParsePrefix("10.180.0.0/24")))
+		})
+
+		It("skips subnets overlapping any pool", func() {
+			pools := []v3.IPPool{
+				ipPool("rack-a", "10.180.0.0/24"),
+				ipPool("other", "10.180.1.128/25"),
+				ipPool("invalid", "garbage"),
+			}
+			Expect(reconciler.freeSubnet(pools)).To(Equal(netip.MustParsePrefix("10.180.2.0/24")))
+		})
+
+		It("skips subnets within a larger pool", func() {
+			Expect(reconciler.freeSubnet([]v3.IPPool{ipPool("wide", "10.180.0.0/23")})).To(Equal(netip.MustParsePrefix("10.180.2.0/24")))
+		})
+
+		It("fails if the parent CIDR is exhausted", func() {
+			_, err := reconciler.freeSubnet([]v3.IPPool{ipPool("all", "10.0.0.0/8")})
+			Expect(err).To(MatchError(errPoolCIDRExhausted))
+		})
+
+		It("allocates IPv6 subnets", func() {
+			reconciler := &RackIPPoolReconciler{ParentCIDR: netip.MustParsePrefix("fd00:180::/112"), PrefixLength: 120}
+			Expect(reconciler.freeSubnet([]v3.IPPool{ipPool("rack-a", "fd00:180::/120")})).To(Equal(netip.MustParsePrefix("fd00:180::100/120")))
+		})
+
+	})
+
+	Describe("rackPoolName", func() {
+
+		It("uses valid topology values as they are", func() {
+			Expect(rackPoolName("rack-1", nil)).To(Equal("rack-rack-1"))
+		})
+
+		It("gives values that sanitize to the same name different names", func() {
+			sanitized := rackPoolName("Rack_1", nil)
+			Expect(sanitized).To(HavePrefix("rack-rack-1-"))
+			Expect(sanitized).ToNot(Equal(rackPoolName("rack-1", nil)))
+			Expect(sanitized).ToNot(Equal(rackPoolName("rack.1", nil)))
+		})
+
+		It("hashes names taken by another pool", func() {
+			name := rackPoolName("rack-1", []v3.IPPool{ipPool("rack-rack-1", "10.180.0.0/24")})
+			Expect(name).To(HavePrefix("rack-rack-1-"))
+		})
+
+	})
+
+	Describe("Reconcile", func() {
+
+		var (
+			reconciler *RackIPPoolReconciler
+			builder    *fake.ClientBuilder
+		)
+
+		node := func(name, topologyValue string) *corev1.Node {
+			node := &corev1.Node{}
+			node.Name = name
+			node.Labels = map[string]string{"rack": topologyValue}
+			return node
+		}
+		rackPool := func(topologyValue, cidr string) *v3.IPPool {
+			pool := ipPool(rackPoolPrefix+topologyValue, cidr)
+			pool.Labels = map[string]string{config.KubeLabelManaged: config.KubeApp, topologyv1alpha1.TopologyValue: topologyValue}
+			return &pool
+		}
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(v3.AddToScheme(scheme)).To(Succeed())
+			Expect(topologyv1alpha1.AddToScheme(scheme)).To(Succeed())
+			builder = fake.NewClientBuilder().WithScheme(scheme)
+			reconciler = &RackIPPoolReconciler{
+				NodeTopologyLabel: "rack",
+				ParentCIDR:        netip.MustParsePrefix("10.180.0.0/16"),
+				PrefixLength:      24,
+				RetireGracePeriod: time.Hour,
+			}
+		})
+
+		reconcile := func(ctx SpecContext, objects ...client.Object) []v3.IPPool {
+			reconciler.Client = builder.WithObjects(objects...).Build()
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: config.Cfg.Namespace, Name: config.Cfg.DefaultName}})
+			Expect(err).ToNot(HaveOccurred())
+			pools := &v3.IPPoolList{}
+			Expect(reconciler.List(ctx, pools)).To(Succeed())
+			return pools.Items
+		}
+
+		labelDiscovery := func(values ...string) *topologyv1alpha1.LabelDiscovery {
+			labelDiscovery := &topologyv1alpha1.LabelDiscovery{}
+			labelDiscovery.Name = config.Cfg.DefaultName
+			labelDiscovery.Namespace = config.Cfg.Namespace
+			labelDiscovery.Status.DiscoveredTopologyValues = map[string]topologyv1alpha1.DiscoveredTopologyValue{}
+			for _, value := range values {
+				labelDiscovery.Status.DiscoveredTopologyValues[value] = topologyv1alpha1.DiscoveredTopologyValue{}
+			}
+			return labelDiscovery
+		}
+
+		It("retires nothing without LabelDiscovery", func(ctx SpecContext) {
+			pools := reconcile(ctx, node("node-a", "rack1"), rackPool("rack1", "10.180.0.0/24"))
+			Expect(pools).To(HaveLen(1))
+			Expect(pools[0].Spec.Disabled).To(BeFalse())
+		})
+
+		It("keeps the pools of racks with nodes the LabelDiscovery does not list", func(ctx SpecContext) {
+			pools := reconcile(ctx, labelDiscovery("rack2"), node("node-a", "rack1"), node("node-b", "rack2"),
+				rackPool("rack1", "10.180.0.0/24"), rackPool("rack3", "10.180.2.0/24"))
+			Expect(pools).To(HaveLen(3))
+			byValue := map[string]v3.IPPool{}
+			for _, pool := range pools {
+				byValue[pool.Labels[topologyv1alpha1.TopologyValue]] = pool
+			}
+			Expect(byValue["rack1"].Spec.Disabled).To(BeFalse())
+			Expect(byValue["rack2"].Spec.CIDR).To(Equal("10.180.1.0/24"))
+			Expect(byValue["rack3"].Spec.Disabled).To(BeTrue())
+		})
+
+		DescribeTable("creates pools with explicit defaults, the CRDs are not defaulted",
+			func(ctx SpecContext, parentCIDR string, prefixLength, blockSize int) {
+				reconciler.ParentCIDR = netip.MustParsePrefix(parentCIDR)
+				reconciler.PrefixLength = prefixLength
+				pools := reconcile(ctx, labelDiscovery("rack1"), node("node-a", "rack1"))
+				Expect(pools).To(HaveLen(1))
+				Expect(pools[0].Spec.BlockSize).To(Equal(blockSize))
+				Expect(pools[0].Spec.IPIPMode).To(Equal(v3.IPIPModeNever))
+				Expect(pools[0].Spec.VXLANMode).To(Equal(v3.VXLANModeNever))
+				Expect(pools[0].Spec.NodeSelector).To(Equal(`rack == "rack1"`))
+			},
+			Entry("IPv4", "10.180.0.0/16", 24, defaultBlockSizeV4),
+			Entry("IPv6", "fd00:180::/112", 120, defaultBlockSizeV6),
+		)
+
+		It("copies encapsulation and outgoing NAT from the first enabled pool of the same family", func(ctx SpecContext) {
+			pool := func(name, cidr string, ipipMode v3.IPIPMode, vxlanMode v3.VXLANMode, disabled bool) *v3.IPPool {
+				pool := ipPool(name, cidr)
+				pool.Spec.IPIPMode = ipipMode
+				pool.Spec.VXLANMode = vxlanMode
+				pool.Spec.NATOutgoing = true
+				pool.Spec.Disabled = disabled
+				return &pool
+			}
+			managed := rackPool("rack0", "10.180.0.0/24")
+			managed.Spec.IPIPMode = v3.IPIPModeAlways
+			pools := reconcile(ctx, labelDiscovery("rack0", "rack1"), node("node-a", "rack0"), node("node-b", "rack1"), managed,
+				pool("a-disabled", "10.1.0.0/16", v3.IPIPModeAlways, v3.VXLANModeNever, true),
+				pool("b-ipv6", "fd00::/64", v3.IPIPModeNever, v3.VXLANModeAlways, false),
+				pool("default-ipv4-ippool", "10.0.0.0/16", v3.IPIPModeNever, v3.VXLANModeCrossSubnet, false),
+				pool("z-other", "10.2.0.0/16", v3.IPIPModeCrossSubnet, v3.VXLANModeNever, false))
+			index := slices.IndexFunc(pools, func(pool v3.IPPool) bool {
+				return pool.Labels[topologyv1alpha1.TopologyValue] == "rack1"
+			})
+			Expect(index).NotTo(Equal(-1))
+			Expect(pools[index].Spec.IPIPMode).To(Equal(v3.IPIPModeNever))
+			Expect(pools[index].Spec.VXLANMode).To(Equal(v3.VXLANModeCrossSubnet))
+			Expect(pools[index].Spec.NATOutgoing).To(BeTrue())
+		})
+
+	})
+
+})
@@ -0,0 +1,146 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+// remoteASRulesKey is the key of the remote AS mapping rules in their ConfigMap
+const remoteASRulesKey = "rules.yaml"
+
+// remoteASRule maps the peers of a topology value, in a CIDR or both to a remote AS number
+type remoteASRule struct {
+	Name          string `json:"name"`
+	TopologyValue string `json:"topologyValue,omitempty"`
+	CIDR          string `json:"cidr,omitempty"`
+	ASNumber      int64  `json:"asNumber"`
+
+	network *net.IPNet
+}
+
+// remoteAS is the resolved AS number of a peer and where it was taken from
+type remoteAS struct {
+	asNumber uint32
+	source   string
+}
+
+// remoteASRules reads the remote AS mapping rules from their ConfigMap, nil if none is configured
+func (r *CalicoBgpReconciler) remoteASRules(ctx context.Context) ([]remoteASRule, error) {
+	if r.RemoteASConfigMap == "" {
+		return nil, nil
+	}
+	configMap := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: config.Cfg.Namespace, Name: r.RemoteASConfigMap}, configMap)
+	if err != nil {
+		return nil, fmt.Errorf("error getting remote AS mapping %s: %w", r.RemoteASConfigMap, err)
+	}
+	return parseRemoteASRules(configMap.Data[remoteASRulesKey])
+}
+
+// parseRemoteASRules parses and validates a list of remote AS mapping rules
+func parseRemoteASRules(data string) ([]remoteASRule, error) {
+	var rules []remoteASRule
+	err := yaml.UnmarshalStrict([]byte(data), &rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote AS mapping: %w", err)
+	}
+	names := map[string]struct{}{}
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("remote AS mapping rule %d has no name", i)
+		}
+		if _, ok := names[rule.Name]; ok {
+			return nil, fmt.Errorf("duplicate remote AS mapping rule %s", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+		if rule.TopologyValue == "" && rule.CIDR == "" {
+			return nil, fmt.Errorf("remote AS mapping rule %s matches neither a topology value nor a CIDR", rule.Name)
+		}
+		if _, err := int64ToUint32(rule.ASNumber); err != nil || rule.ASNumber == 0 {
+			return nil, fmt.Errorf("remote AS mapping rule %s has invalid AS number %d", rule.Name, rule.ASNumber)
+		}
+		if rule.CIDR != "" {
+			_, rule.network, err = net.ParseCIDR(rule.CIDR)
+			if err != nil {
+				return nil, fmt.Errorf("remote AS mapping rule %s: %w", rule.Name, err)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// matchRemoteASRule returns the most specific rule matching a peer: rules matching topology value and CIDR win over
+// rules matching the CIDR only, which win over rules matching the topology value only. Longer prefixes win, and the
+// first of equally specific rules is used.
+func matchRemoteASRule(rules []remoteASRule, topologyValue, ip string) *remoteASRule {
+	peerIP := net.ParseIP(ip)
+	var best *remoteASRule
+	bestScore := -1
+	for i := range rules {
+		rule := &rules[i]
+		if rule.TopologyValue != "" && rule.TopologyValue != topologyValue {
+			continue
+		}
+		// topology value only scores 0, CIDR only 1000 and both 2000, plus the prefix length
+		score := 0
+		if rule.network != nil {
+			if peerIP == nil || !rule.network.Contains(peerIP) {
+				continue
+			}
+			ones, _ := rule.network.Mask.Size()
+			score = 1000 + ones
+			if rule.TopologyValue != "" {
+				score += 1000
+			}
+		}
+		if score > bestScore {
+			best = rule
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// resolveRemoteAS returns the AS number of a peer: a PeeringProfile setting it wins over the
+// mapping rules, which win over --bgp-remote-as
+func resolveRemoteAS(rules []remoteASRule, topologyValue, ip string, profile *bgpv1alpha1.PeeringProfile) (remoteAS, error) {
+	if profile != nil && profile.Spec.Template.ASNumber != nil {
+		asNumber, err := int64ToUint32(*profile.Spec.Template.ASNumber)
+		return remoteAS{asNumber: asNumber, source: "PeeringProfile/" + profile.Name}, err
+	}
+	if rule := matchRemoteASRule(rules, topologyValue, ip); rule != nil {
+		asNumber, err := int64ToUint32(rule.ASNumber)
+		return remoteAS{asNumber: asNumber, source: "rule/" + rule.Name}, err
+	}
+	asNumber, err := intToUint32(config.Cfg.BgpRemoteAs)
+	return remoteAS{asNumber: asNumber, source: "--bgp-remote-as"}, err
+}
+
+// isRemoteASConfigMap filters the ConfigMap holding the remote AS mapping rules
+func (r *CalicoBgpReconciler) isRemoteASConfigMap(obj client.Object) bool {
+	return obj.GetNamespace() == config.Cfg.Namespace && obj.GetName() == r.RemoteASConfigMap
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Remote AS mapping", func() {
+
+	Describe("parseRemoteASRules", func() {
+
+		It("parses the rules and their CIDRs", func() {
+			rules, err := parseRemoteASRules(`
+- name: rack1
+  topologyValue: rack1
+  asNumber: 65001
+- name: tor-a
+  cidr: 10.0.0.0/24
+  asNumber: 65002
+`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rules).To(HaveLen(2))
+			Expect(rules[0].network).To(BeNil())
+			Expect(rules[1].network.String()).To(Equal("10.0.0.0/24"))
+		})
+
+		It("accepts no rules", func() {
+			rules, err := parseRemoteASRules("")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rules).To(BeEmpty())
+		})
+
+		DescribeTable("rejects invalid rules",
+			func(data, message string) {
+				_, err := parseRemoteASRules(data)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("unknown field", "- name: a\n  cidr: 10.0.0.0/8\n  asNumber: 65001\n  as: 1\n", "invalid remote AS mapping"),
+			Entry("missing name", "- cidr: 10.0.0.0/8\n  asNumber: 65001\n", "rule 0 has no name"),
+			Entry("duplicate name", "- name: a\n  cidr: 10.0.0.0/8\n  asNumber: 65001\n- name: a\n  cidr: 10.1.0.0/16\n  asNumber: 65002\n", "duplicate remote AS mapping rule a"),
+			Entry("no match", "- name: a\n  asNumber: 65001\n", "matches neither a topology value nor a CIDR"),
+			Entry("AS number 0", "- name: a\n  cidr: 10.0.0.0/8\n  asNumber: 0\n", "invalid AS number 0"),
+			Entry("AS number too large", "- name: a\n  cidr: 10.0.0.0/8\n  asNumber: 4294967296\n", "invalid AS number 4294967296"),
+			Entry("invalid CIDR", "- name: a\n  cidr: 10.0.0.0/33\n  asNumber: 65001\n", "remote AS mapping rule a"),
+		)
+
+	})
+
+	Describe("matchRemoteASRule", func() {
+
+		rules, err := parseRemoteASRules(`
+- name: rack1
+  topologyValue: rack1
+  asNumber: 65001
+- name: wide
+  cidr: 10.0.0.0/16
+  asNumber: 65002
+- name: narrow
+  cidr: 10.0.1.0/24
+  asNumber: 65003
+- name: narrow-again
+  cidr: 10.0.1.0/24
+  asNumber: 65004
+- name: rack1-narrow
+  topologyValue: rack1
+  cidr: 10.0.1.0/24
+  asNumber: 65005
+- name: v6
+  cidr: fd00::/64
+  asNumber: 65006
+`)
+
+		DescribeTable("picks the most specific rule",
+			func(topologyValue, ip, expected string) {
+				Expect(err).ToNot(HaveOccurred())
+				rule := matchRemoteASRule(rules, topologyValue, ip)
+				if expected == "" {
+					Expect(rule).To(BeNil())
+					return
+				}
+				Expect(rule).ToNot(BeNil())
+				Expect(rule.Name).To(Equal(expected))
+			},
+			Entry("topology value and CIDR over CIDR only", "rack1", "10.0.1.1", "rack1-narrow"),
+			Entry("CIDR only over topology value only", "rack1", "10.0.0.1", "wide"),
+			Entry("longer prefix, the first of equal ones", "rack2", "10.0.1.1", "narrow"),
+			Entry("topology value only", "rack1", "172.16.0.1", "rack1"),
+			Entry("IPv6", "rack2", "fd00::1", "v6"),
+			Entry("no match", "rack2", "192.168.0.1", ""),
+			Entry("invalid IP", "rack2", "invalid", ""),
+		)
+
+	})
+
+})
@@ -0,0 +1,252 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+// sessionKeepingFields are the drifted fields BIRD applies to a running session, replacing any other field restarts it
+var sessionKeepingFields = []string{"filters"}
+
+const (
+	// rolloutPollInterval is the interval sessions of a replaced peer are checked in
+	rolloutPollInterval = 15 * time.Second
+	// nodeStatusUpdatePeriod is the update period of the CalicoNodeStatus objects managed by the controller
+	nodeStatusUpdatePeriod uint32 = 10
+	nodeStatusPrefix              = "cni-nanny-"
+)
+
+// peerRollout collects the BGPPeers of a rack that need to be replaced
+type peerRollout struct {
+	// outdated peers differ from their rendered spec
+	outdated []*v3.BGPPeer
+	// specs are the rendered specs of the outdated peers by name
+	specs map[string]v3.BGPPeerSpec
+	// pending peers were replaced, but their sessions are not verified yet
+	pending []*v3.BGPPeer
+}
+
+// rolloutState is the outcome of a rollout step of a rack
+type rolloutState struct {
+	// peer is the BGPPeer currently being replaced
+	peer string
+	// waiting are the nodes without an established session to peer
+	waiting []string
+	// timedOut is set if the sessions did not establish within the rollout timeout
+	timedOut bool
+}
+
+// add records an existing BGPPeer of the rack, returns true if it is up to date
+func (p *peerRollout) add(existing *v3.BGPPeer, spec v3.BGPPeerSpec) bool {
+	if _, ok := existing.Annotations[bgpv1alpha1.PeerReplacedAt]; ok {
+		p.pending = append(p.pending, existing)
+	}
+	if equality.Semantic.DeepEqual(existing.Spec, spec) {
+		return true
+	}
+	if p.specs == nil {
+		p.specs = map[string]v3.BGPPeerSpec{}
+	}
+	p.specs[existing.Name] = spec
+	p.outdated = append(p.outdated, existing)
+	return false
+}
+
+// done reports whether all peers of the rack are up to date and verified
+func (p *peerRollout) done() bool {
+	return len(p.outdated) == 0 && len(p.pending) == 0
+}
+
+// rollPeers replaces the outdated BGPPeers of a rack one at a time. A replaced peer is only
+// considered done once every node it applies to reports an established session to it, nodes
+// are the nodes using the BGPPeers of the rack.
+func (r *CalicoBgpReconciler) rollPeers(ctx context.Context, topologyValue string, rollout *peerRollout, nodes []string) (*rolloutState, error) {
+	if rollout.done() {
+		return nil, nil
+	}
+	for _, peer := range rollout.pending {
+		replacedAt, err := time.Parse(time.RFC3339, peer.Annotations[bgpv1alpha1.PeerReplacedAt])
+		if err != nil {
+			log.FromContext(ctx).Info("ignoring invalid replaced-at annotation", "peer", peer.Name)
+			replacedAt = time.Time{}
+		}
+		peerNodes := nodes
+		if peer.Spec.Node != "" {
+			peerNodes = []string{peer.Spec.Node}
+		}
+		waiting, err := r.sessionsNotEstablished(ctx, topologyValue, peer.Spec.PeerIP, peerNodes, replacedAt,
+			peer.Annotations[bgpv1alpha1.PeerSessionReset] == "true")
+		if err != nil {
+			return nil, err
+		}
+		if len(waiting) > 0 {
+			return &rolloutState{
+				peer:     peer.Name,
+				waiting:  waiting,
+				timedOut: r.RolloutTimeout > 0 && time.Since(replacedAt) > r.RolloutTimeout,
+			}, nil
+		}
+		log.FromContext(ctx).Info("sessions established on all nodes", "peer", peer.Name)
+		patch := client.MergeFrom(peer.DeepCopy())
+		delete(peer.Annotations, bgpv1alpha1.PeerReplacedAt)
+		delete(peer.Annotations, bgpv1alpha1.PeerSessionReset)
+		err = r.Patch(ctx, peer, patch)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(rollout.outdated) == 0 {
+		return nil, nil
+	}
+	peer := rollout.outdated[0]
+	spec := rollout.specs[peer.Name]
+	patch := client.MergeFrom(peer.DeepCopy())
+	drifted := driftedFields(peer.Spec, spec)
+	log.FromContext(ctx).Info("replacing calico peer", "peer", peer.Name, "drifted", drifted,
+		"remaining", len(rollout.outdated)-1)
+	peer.Spec = spec
+	if peer.Annotations == nil {
+		peer.Annotations = map[string]string{}
+	}
+	peer.Annotations[bgpv1alpha1.PeerReplacedAt] = time.Now().UTC().Format(time.RFC3339)
+	delete(peer.Annotations, bgpv1alpha1.PeerSessionReset)
+	if slices.ContainsFunc(drifted, func(field string) bool { return !slices.Contains(sessionKeepingFields, field) }) {
+		peer.Annotations[bgpv1alpha1.PeerSessionReset] = "true"
+	}
+	err := r.Patch(ctx, peer, patch)
+	if err != nil {
+		return nil, err
+	}
+	return &rolloutState{peer: peer.Name}, nil
+}
+
+// sessionsNotEstablished returns the nodes without an established session to peerIP reported since the given time.
+// If reset is set, the session itself must have been established since then.
+func (r *CalicoBgpReconciler) sessionsNotEstablished(ctx context.Context, topologyValue, peerIP string, nodes []string, since time.Time, reset bool) ([]string, error) {
+	establishedSince := time.Time{}
+	if reset {
+		establishedSince = since
+	}
+	var waiting []string
+	for _, nodeName := range nodes {
+		status, err := r.ensureNodeStatus(ctx, topologyValue, nodeName)
+		if err != nil {
+			return nil, err
+		}
+		if status == nil || status.Status.LastUpdated.Time.Before(since) || !sessionEstablished(status, peerIP, establishedSince) {
+			waiting = append(waiting, nodeName)
+		}
+	}
+	return waiting, nil
+}
+
+// ensureNodeStatus returns the CalicoNodeStatus of a node, it is created if missing and nil is returned
+func (r *CalicoBgpReconciler) ensureNodeStatus(ctx context.Context, topologyValue, nodeName string) (*v3.CalicoNodeStatus, error) {
+	status := &v3.CalicoNodeStatus{}
+	err := r.Get(ctx, types.NamespacedName{Name: nodeStatusPrefix + nodeName}, status)
+	if err == nil {
+		return status, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	period := nodeStatusUpdatePeriod
+	status = &v3.CalicoNodeStatus{
+		Spec: v3.CalicoNodeStatusSpec{
+			Node:                nodeName,
+			Classes:             []v3.NodeStatusClassType{v3.NodeStatusClassTypeBGP},
+			UpdatePeriodSeconds: &period,
+		},
+	}
+	status.Name = nodeStatusPrefix + nodeName
+	status.Labels = map[string]string{
+		config.KubeLabelComponent:      "CalicoNodeStatus",
+		config.KubeLabelManaged:        config.KubeApp,
+		topologyv1alpha1.TopologyValue: topologyValue,
+	}
+	log.FromContext(ctx).Info("creating calico node status", "node", nodeName)
+	err = r.Create(ctx, status)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// driftedFields names the fields of a BGPPeer spec that differ from the rendered one
+func driftedFields(current, rendered v3.BGPPeerSpec) []string {
+	var fields []string
+	if current.ASNumber != rendered.ASNumber {
+		fields = append(fields, "asNumber")
+	}
+	if !slices.Equal(current.Filters, rendered.Filters) {
+		fields = append(fields, "filters")
+	}
+	if current.NodeSelector != rendered.NodeSelector {
+		fields = append(fields, "nodeSelector")
+	}
+	if current.Node != rendered.Node {
+		fields = append(fields, "node")
+	}
+	if current.PeerIP != rendered.PeerIP {
+		fields = append(fields, "peerIP")
+	}
+	if !equality.Semantic.DeepEqual(current.Password, rendered.Password) {
+		fields = append(fields, "password")
+	}
+	if len(fields) == 0 {
+		fields = append(fields, "template")
+	}
+	return fields
+}
+
+// sessionEstablished reports whether a CalicoNodeStatus lists an established session to peerIP. Unless since is zero,
+// the session must have been established at or after it, a session established before was not restarted yet.
+func sessionEstablished(status *v3.CalicoNodeStatus, peerIP string, since time.Time) bool {
+	peers := slices.Concat(status.Status.BGP.PeersV4, status.Status.BGP.PeersV6)
+	return slices.ContainsFunc(peers, func(peer v3.CalicoNodeBGPPeer) bool {
+		if peer.PeerIP != peerIP || peer.State != v3.BGPSessionStateEstablished {
+			return false
+		}
+		if since.IsZero() {
+			return true
+		}
+		established, ok := parseSince(peer.Since, status.Status.LastUpdated.Time)
+		return ok && !established.Before(since)
+	})
+}
+
+// message describes the rollout state for the PeersApplied condition
+func (s *rolloutState) message() string {
+	if len(s.waiting) == 0 {
+		return "replacing BGPPeer " + s.peer
+	}
+	return fmt.Sprintf("replacing BGPPeer %s, waiting for established sessions on nodes %s", s.peer, strings.Join(s.waiting, ", "))
+}
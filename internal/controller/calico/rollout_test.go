@@ -0,0 +1,105 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	"github.com/projectcalico/api/pkg/lib/numorstring"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("sessionEstablished", func() {
+
+	replacedAt := time.Date(2025, 5, 6, 10, 0, 0, 0, time.UTC)
+
+	nodeStatus := func(peers ...v3.CalicoNodeBGPPeer) *v3.CalicoNodeStatus {
+		status := &v3.CalicoNodeStatus{}
+		status.Status.LastUpdated = metav1.NewTime(replacedAt.Add(time.Minute))
+		status.Status.BGP.PeersV4 = peers
+		return status
+	}
+
+	DescribeTable("verifies the session to a replaced peer",
+		func(peer v3.CalicoNodeBGPPeer, expected bool) {
+			Expect(sessionEstablished(nodeStatus(peer), "10.0.0.1", replacedAt)).To(Equal(expected))
+		},
+		Entry("established after the replacement",
+			v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.1", State: v3.BGPSessionStateEstablished, Since: "10:00:30"}, true),
+		Entry("established at the replacement",
+			v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.1", State: v3.BGPSessionStateEstablished, Since: "10:00:00"}, true),
+		Entry("established before the replacement",
+			v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.1", State: v3.BGPSessionStateEstablished, Since: "09:59:59"}, false),
+		Entry("established on an earlier day",
+			v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.1", State: v3.BGPSessionStateEstablished, Since: "2025-05-01"}, false),
+		Entry("without a valid since",
+			v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.1", State: v3.BGPSessionStateEstablished, Since: "garbage"}, false),
+		Entry("not established",
+			v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.1", State: v3.BGPSessionStateActive, Since: "10:00:30"}, false),
+		Entry("to another peer",
+			v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.2", State: v3.BGPSessionStateEstablished, Since: "10:00:30"}, false),
+	)
+
+	It("accepts any established session without a time", func() {
+		peer := v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.1", State: v3.BGPSessionStateEstablished, Since: "2025-05-01"}
+		Expect(sessionEstablished(nodeStatus(peer), "10.0.0.1", time.Time{})).To(BeTrue())
+	})
+
+	It("finds IPv6 sessions", func() {
+		status := nodeStatus()
+		status.Status.BGP.PeersV6 = []v3.CalicoNodeBGPPeer{{PeerIP: "fd00::1", State: v3.BGPSessionStateEstablished, Since: "10:01:00"}}
+		Expect(sessionEstablished(status, "fd00::1", replacedAt)).To(BeTrue())
+	})
+
+})
+
+var _ = Describe("driftedFields", func() {
+
+	render := func() v3.BGPPeerSpec {
+		return v3.BGPPeerSpec{
+			PeerIP:       "10.0.0.1",
+			ASNumber:     numorstring.ASNumber(65001),
+			NodeSelector: "rack == 'rack1'",
+			Filters:      []string{"export"},
+			Password: &v3.BGPPassword{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "bgp-password"}, Key: "password",
+			}},
+		}
+	}
+
+	DescribeTable("lists the fields differing from the rendered spec",
+		func(mutate func(*v3.BGPPeerSpec), expected []string) {
+			current := render()
+			mutate(&current)
+			Expect(driftedFields(current, render())).To(Equal(expected))
+		},
+		Entry("AS number", func(spec *v3.BGPPeerSpec) { spec.ASNumber = 65002 }, []string{"asNumber"}),
+		Entry("filters", func(spec *v3.BGPPeerSpec) { spec.Filters = nil }, []string{"filters"}),
+		Entry("node selector", func(spec *v3.BGPPeerSpec) { spec.NodeSelector = "all()" }, []string{"nodeSelector"}),
+		Entry("node", func(spec *v3.BGPPeerSpec) { spec.Node = "node-a" }, []string{"node"}),
+		Entry("peer IP", func(spec *v3.BGPPeerSpec) { spec.PeerIP = "10.0.0.2" }, []string{"peerIP"}),
+		Entry("password", func(spec *v3.BGPPeerSpec) { spec.Password.SecretKeyRef.Key = "other" }, []string{"password"}),
+		Entry("several fields in order", func(spec *v3.BGPPeerSpec) {
+			spec.ASNumber = 65002
+			spec.Password = nil
+		}, []string{"asNumber", "password"}),
+		Entry("other template fields", func(spec *v3.BGPPeerSpec) { spec.KeepOriginalNextHop = true }, []string{"template"}),
+	)
+
+})
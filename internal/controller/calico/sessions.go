@@ -0,0 +1,195 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+const (
+	// sessionPollInterval is the interval the session state of the peers of a rack is refreshed in
+	sessionPollInterval = time.Minute
+	// sessionStateNotReported is the state of a peer missing in the CalicoNodeStatus of a node
+	sessionStateNotReported = "NotReported"
+)
+
+// sinceLayouts are the time formats BIRD reports session state changes in
+var sinceLayouts = []string{time.DateTime, time.DateOnly}
+
+var (
+	peerSessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cni_nanny_bgp_peer_sessions",
+		Help: "Number of sampled nodes of a rack per BGP session state of a peer.",
+	}, []string{"topology_value", "peer_ip", "state"})
+	peerSessionUptime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cni_nanny_bgp_peer_session_uptime_seconds",
+		Help: "Time since an established BGP session of a sampled node to a peer came up.",
+	}, []string{"topology_value", "peer_ip", "node"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(peerSessions, peerSessionUptime)
+}
+
+// syncNodeStatuses manages the CalicoNodeStatus objects of the sampled nodes of a rack and returns the reported ones.
+// While a rollout verifies sessions on every node, statuses of the other nodes are kept.
+func (r *CalicoBgpReconciler) syncNodeStatuses(ctx context.Context, topologyValue string, rolling bool) ([]v3.CalicoNodeStatus, error) {
+	nodes := &corev1.NodeList{}
+	err := r.List(ctx, nodes, client.MatchingLabels{config.Cfg.NodeTopologyLabel: topologyValue})
+	if err != nil {
+		return nil, err
+	}
+	sampled := sampleNodes(nodes.Items, r.SessionStatusNodes)
+	var reported []v3.CalicoNodeStatus
+	for _, node := range sampled {
+		status, err := r.ensureNodeStatus(ctx, topologyValue, node)
+		if err != nil {
+			return nil, err
+		}
+		if status != nil && !status.Status.LastUpdated.IsZero() {
+			reported = append(reported, *status)
+		}
+	}
+	if rolling {
+		return reported, nil
+	}
+	return reported, r.deleteNodeStatuses(ctx, topologyValue, sampled)
+}
+
+// deleteNodeStatuses deletes the CalicoNodeStatus objects of a rack except the ones of the nodes to keep
+func (r *CalicoBgpReconciler) deleteNodeStatuses(ctx context.Context, topologyValue string, keep []string) error {
+	statuses := &v3.CalicoNodeStatusList{}
+	err := r.List(ctx, statuses, client.MatchingLabels{
+		config.KubeLabelManaged:        config.KubeApp,
+		topologyv1alpha1.TopologyValue: topologyValue,
+	})
+	if err != nil {
+		return err
+	}
+	for i := range statuses.Items {
+		status := &statuses.Items[i]
+		if slices.Contains(keep, status.Spec.Node) {
+			continue
+		}
+		log.FromContext(ctx).Info("deleting calico node status", "node", status.Spec.Node)
+		err = r.Delete(ctx, status)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sampleNodes returns the names of the first count nodes by name, all nodes if count is 0 and none if it is negative
+func sampleNodes(nodes []corev1.Node, count int) []string {
+	if count < 0 {
+		return nil
+	}
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	slices.Sort(names)
+	if count > 0 && count < len(names) {
+		names = names[:count]
+	}
+	return names
+}
+
+// aggregateSessions returns the session state of each effective peer on the nodes of the given statuses
+func aggregateSessions(effective []bgpv1alpha1.EffectivePeer, statuses []v3.CalicoNodeStatus) []bgpv1alpha1.PeerSession {
+	if len(statuses) == 0 {
+		return nil
+	}
+	slices.SortFunc(statuses, func(a, b v3.CalicoNodeStatus) int {
+		return strings.Compare(a.Spec.Node, b.Spec.Node)
+	})
+	sessions := make([]bgpv1alpha1.PeerSession, 0, len(effective))
+	for _, peer := range effective {
+		session := bgpv1alpha1.PeerSession{IP: peer.IP}
+		for _, status := range statuses {
+			node := bgpv1alpha1.NodeSession{Node: status.Spec.Node, State: sessionStateNotReported}
+			peers := slices.Concat(status.Status.BGP.PeersV4, status.Status.BGP.PeersV6)
+			if i := slices.IndexFunc(peers, func(p v3.CalicoNodeBGPPeer) bool { return p.PeerIP == peer.IP }); i >= 0 {
+				node.State = string(peers[i].State)
+				node.Since = peers[i].Since
+			}
+			if node.State == string(v3.BGPSessionStateEstablished) {
+				session.Established++
+			}
+			session.Nodes = append(session.Nodes, node)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// updateSessionMetrics exports the session state of the peers of a rack
+func updateSessionMetrics(topologyValue string, sessions []bgpv1alpha1.PeerSession) {
+	deleteSessionMetrics(topologyValue)
+	now := time.Now()
+	for _, session := range sessions {
+		for _, node := range session.Nodes {
+			peerSessions.WithLabelValues(topologyValue, session.IP, node.State).Inc()
+			if node.State != string(v3.BGPSessionStateEstablished) {
+				continue
+			}
+			if since, ok := parseSince(node.Since, now); ok {
+				peerSessionUptime.WithLabelValues(topologyValue, session.IP, node.Node).Set(now.Sub(since).Seconds())
+			}
+		}
+	}
+}
+
+// deleteSessionMetrics removes the session metrics of a rack that has no effective peers or is gone
+func deleteSessionMetrics(topologyValue string) {
+	peerSessions.DeletePartialMatch(prometheus.Labels{"topology_value": topologyValue})
+	peerSessionUptime.DeletePartialMatch(prometheus.Labels{"topology_value": topologyValue})
+}
+
+// parseSince parses the time of a session state change as reported by BIRD in the UTC time of calico-node. A bare
+// time of day refers to the day of now, or to the day before if it would be in the future.
+func parseSince(since string, now time.Time) (time.Time, bool) {
+	for _, layout := range sinceLayouts {
+		if t, err := time.Parse(layout, since); err == nil {
+			return t, true
+		}
+	}
+	t, err := time.Parse(time.TimeOnly, since)
+	if err != nil {
+		return time.Time{}, false
+	}
+	now = now.UTC()
+	t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	if t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t, true
+}
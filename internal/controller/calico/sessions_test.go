@@ -0,0 +1,140 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+)
+
+var _ = Describe("Sessions", func() {
+
+	Describe("parseSince", func() {
+
+		now := time.Date(2025, 5, 6, 10, 0, 0, 0, time.UTC)
+
+		DescribeTable("parses the BIRD time formats as UTC",
+			func(since string, expected time.Time) {
+				t, ok := parseSince(since, now)
+				Expect(ok).To(BeTrue())
+				Expect(t).To(BeTemporally("==", expected))
+				Expect(t.Location()).To(Equal(time.UTC))
+			},
+			Entry("date and time", "2025-05-01 08:30:00", time.Date(2025, 5, 1, 8, 30, 0, 0, time.UTC)),
+			Entry("date", "2025-05-01", time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)),
+			Entry("time of today", "09:15:00", time.Date(2025, 5, 6, 9, 15, 0, 0, time.UTC)),
+			Entry("time of yesterday", "10:30:00", time.Date(2025, 5, 5, 10, 30, 0, 0, time.UTC)),
+		)
+
+		It("uses the UTC day of now", func() {
+			local := now.In(time.FixedZone("UTC+12", 12*60*60))
+			t, ok := parseSince("09:15:00", local)
+			Expect(ok).To(BeTrue())
+			Expect(t).To(BeTemporally("==", time.Date(2025, 5, 6, 9, 15, 0, 0, time.UTC)))
+		})
+
+		It("rejects other formats", func() {
+			_, ok := parseSince("", now)
+			Expect(ok).To(BeFalse())
+			_, ok = parseSince("yesterday", now)
+			Expect(ok).To(BeFalse())
+		})
+
+	})
+
+	Describe("sampleNodes", func() {
+
+		nodes := func(names ...string) []corev1.Node {
+			var nodes []corev1.Node
+			for _, name := range names {
+				node := corev1.Node{}
+				node.Name = name
+				nodes = append(nodes, node)
+			}
+			return nodes
+		}
+
+		It("samples the first nodes by name", func() {
+			Expect(sampleNodes(nodes("node-c", "node-a", "node-b"), 2)).To(Equal([]string{"node-a", "node-b"}))
+		})
+
+		It("samples all nodes for 0 or more than the rack has", func() {
+			Expect(sampleNodes(nodes("node-b", "node-a"), 0)).To(Equal([]string{"node-a", "node-b"}))
+			Expect(sampleNodes(nodes("node-b", "node-a"), 5)).To(Equal([]string{"node-a", "node-b"}))
+		})
+
+		It("samples no nodes if negative", func() {
+			Expect(sampleNodes(nodes("node-a"), -1)).To(BeEmpty())
+		})
+
+	})
+
+	Describe("aggregateSessions", func() {
+
+		nodeStatus := func(node string, peers ...v3.CalicoNodeBGPPeer) v3.CalicoNodeStatus {
+			status := v3.CalicoNodeStatus{}
+			status.Spec.Node = node
+			status.Status.BGP.PeersV4 = peers
+			return status
+		}
+
+		effective := []bgpv1alpha1.EffectivePeer{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}
+
+		It("reports nothing without statuses", func() {
+			Expect(aggregateSessions(effective, nil)).To(BeNil())
+		})
+
+		It("aggregates the sessions of every effective peer by node", func() {
+			statuses := []v3.CalicoNodeStatus{
+				nodeStatus("node-b",
+					v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.1", State: v3.BGPSessionStateActive, Since: "09:00:00"}),
+				nodeStatus("node-a",
+					v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.1", State: v3.BGPSessionStateEstablished, Since: "08:00:00"},
+					v3.CalicoNodeBGPPeer{PeerIP: "10.0.0.2", State: v3.BGPSessionStateEstablished, Since: "2025-05-01"}),
+			}
+			Expect(aggregateSessions(effective, statuses)).To(Equal([]bgpv1alpha1.PeerSession{
+				{IP: "10.0.0.1", Established: 1, Nodes: []bgpv1alpha1.NodeSession{
+					{Node: "node-a", State: "Established", Since: "08:00:00"},
+					{Node: "node-b", State: "Active", Since: "09:00:00"},
+				}},
+				{IP: "10.0.0.2", Established: 1, Nodes: []bgpv1alpha1.NodeSession{
+					{Node: "node-a", State: "Established", Since: "2025-05-01"},
+					{Node: "node-b", State: sessionStateNotReported},
+				}},
+			}))
+		})
+
+	})
+
+	It("deletes the metrics of a rack", func() {
+		updateSessionMetrics("rack-metrics", []bgpv1alpha1.PeerSession{
+			{IP: "10.0.0.1", Established: 1, Nodes: []bgpv1alpha1.NodeSession{{Node: "node-a", State: "Established", Since: "2025-05-01"}}},
+		})
+		Expect(testutil.CollectAndCount(peerSessions)).To(Equal(1))
+		Expect(testutil.CollectAndCount(peerSessionUptime)).To(Equal(1))
+
+		deleteSessionMetrics("rack-metrics")
+		Expect(testutil.CollectAndCount(peerSessions)).To(BeZero())
+		Expect(testutil.CollectAndCount(peerSessionUptime)).To(BeZero())
+	})
+
+})
@@ -0,0 +1,152 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+)
+
+// staleState is the outcome of retiring the stale BGPPeers of a rack
+type staleState struct {
+	// peers are the stale BGPPeers still present
+	peers []string
+	// blocked describes why the stale peers are kept
+	blocked string
+	// requeueAfter is the time until the next stale peer can be deleted
+	requeueAfter time.Duration
+}
+
+// peerName is the name of the BGPPeer of a peer of a topology value
+func peerName(topologyValue, ip string) string {
+	return "bgp-peer-" + topologyValue + "-" + ip
+}
+
+// peerCheck is an effective peer and the nodes that need an established session to it
+type peerCheck struct {
+	ip    string
+	nodes []string
+}
+
+// retireStalePeers deletes the managed BGPPeers of a rack not in kept any more, make-before-break: stale peers
+// are only deleted once the sessions of all checks are established and the grace period passed.
+// Without effective peers nothing is deleted.
+func (r *CalicoBgpReconciler) retireStalePeers(ctx context.Context, topologyValue string, kept []string, checks []peerCheck) (*staleState, error) {
+	peers, err := r.ownedPeers(ctx, topologyValue)
+	if err != nil {
+		return nil, err
+	}
+	state := &staleState{}
+	var stale []*v3.BGPPeer
+	for i := range peers {
+		peer := &peers[i]
+		if slices.Contains(kept, peer.Name) {
+			if _, ok := peer.Annotations[bgpv1alpha1.PeerStaleSince]; ok {
+				err = r.markStale(ctx, peer, false)
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if _, ok := peer.Annotations[bgpv1alpha1.PeerStaleSince]; !ok {
+			log.FromContext(ctx).Info("calico peer is stale", "peer", peer.Name)
+			err = r.markStale(ctx, peer, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+		stale = append(stale, peer)
+		state.peers = append(state.peers, peer.Name)
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	if len(checks) == 0 {
+		state.blocked = "no effective peers left"
+		state.requeueAfter = sessionPollInterval
+		return state, nil
+	}
+	for _, check := range checks {
+		waiting, err := r.sessionsNotEstablished(ctx, topologyValue, check.ip, check.nodes, time.Time{}, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(waiting) > 0 {
+			state.blocked = fmt.Sprintf("waiting for established sessions to %s on nodes %s", check.ip, strings.Join(waiting, ", "))
+			state.requeueAfter = rolloutPollInterval
+			return state, nil
+		}
+	}
+	state.peers = nil
+	for _, peer := range stale {
+		staleSince, err := time.Parse(time.RFC3339, peer.Annotations[bgpv1alpha1.PeerStaleSince])
+		if err != nil {
+			// restart the grace period once, instead of on every pass
+			log.FromContext(ctx).Info("replacing invalid stale-since annotation", "peer", peer.Name)
+			staleSince = time.Now()
+			err = r.markStale(ctx, peer, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if remaining := r.StalePeerGracePeriod - time.Since(staleSince); remaining > 0 {
+			state.peers = append(state.peers, peer.Name)
+			if state.requeueAfter == 0 || remaining < state.requeueAfter {
+				state.requeueAfter = remaining
+			}
+			continue
+		}
+		log.FromContext(ctx).Info("deleting stale calico peer", "peer", peer.Name, "peer ip", peer.Spec.PeerIP)
+		err = r.Delete(ctx, peer)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	if len(state.peers) == 0 {
+		return nil, nil
+	}
+	state.blocked = "within grace period"
+	return state, nil
+}
+
+// markStale sets or removes the stale-since annotation of a BGPPeer
+func (r *CalicoBgpReconciler) markStale(ctx context.Context, peer *v3.BGPPeer, stale bool) error {
+	patch := client.MergeFrom(peer.DeepCopy())
+	if stale {
+		if peer.Annotations == nil {
+			peer.Annotations = map[string]string{}
+		}
+		peer.Annotations[bgpv1alpha1.PeerStaleSince] = time.Now().UTC().Format(time.RFC3339)
+	} else {
+		delete(peer.Annotations, bgpv1alpha1.PeerStaleSince)
+	}
+	return r.Patch(ctx, peer, patch)
+}
+
+// message describes the stale peers for the PeersApplied condition
+func (s *staleState) message() string {
+	return fmt.Sprintf("retiring stale BGPPeers %s, %s", strings.Join(s.peers, ", "), s.blocked)
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v3 "github.com/projectcalico/api/pkg/apis/projectcalico/v3"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/config"
+)
+
+var _ = Describe("retireStalePeers", func() {
+
+	var reconciler *CalicoBgpReconciler
+
+	bgpPeer := func(name, ip string, labels map[string]string) *v3.BGPPeer {
+		peer := &v3.BGPPeer{}
+		peer.Name = name
+		peer.Labels = labels
+		peer.Spec.PeerIP = ip
+		return peer
+	}
+	owned := map[string]string{config.KubeLabelManaged: config.KubeApp, topologyv1alpha1.TopologyValue: "rack1"}
+	legacy := map[string]string{config.KubeLabelManaged: config.KubeApp}
+	kept := []string{peerName("rack1", "10.0.0.1")}
+	checks := []peerCheck{{ip: "10.0.0.1", nodes: []string{"node-a"}}}
+
+	newReconciler := func(gracePeriod time.Duration, objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(v3.AddToScheme(scheme)).To(Succeed())
+		status := &v3.CalicoNodeStatus{}
+		status.Name = nodeStatusPrefix + "node-a"
+		status.Spec.Node = "node-a"
+		status.Status.LastUpdated = metav1.Now()
+		status.Status.BGP.PeersV4 = []v3.CalicoNodeBGPPeer{{PeerIP: "10.0.0.1", State: v3.BGPSessionStateEstablished}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(objects, status)...).Build()
+		reconciler = &CalicoBgpReconciler{Client: c, APIReader: c, StalePeerGracePeriod: gracePeriod}
+	}
+
+	getPeer := func(ctx context.Context, name string) (*v3.BGPPeer, error) {
+		peer := &v3.BGPPeer{}
+		err := reconciler.Get(ctx, client.ObjectKey{Name: name}, peer)
+		return peer, err
+	}
+
+	It("retires managed peers created before the topology value label", func(ctx SpecContext) {
+		newReconciler(0,
+			bgpPeer(peerName("rack1", "10.0.0.1"), "10.0.0.1", owned),
+			bgpPeer(peerName("rack1", "10.0.0.9"), "10.0.0.9", legacy),
+			bgpPeer(peerName("rack1", "10.0.0.8"), "10.0.0.8", nil),
+			bgpPeer(peerName("rack10", "10.0.0.7"), "10.0.0.7", legacy),
+		)
+		state, err := reconciler.retireStalePeers(ctx, "rack1", kept, checks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).To(BeNil())
+
+		_, err = getPeer(ctx, peerName("rack1", "10.0.0.9"))
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		for _, name := range []string{peerName("rack1", "10.0.0.1"), peerName("rack1", "10.0.0.8"), peerName("rack10", "10.0.0.7")} {
+			_, err = getPeer(ctx, name)
+			Expect(err).ToNot(HaveOccurred(), name)
+		}
+	})
+
+	It("keeps stale peers within the grace period", func(ctx SpecContext) {
+		newReconciler(time.Hour,
+			bgpPeer(peerName("rack1", "10.0.0.1"), "10.0.0.1", owned),
+			bgpPeer(peerName("rack1", "10.0.0.9"), "10.0.0.9", owned),
+		)
+		state, err := reconciler.retireStalePeers(ctx, "rack1", kept, checks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).ToNot(BeNil())
+		Expect(state.peers).To(Equal([]string{peerName("rack1", "10.0.0.9")}))
+		Expect(state.requeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+
+		peer, err := getPeer(ctx, peerName("rack1", "10.0.0.9"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(peer.Annotations).To(HaveKey(bgpv1alpha1.PeerStaleSince))
+	})
+
+	It("replaces an invalid stale-since annotation once", func(ctx SpecContext) {
+		invalid := bgpPeer(peerName("rack1", "10.0.0.9"), "10.0.0.9", owned)
+		invalid.Annotations = map[string]string{bgpv1alpha1.PeerStaleSince: "yesterday"}
+		newReconciler(time.Hour, bgpPeer(peerName("rack1", "10.0.0.1"), "10.0.0.1", owned), invalid)
+
+		_, err := reconciler.retireStalePeers(ctx, "rack1", kept, checks)
+		Expect(err).ToNot(HaveOccurred())
+		peer, err := getPeer(ctx, invalid.Name)
+		Expect(err).ToNot(HaveOccurred())
+		staleSince := peer.Annotations[bgpv1alpha1.PeerStaleSince]
+		_, err = time.Parse(time.RFC3339, staleSince)
+		Expect(err).ToNot(HaveOccurred())
+
+		time.Sleep(time.Second)
+		_, err = reconciler.retireStalePeers(ctx, "rack1", kept, checks)
+		Expect(err).ToNot(HaveOccurred())
+		peer, err = getPeer(ctx, invalid.Name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(peer.Annotations[bgpv1alpha1.PeerStaleSince]).To(Equal(staleSince))
+	})
+
+	It("unmarks peers that are effective again", func(ctx SpecContext) {
+		peer := bgpPeer(peerName("rack1", "10.0.0.1"), "10.0.0.1", owned)
+		peer.Annotations = map[string]string{bgpv1alpha1.PeerStaleSince: time.Now().UTC().Format(time.RFC3339)}
+		newReconciler(time.Hour, peer)
+
+		state, err := reconciler.retireStalePeers(ctx, "rack1", kept, checks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).To(BeNil())
+		peer, err = getPeer(ctx, peer.Name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(peer.Annotations).ToNot(HaveKey(bgpv1alpha1.PeerStaleSince))
+	})
+
+})
@@ -18,9 +18,13 @@ package topology
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -29,12 +33,15 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/clients"
 	"github.com/sapcc/cni-nanny/internal/config"
 )
 
 // LabelDiscoveryReconciler reconciles a LabelDiscovery object
 type LabelDiscoveryReconciler struct {
 	client.Client
+	// APIReader reads around the cache, status patches refetch through it on conflicts
+	APIReader         client.Reader
 	Scheme            *runtime.Scheme
 	DefaultName       string
 	Namespace         string
@@ -93,9 +100,8 @@ func (r *LabelDiscoveryReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	val.Finalized = false
 
 	if !containsKey(labelDiscovery.Status.DiscoveredTopologyValues, labelName) {
-		patch := client.MergeFrom(labelDiscovery.DeepCopy())
 		log.FromContext(ctx).Info("appending label value", labelDiscovery.Name, labelName)
-		err := r.appendStatus(ctx, labelName, &val, patch, labelDiscovery)
+		err := r.appendStatus(ctx, labelName, &val, labelDiscovery)
 		if err != nil {
 			log.FromContext(ctx).Error(err, "error updating labelDiscovery status")
 		}
@@ -125,16 +131,35 @@ func generateLabelDiscovery(nsName types.NamespacedName, label string, labelDisc
 	return *labelDiscovery
 }
 
-func (r *LabelDiscoveryReconciler) appendStatus(ctx context.Context, name string, label *topologyv1alpha1.DiscoveredTopologyValue, patch client.Patch, labelDiscovery *topologyv1alpha1.LabelDiscovery) error {
-	if labelDiscovery.Status.DiscoveredTopologyValues == nil {
-		labelDiscovery.Status.DiscoveredTopologyValues = make(map[string]topologyv1alpha1.DiscoveredTopologyValue)
-	}
-	labelDiscovery.Status.DiscoveredTopologyValues[name] = *label
-	err := r.Status().Patch(ctx, labelDiscovery, patch)
-	if err != nil {
-		return err
-	}
-	return nil
+func (r *LabelDiscoveryReconciler) appendStatus(ctx context.Context, name string, label *topologyv1alpha1.DiscoveredTopologyValue, labelDiscovery *topologyv1alpha1.LabelDiscovery) error {
+	_, err := clients.PatchStatus(ctx, r.Client, r.APIReader, labelDiscovery, func(labelDiscovery *topologyv1alpha1.LabelDiscovery) {
+		if _, ok := labelDiscovery.Status.DiscoveredTopologyValues[name]; ok {
+			// another reconcile added the value meanwhile, its finalization must not be reset
+			return
+		}
+		if labelDiscovery.Status.DiscoveredTopologyValues == nil {
+			labelDiscovery.Status.DiscoveredTopologyValues = make(map[string]topologyv1alpha1.DiscoveredTopologyValue)
+		}
+		labelDiscovery.Status.DiscoveredTopologyValues[name] = *label
+		labelDiscovery.Status.ObservedGeneration = labelDiscovery.Generation
+		meta.SetStatusCondition(&labelDiscovery.Status.Conditions, metav1.Condition{
+			Type:               topologyv1alpha1.ConditionDiscovered,
+			Status:             metav1.ConditionTrue,
+			Reason:             topologyv1alpha1.ReasonTopologyValuesDiscovered,
+			Message:            fmt.Sprintf("%d topology values discovered", len(labelDiscovery.Status.DiscoveredTopologyValues)),
+			ObservedGeneration: labelDiscovery.Generation,
+		})
+		if pending := labelDiscovery.Status.PendingTopologyValues(); len(pending) > 0 {
+			meta.SetStatusCondition(&labelDiscovery.Status.Conditions, metav1.Condition{
+				Type:               topologyv1alpha1.ConditionPeersApplied,
+				Status:             metav1.ConditionFalse,
+				Reason:             topologyv1alpha1.ReasonPeersPending,
+				Message:            "waiting for topology values " + strings.Join(pending, ", "),
+				ObservedGeneration: labelDiscovery.Generation,
+			})
+		}
+	})
+	return err
 }
 
 func containsKey[M ~map[K]V, K comparable, V any](m M, k K) bool {
@@ -0,0 +1,65 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CacheFileName is the name of the discovery result file inside the cache directory
+const CacheFileName = "discovery.json"
+
+// Result is the last discovery result of a node
+type Result struct {
+	Timestamp     time.Time `json:"timestamp"`
+	TopologyValue string    `json:"topologyValue"`
+	SourceAddress string    `json:"sourceAddress,omitempty"`
+	Peers         []string  `json:"peers"`
+}
+
+// LoadResult reads the cached discovery result from dir.
+// It returns nil without an error if nothing has been cached yet.
+func LoadResult(dir string) (*Result, error) {
+	data, err := os.ReadFile(filepath.Join(dir, CacheFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var result Result
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SaveResult atomically writes the discovery result to dir
+func SaveResult(dir string, result *Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, CacheFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, CacheFileName))
+}
@@ -0,0 +1,38 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/sapcc/cni-nanny/internal/discovery"
+)
+
+var _ = Describe("Result cache", func() {
+
+	It("returns nil if nothing is cached", func() {
+		result, err := discovery.LoadResult(GinkgoT().TempDir())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(BeNil())
+	})
+
+	It("loads a saved result", func() {
+		dir := GinkgoT().TempDir()
+		saved := &discovery.Result{
+			Timestamp:     time.Now().UTC().Truncate(time.Second),
+			TopologyValue: "rack1",
+			SourceAddress: "10.0.0.1",
+			Peers:         []string{"10.10.11.10", "10.10.11.11"},
+		}
+		Expect(discovery.SaveResult(dir, saved)).To(Succeed())
+
+		result, err := discovery.LoadResult(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(saved))
+	})
+
+})
@@ -0,0 +1,86 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/sapcc/go-traceroute/traceroute"
+)
+
+// ProbeStats summarizes a series of probes sent to a directly connected peer
+type ProbeStats struct {
+	Sent int
+	RTTs []time.Duration
+}
+
+// Prober sends ttl=1 probes to directly connected peers over a single raw socket
+type Prober struct {
+	tracer *traceroute.Tracer
+}
+
+// NewProber returns a prober sending from source, or from the address chosen by the kernel if source is nil
+func NewProber(source net.IP) *Prober {
+	return &Prober{tracer: newTracer(source)}
+}
+
+// Close releases the raw socket of the prober
+func (p *Prober) Close() {
+	p.tracer.Close()
+}
+
+// Probe sends count probes to peer and collects the round trip times of the answers
+func (p *Prober) Probe(ctx context.Context, peer net.IP, count int) (ProbeStats, error) {
+	stats := ProbeStats{Sent: count}
+	for range count {
+		err := p.tracer.Trace(ctx, peer, func(reply *traceroute.Reply) {
+			if reply.IP.Equal(peer) {
+				stats.RTTs = append(stats.RTTs, reply.RTT)
+			}
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// Loss returns the ratio of probes that were not answered
+func (s ProbeStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	lost := max(s.Sent-len(s.RTTs), 0)
+	return float64(lost) / float64(s.Sent)
+}
+
+// AvgRTT returns the mean round trip time of the answered probes
+func (s ProbeStats) AvgRTT() time.Duration {
+	if len(s.RTTs) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, rtt := range s.RTTs {
+		sum += rtt
+	}
+	return sum / time.Duration(len(s.RTTs))
+}
+
+// Jitter returns the mean difference between consecutive round trip times
+func (s ProbeStats) Jitter() time.Duration {
+	if len(s.RTTs) < 2 {
+		return 0
+	}
+	var sum time.Duration
+	for i := 1; i < len(s.RTTs); i++ {
+		diff := s.RTTs[i] - s.RTTs[i-1]
+		if diff < 0 {
+			diff = -diff
+		}
+		sum += diff
+	}
+	return sum / time.Duration(len(s.RTTs)-1)
+}
@@ -0,0 +1,34 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/sapcc/cni-nanny/internal/discovery"
+)
+
+var _ = Describe("ProbeStats", func() {
+
+	It("computes rtt, jitter and loss", func() {
+		stats := discovery.ProbeStats{
+			Sent: 4,
+			RTTs: []time.Duration{2 * time.Millisecond, 4 * time.Millisecond, 3 * time.Millisecond},
+		}
+		Expect(stats.AvgRTT()).To(Equal(3 * time.Millisecond))
+		Expect(stats.Jitter()).To(Equal(1500 * time.Microsecond))
+		Expect(stats.Loss()).To(BeNumerically("~", 0.25))
+	})
+
+	It("reports full loss without answers", func() {
+		stats := discovery.ProbeStats{Sent: 3}
+		Expect(stats.AvgRTT()).To(BeZero())
+		Expect(stats.Jitter()).To(BeZero())
+		Expect(stats.Loss()).To(BeNumerically("~", 1.0))
+	})
+
+})
@@ -0,0 +1,57 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"fmt"
+	"net"
+)
+
+// InterfaceAddress returns the probe source address of the named interface of this node
+func InterfaceAddress(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	ip := SelectSourceAddress(addrs)
+	if ip == nil {
+		return nil, fmt.Errorf("interface %s has no usable IPv4 address", name)
+	}
+	return ip, nil
+}
+
+// SelectSourceAddress picks the first IPv4 address that is neither a loopback nor a link-local address,
+// so a BGP address on the loopback interface is found next to 127.0.0.1
+func SelectSourceAddress(addrs []net.Addr) net.IP {
+	for _, addr := range addrs {
+		var ip net.IP
+		switch a := addr.(type) {
+		case *net.IPNet:
+			ip = a.IP
+		case *net.IPAddr:
+			ip = a.IP
+		}
+		ip = ip.To4()
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		return ip
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/sapcc/cni-nanny/internal/discovery"
+)
+
+var _ = Describe("SelectSourceAddress", func() {
+
+	cidr := func(s string) net.Addr {
+		ip, ipNet, err := net.ParseCIDR(s)
+		Expect(err).NotTo(HaveOccurred())
+		ipNet.IP = ip
+		return ipNet
+	}
+
+	It("skips loopback, link-local and IPv6 addresses", func() {
+		addrs := []net.Addr{cidr("127.0.0.1/8"), cidr("::1/128"), cidr("169.254.0.1/16"), cidr("10.0.0.5/32"), cidr("10.1.0.5/24")}
+		Expect(discovery.SelectSourceAddress(addrs).String()).To(Equal("10.0.0.5"))
+	})
+
+	It("returns nil without a usable address", func() {
+		Expect(discovery.SelectSourceAddress([]net.Addr{cidr("127.0.0.1/8"), cidr("fe80::1/64")})).To(BeNil())
+	})
+
+	It("fails for an unknown interface", func() {
+		_, err := discovery.InterfaceAddress("does-not-exist0")
+		Expect(err).To(HaveOccurred())
+	})
+})
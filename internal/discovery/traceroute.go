@@ -23,17 +23,10 @@ import (
 	"github.com/sapcc/go-traceroute/traceroute"
 )
 
-// GetNeighbors discovers next-hops by sending traceroute packets with ttl=1
-func GetNeighbors(count int) ([]*net.IP, error) {
-	t := &traceroute.Tracer{
-		Config: traceroute.Config{
-			Delay:    50 * time.Millisecond,
-			Timeout:  time.Second,
-			MaxHops:  1,
-			Count:    1,
-			Networks: []string{"ip4:icmp", "ip4:ip"},
-		},
-	}
+// GetNeighbors discovers next-hops by sending traceroute packets with ttl=1.
+// If source is set, probes are sent from that address instead of the one chosen by the kernel.
+func GetNeighbors(count int, source net.IP) ([]*net.IP, error) {
+	t := newTracer(source)
 	defer t.Close()
 
 	h := make(map[string]struct{})
@@ -54,3 +47,66 @@ func GetNeighbors(count int) ([]*net.IP, error) {
 	}
 	return neigh, nil
 }
+
+// VerifyNeighbors probes the given next-hops directly with ttl=1 and returns the ones that answered
+func VerifyNeighbors(peers []string, source net.IP) ([]string, error) {
+	t := newTracer(source)
+	defer t.Close()
+
+	var alive []string
+	for _, peer := range peers {
+		ip := net.ParseIP(peer)
+		if ip == nil {
+			continue
+		}
+		answered := false
+		err := t.Trace(context.Background(), ip, func(reply *traceroute.Reply) {
+			if reply.IP.Equal(ip) {
+				answered = true
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if answered {
+			alive = append(alive, peer)
+		}
+	}
+	return alive, nil
+}
+
+func newTracer(source net.IP) *traceroute.Tracer {
+	t := &traceroute.Tracer{
+		Config: traceroute.Config{
+			Delay:    50 * time.Millisecond,
+			Timeout:  time.Second,
+			MaxHops:  1,
+			Count:    1,
+			Networks: []string{"ip4:icmp", "ip4:ip"},
+		},
+	}
+	if source != nil {
+		t.Addr = &net.IPAddr{IP: source}
+	}
+	return t
+}
+
+// InterfaceFor returns the name of the local interface with a subnet containing ip, or an empty string if the ip is not on-link
+func InterfaceFor(ip net.IP) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return "", err
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.Contains(ip) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/discovery"
+)
+
+var (
+	peerRTT = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cni_nanny_peer_rtt_seconds",
+		Help: "Mean round trip time of probes to a discovered BGP peer.",
+	}, []string{"topology_value", "peer_ip"})
+	peerJitter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cni_nanny_peer_jitter_seconds",
+		Help: "Mean difference between consecutive round trip times of probes to a discovered BGP peer.",
+	}, []string{"topology_value", "peer_ip"})
+	peerLoss = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cni_nanny_peer_loss_ratio",
+		Help: "Ratio of unanswered probes to a discovered BGP peer.",
+	}, []string{"topology_value", "peer_ip"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(peerRTT, peerJitter, peerLoss)
+}
+
+// Monitor continuously probes the peers of the node's rack and exports their latency and loss
+type Monitor struct {
+	Client            client.Reader
+	Namespace         string
+	NodeName          string
+	NodeTopologyLabel string
+	NodeTopologyValue string
+	Source            net.IP
+	Interval          time.Duration
+	ProbeCount        int
+}
+
+// Start implements manager.Runnable
+func (m *Monitor) Start(ctx context.Context) error {
+	topologyValue, err := m.topologyValue(ctx)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("starting peer monitor", "topology value", topologyValue, "interval", m.Interval)
+
+	prober := discovery.NewProber(m.Source)
+	defer prober.Close()
+
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+	known := map[string]struct{}{}
+	for {
+		known = m.probe(ctx, prober, topologyValue, known)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every node monitors its own peers
+func (m *Monitor) NeedLeaderElection() bool {
+	return false
+}
+
+func (m *Monitor) probe(ctx context.Context, prober *discovery.Prober, topologyValue string, known map[string]struct{}) map[string]struct{} {
+	bgpPeerDiscovery := &bgpv1alpha1.BgpPeerDiscovery{}
+	err := m.Client.Get(ctx, types.NamespacedName{Name: topologyValue, Namespace: m.Namespace}, bgpPeerDiscovery)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "error getting bgpPeerDiscovery", "topology value", topologyValue)
+		return known
+	}
+
+	current := map[string]struct{}{}
+	for _, peer := range nodePeers(bgpPeerDiscovery.Status, m.NodeName) {
+		ip := net.ParseIP(peer)
+		if ip == nil {
+			continue
+		}
+		current[peer] = struct{}{}
+		stats, err := prober.Probe(ctx, ip, m.ProbeCount)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "error probing peer", "peer", peer)
+		}
+		record(topologyValue, peer, stats, err)
+	}
+	for peer := range known {
+		if _, ok := current[peer]; !ok {
+			peerRTT.DeleteLabelValues(topologyValue, peer)
+			peerJitter.DeleteLabelValues(topologyValue, peer)
+			peerLoss.DeleteLabelValues(topologyValue, peer)
+		}
+	}
+	return current
+}
+
+// nodePeers returns the peers of a node: the peers of its node-specific BGPPeers if it is an exception of the rack,
+// else the peers it discovered itself, else the peers of the rack
+func nodePeers(status bgpv1alpha1.BgpPeerDiscoveryStatus, nodeName string) []string {
+	for _, exception := range status.NodeExceptions {
+		if exception.Node == nodeName {
+			return exception.Peers
+		}
+	}
+	if peers, ok := status.NodePeers[nodeName]; ok && len(peers.Peers) > 0 {
+		return peers.Peers
+	}
+	peers := []string{}
+	for _, peer := range status.PeerList() {
+		peers = append(peers, peer.IP)
+	}
+	return peers
+}
+
+// record exports the probe results of a peer. A failed probe or a peer answering no probe counts as lost,
+// its round trip time and jitter are removed instead of keeping the values of the last answers.
+func record(topologyValue, peer string, stats discovery.ProbeStats, err error) {
+	if err != nil || len(stats.RTTs) == 0 {
+		peerRTT.DeleteLabelValues(topologyValue, peer)
+		peerJitter.DeleteLabelValues(topologyValue, peer)
+		peerLoss.WithLabelValues(topologyValue, peer).Set(1)
+		return
+	}
+	peerRTT.WithLabelValues(topologyValue, peer).Set(stats.AvgRTT().Seconds())
+	peerJitter.WithLabelValues(topologyValue, peer).Set(stats.Jitter().Seconds())
+	peerLoss.WithLabelValues(topologyValue, peer).Set(stats.Loss())
+}
+
+// topologyValue returns the configured topology value or reads it from the node's topology label
+func (m *Monitor) topologyValue(ctx context.Context) (string, error) {
+	if m.NodeTopologyValue != "" {
+		return m.NodeTopologyValue, nil
+	}
+	node := &corev1.Node{}
+	err := m.Client.Get(ctx, types.NamespacedName{Name: m.NodeName}, node)
+	if err != nil {
+		return "", err
+	}
+	value, ok := node.Labels[m.NodeTopologyLabel]
+	if !ok {
+		return "", fmt.Errorf("node %s has no %s label", m.NodeName, m.NodeTopologyLabel)
+	}
+	return value, nil
+}
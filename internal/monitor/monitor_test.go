@@ -0,0 +1,82 @@
+// Copyright 2024 SAP SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/discovery"
+)
+
+var _ = Describe("Peer monitor", func() {
+
+	status := bgpv1alpha1.BgpPeerDiscoveryStatus{
+		DiscoveredPeers: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		NodePeers: map[string]bgpv1alpha1.NodePeers{
+			"node-a": {Peers: []string{"10.0.0.1", "10.0.0.2"}},
+			"node-b": {Peers: []string{"10.0.0.3"}},
+			"node-c": {Peers: []string{}},
+		},
+		NodeExceptions: []bgpv1alpha1.NodeException{{Node: "node-b", Peers: []string{"10.0.0.3"}}},
+	}
+
+	DescribeTable("nodePeers",
+		func(nodeName string, expected []string) {
+			Expect(nodePeers(status, nodeName)).To(Equal(expected))
+		},
+		Entry("an exception node probes its node-specific peers", "node-b", []string{"10.0.0.3"}),
+		Entry("a node probes the peers it discovered", "node-a", []string{"10.0.0.1", "10.0.0.2"}),
+		Entry("a node that found no peers probes the peers of the rack", "node-c", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}),
+		Entry("a node without discovery probes the peers of the rack", "node-d", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}),
+	)
+
+	Describe("record", func() {
+
+		BeforeEach(func() {
+			DeferCleanup(func() {
+				peerRTT.Reset()
+				peerJitter.Reset()
+				peerLoss.Reset()
+			})
+		})
+
+		answered := discovery.ProbeStats{Sent: 2, RTTs: []time.Duration{time.Millisecond, 3 * time.Millisecond}}
+
+		It("exports round trip time, jitter and loss of answered probes", func() {
+			record("rack1", "10.0.0.1", answered, nil)
+			Expect(testutil.ToFloat64(peerRTT.WithLabelValues("rack1", "10.0.0.1"))).To(BeNumerically("~", 0.002))
+			Expect(testutil.ToFloat64(peerJitter.WithLabelValues("rack1", "10.0.0.1"))).To(BeNumerically("~", 0.002))
+			Expect(testutil.ToFloat64(peerLoss.WithLabelValues("rack1", "10.0.0.1"))).To(BeZero())
+		})
+
+		DescribeTable("drops the last round trip time and reports full loss",
+			func(stats discovery.ProbeStats, err error) {
+				record("rack1", "10.0.0.1", answered, nil)
+				record("rack1", "10.0.0.1", stats, err)
+				Expect(testutil.CollectAndCount(peerRTT)).To(BeZero())
+				Expect(testutil.CollectAndCount(peerJitter)).To(BeZero())
+				Expect(testutil.ToFloat64(peerLoss.WithLabelValues("rack1", "10.0.0.1"))).To(Equal(1.0))
+			},
+			Entry("if the probe fails", discovery.ProbeStats{Sent: 2}, errors.New("network unreachable")),
+			Entry("if no probe is answered", discovery.ProbeStats{Sent: 2}, nil),
+		)
+	})
+})
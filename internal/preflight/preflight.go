@@ -0,0 +1,267 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package preflight
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+)
+
+const (
+	procNetRoute       = "/proc/net/route"
+	procPingGroupRange = "/proc/sys/net/ipv4/ping_group_range"
+)
+
+// Check is the result of a single preflight check
+type Check struct {
+	Name    string
+	Passed  bool
+	Message string
+}
+
+// Options configures the preflight checks
+type Options struct {
+	NodeName  string
+	Namespace string
+}
+
+// Run executes all preflight checks. A nil client skips the checks that need the API server.
+func Run(ctx context.Context, kube kubernetes.Interface, opts Options) []Check {
+	checks := []Check{
+		checkRawSocket(),
+		checkDefaultRoute(),
+		checkInterfaces(),
+	}
+	if kube == nil {
+		checks = append(checks, Check{Name: "api server", Message: "no client configuration found"})
+		return checks
+	}
+	checks = append(checks,
+		checkAPIServer(kube),
+		checkHostNetwork(ctx, kube, opts.NodeName),
+	)
+	for _, access := range requiredAccess(opts.Namespace) {
+		checks = append(checks, CheckAccess(ctx, kube, access))
+	}
+	return checks
+}
+
+// requiredAccess lists the permissions of the discovery job: it reads its node, watches and patches the
+// LabelDiscoveries and writes the BgpPeerDiscovery of its rack
+func requiredAccess(namespace string) []authorizationv1.ResourceAttributes {
+	topologyGroup := topologyv1alpha1.GroupVersion.Group
+	return []authorizationv1.ResourceAttributes{
+		{Verb: "get", Resource: "nodes"},
+		{Namespace: namespace, Verb: "get", Group: topologyGroup, Resource: "labeldiscoveries"},
+		{Namespace: namespace, Verb: "list", Group: topologyGroup, Resource: "labeldiscoveries"},
+		{Namespace: namespace, Verb: "watch", Group: topologyGroup, Resource: "labeldiscoveries"},
+		{Namespace: namespace, Verb: "patch", Group: topologyGroup, Resource: "labeldiscoveries"},
+		{Namespace: namespace, Verb: "get", Group: bgpv1alpha1.GroupVersion.Group, Resource: "bgppeerdiscoveries"},
+		{Namespace: namespace, Verb: "create", Group: bgpv1alpha1.GroupVersion.Group, Resource: "bgppeerdiscoveries"},
+		{Namespace: namespace, Verb: "patch", Group: bgpv1alpha1.GroupVersion.Group, Resource: "bgppeerdiscoveries", Subresource: "status"},
+	}
+}
+
+// Report prints a pass/fail line for each check and returns true if all checks passed
+func Report(w io.Writer, checks []Check) bool {
+	passed := true
+	for _, c := range checks {
+		result := "PASS"
+		if !c.Passed {
+			result = "FAIL"
+			passed = false
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", result, c.Name, c.Message)
+	}
+	return passed
+}
+
+// checkRawSocket verifies that discovery can open the raw ICMP socket traceroute sends its probes on.
+// Ping sockets are not enough, traceroute writes its own IP headers, so the check fails without CAP_NET_RAW
+// and only mentions whether ping sockets would be allowed.
+func checkRawSocket() Check {
+	c := Check{Name: "raw socket"}
+	conn, err := net.ListenIP("ip4:icmp", nil)
+	if err == nil {
+		conn.Close()
+		c.Passed = true
+		c.Message = "CAP_NET_RAW available"
+		return c
+	}
+	data, readErr := os.ReadFile(procPingGroupRange)
+	if readErr == nil && PingGroupAllowed(string(data), os.Getgid()) {
+		c.Message = fmt.Sprintf("CAP_NET_RAW missing, ping sockets are allowed for gid %d but traceroute needs raw sockets: %v", os.Getgid(), err)
+		return c
+	}
+	c.Message = fmt.Sprintf("CAP_NET_RAW missing: %v", err)
+	return c
+}
+
+// PingGroupAllowed reports whether gid is inside the net.ipv4.ping_group_range sysctl value
+func PingGroupAllowed(groupRange string, gid int) bool {
+	fields := strings.Fields(groupRange)
+	if len(fields) != 2 {
+		return false
+	}
+	low, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return false
+	}
+	high, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return false
+	}
+	return low <= gid && gid <= high
+}
+
+func checkDefaultRoute() Check {
+	c := Check{Name: "default route"}
+	f, err := os.Open(procNetRoute)
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+	defer f.Close()
+	iface, err := DefaultRouteInterface(f)
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+	if iface == "" {
+		c.Message = "no IPv4 default route found"
+		return c
+	}
+	c.Passed = true
+	c.Message = "via " + iface
+	return c
+}
+
+// DefaultRouteInterface returns the interface of the IPv4 default route from a /proc/net/route table
+func DefaultRouteInterface(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[0] == "Iface" {
+			continue
+		}
+		// destination and mask are both 0.0.0.0 for the default route
+		if fields[1] == "00000000" && fields[7] == "00000000" {
+			return fields[0], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+func checkInterfaces() Check {
+	c := Check{Name: "interfaces"}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+	var up []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		up = append(up, fmt.Sprintf("%s (mtu %d)", iface.Name, iface.MTU))
+	}
+	if len(up) == 0 {
+		c.Message = "no interface other than loopback is up"
+		return c
+	}
+	c.Passed = true
+	c.Message = strings.Join(up, ", ")
+	return c
+}
+
+func checkAPIServer(kube kubernetes.Interface) Check {
+	c := Check{Name: "api server"}
+	version, err := kube.Discovery().ServerVersion()
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+	c.Passed = true
+	c.Message = "reachable, version " + version.GitVersion
+	return c
+}
+
+// checkHostNetwork verifies that one of the node's addresses is configured locally
+func checkHostNetwork(ctx context.Context, kube kubernetes.Interface, nodeName string) Check {
+	c := Check{Name: "host network"}
+	if nodeName == "" {
+		c.Message = "node name unknown, set NODE_NAME or --node-name"
+		return c
+	}
+	node, err := kube.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+	for _, nodeAddr := range node.Status.Addresses {
+		if nodeAddr.Type != corev1.NodeInternalIP && nodeAddr.Type != corev1.NodeExternalIP {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.String() == nodeAddr.Address {
+				c.Passed = true
+				c.Message = "node address " + nodeAddr.Address + " is local"
+				return c
+			}
+		}
+	}
+	c.Message = "none of the addresses of node " + nodeName + " is local, is hostNetwork enabled?"
+	return c
+}
+
+// CheckAccess verifies that the service account is allowed an action
+func CheckAccess(ctx context.Context, kube kubernetes.Interface, attributes authorizationv1.ResourceAttributes) Check {
+	resource := attributes.Resource
+	if attributes.Subresource != "" {
+		resource += "/" + attributes.Subresource
+	}
+	c := Check{Name: attributes.Verb + " " + resource}
+	scope := "cluster wide"
+	if attributes.Namespace != "" {
+		scope = "in namespace " + attributes.Namespace
+	}
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+	}
+	result, err := kube.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+	if !result.Status.Allowed {
+		c.Message = "not allowed " + scope
+		if result.Status.Reason != "" {
+			c.Message += ": " + result.Status.Reason
+		}
+		return c
+	}
+	c.Passed = true
+	c.Message = "allowed " + scope
+	return c
+}
@@ -0,0 +1,66 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package preflight_test
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/sapcc/cni-nanny/internal/preflight"
+)
+
+var _ = Describe("Preflight", func() {
+
+	It("finds the default route interface", func() {
+		table := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+			"eth0\t0000140A\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+			"bond0\t00000000\t0100140A\t0003\t0\t0\t0\t00000000\t0\t0\t0\n"
+		iface, err := preflight.DefaultRouteInterface(strings.NewReader(table))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(iface).To(Equal("bond0"))
+	})
+
+	It("returns no interface without a default route", func() {
+		table := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+			"eth0\t0000140A\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n"
+		iface, err := preflight.DefaultRouteInterface(strings.NewReader(table))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(iface).To(BeEmpty())
+	})
+
+	It("checks the ping group range", func() {
+		Expect(preflight.PingGroupAllowed("0\t2147483647\n", 1000)).To(BeTrue())
+		Expect(preflight.PingGroupAllowed("1\t0\n", 0)).To(BeFalse())
+		Expect(preflight.PingGroupAllowed("garbage", 0)).To(BeFalse())
+	})
+
+	It("checks the permissions of discovery", func() {
+		kube := fake.NewClientset()
+		kube.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			attributes := review.Spec.ResourceAttributes
+			review.Status.Allowed = attributes.Resource != "nodes" && attributes.Subresource != "status"
+			return true, review, nil
+		})
+		results := map[string]preflight.Check{}
+		for _, check := range preflight.Run(context.Background(), kube, preflight.Options{Namespace: "kube-system"}) {
+			results[check.Name] = check
+		}
+		Expect(results).To(HaveKeyWithValue("get nodes", HaveField("Passed", BeFalse())))
+		Expect(results["get nodes"].Message).To(Equal("not allowed cluster wide"))
+		Expect(results).To(HaveKeyWithValue("patch bgppeerdiscoveries/status", HaveField("Passed", BeFalse())))
+		for _, name := range []string{"get labeldiscoveries", "watch labeldiscoveries", "patch labeldiscoveries", "create bgppeerdiscoveries"} {
+			Expect(results).To(HaveKeyWithValue(name, HaveField("Passed", BeTrue())))
+		}
+		Expect(results["patch labeldiscoveries"].Message).To(Equal("allowed in namespace kube-system"))
+	})
+
+})
@@ -0,0 +1,161 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/webhook/validation"
+)
+
+// SetupBgpPeerDiscoveryWebhookWithManager registers the webhooks for BgpPeerDiscovery in the manager.
+// The conversion webhook is served for every kind implementing conversion.Convertible.
+func SetupBgpPeerDiscoveryWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&bgpv1alpha1.BgpPeerDiscovery{}).
+		WithValidator(&BgpPeerDiscoveryCustomValidator{}).
+		WithDefaulter(&BgpPeerDiscoveryCustomDefaulter{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-bgp-cninanny-sap-cc-v1alpha1-bgppeerdiscovery,mutating=true,failurePolicy=fail,sideEffects=None,groups=bgp.cninanny.sap.cc,resources=bgppeerdiscoveries;bgppeerdiscoveries/status,verbs=create;update,versions=v1alpha1,name=mbgppeerdiscovery-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// BgpPeerDiscoveryCustomDefaulter sets the optional fields of BgpPeerDiscovery
+type BgpPeerDiscoveryCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &BgpPeerDiscoveryCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter
+func (d *BgpPeerDiscoveryCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	bgpPeerDiscovery, ok := obj.(*bgpv1alpha1.BgpPeerDiscovery)
+	if !ok {
+		return fmt.Errorf("expected a BgpPeerDiscovery object but got %T", obj)
+	}
+	status := &bgpPeerDiscovery.Status
+	for i := range status.Peers {
+		peer := &status.Peers[i]
+		if peer.AddressFamily == "" {
+			peer.AddressFamily = bgpv1alpha1.AddressFamilyOf(peer.IP)
+		}
+		if peer.Method == "" {
+			peer.Method = bgpv1alpha1.DiscoveryMethodTraceroute
+		}
+	}
+	if len(status.DiscoveredPeers) == 0 {
+		status.DiscoveredPeers = []string{}
+		for _, peer := range status.Peers {
+			status.DiscoveredPeers = append(status.DiscoveredPeers, peer.IP)
+		}
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-bgp-cninanny-sap-cc-v1alpha1-bgppeerdiscovery,mutating=false,failurePolicy=fail,sideEffects=None,groups=bgp.cninanny.sap.cc,resources=bgppeerdiscoveries;bgppeerdiscoveries/status,verbs=create;update,versions=v1alpha1,name=vbgppeerdiscovery-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// BgpPeerDiscoveryCustomValidator rejects BgpPeerDiscovery objects that would produce invalid Calico BGPPeers
+type BgpPeerDiscoveryCustomValidator struct{}
+
+var _ webhook.CustomValidator = &BgpPeerDiscoveryCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator
+func (v *BgpPeerDiscoveryCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	bgpPeerDiscovery, ok := obj.(*bgpv1alpha1.BgpPeerDiscovery)
+	if !ok {
+		return nil, fmt.Errorf("expected a BgpPeerDiscovery object but got %T", obj)
+	}
+	warnings, allErrs := validateBgpPeerDiscovery(bgpPeerDiscovery)
+	return warnings, invalidBgpPeerDiscovery(bgpPeerDiscovery, allErrs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (v *BgpPeerDiscoveryCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldBgpPeerDiscovery, ok := oldObj.(*bgpv1alpha1.BgpPeerDiscovery)
+	if !ok {
+		return nil, fmt.Errorf("expected a BgpPeerDiscovery object but got %T", oldObj)
+	}
+	bgpPeerDiscovery, ok := newObj.(*bgpv1alpha1.BgpPeerDiscovery)
+	if !ok {
+		return nil, fmt.Errorf("expected a BgpPeerDiscovery object but got %T", newObj)
+	}
+	warnings, allErrs := validateBgpPeerDiscovery(bgpPeerDiscovery)
+	allErrs = append(allErrs, validation.ValidateNotDecreased(oldBgpPeerDiscovery.Spec.RediscoverGeneration,
+		bgpPeerDiscovery.Spec.RediscoverGeneration, field.NewPath("spec", "rediscover_generation"))...)
+	return warnings, invalidBgpPeerDiscovery(bgpPeerDiscovery, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (v *BgpPeerDiscoveryCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateBgpPeerDiscovery(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery) (admission.Warnings, field.ErrorList) {
+	var warnings admission.Warnings
+	allErrs := field.ErrorList{}
+	// the name is the topology value and ends up in the node selector of the BGPPeers
+	allErrs = append(allErrs, validation.ValidateLabelValue(bgpPeerDiscovery.Name, field.NewPath("metadata", "name"))...)
+	if value, ok := bgpPeerDiscovery.Annotations[bgpv1alpha1.TopologyValueAnnotation]; ok {
+		allErrs = append(allErrs, validation.ValidateLabelValue(value,
+			field.NewPath("metadata", "annotations").Key(bgpv1alpha1.TopologyValueAnnotation))...)
+	}
+	if policy, ok := bgpPeerDiscovery.Annotations[bgpv1alpha1.DeletionPolicyAnnotation]; ok && !bgpv1alpha1.DeletionPolicy(policy).Valid() {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("metadata", "annotations").Key(bgpv1alpha1.DeletionPolicyAnnotation),
+			policy, []string{string(bgpv1alpha1.DeletionPolicyCleanup), string(bgpv1alpha1.DeletionPolicyOrphan)}))
+	}
+
+	specPath := field.NewPath("spec")
+	for i, ip := range bgpPeerDiscovery.Spec.StaticPeers {
+		allErrs = append(allErrs, validation.ValidatePeerIP(ip, specPath.Child("static_peers").Index(i))...)
+		if bgpPeerDiscovery.Spec.Excludes(ip) {
+			warnings = append(warnings, fmt.Sprintf("static peer %s is also excluded, it is peered with anyway", ip))
+		}
+	}
+	for i, excluded := range bgpPeerDiscovery.Spec.ExcludedPeers {
+		allErrs = append(allErrs, validation.ValidateIPOrCIDR(excluded, specPath.Child("excluded_peers").Index(i))...)
+	}
+
+	statusPath := field.NewPath("status")
+	for i, ip := range bgpPeerDiscovery.Status.DiscoveredPeers {
+		allErrs = append(allErrs, validation.ValidatePeerIP(ip, statusPath.Child("discovered_peers").Index(i))...)
+	}
+	seen := map[string]struct{}{}
+	for i, peer := range bgpPeerDiscovery.Status.Peers {
+		peerPath := statusPath.Child("peers").Index(i)
+		allErrs = append(allErrs, validation.ValidatePeerIP(peer.IP, peerPath.Child("ip"))...)
+		allErrs = append(allErrs, validation.ValidateAddressFamily(string(peer.AddressFamily), peer.IP, peerPath.Child("address_family"))...)
+		if _, ok := seen[peer.IP]; ok {
+			allErrs = append(allErrs, field.Duplicate(peerPath.Child("ip"), peer.IP))
+		}
+		seen[peer.IP] = struct{}{}
+	}
+
+	return warnings, allErrs
+}
+
+func invalidBgpPeerDiscovery(bgpPeerDiscovery *bgpv1alpha1.BgpPeerDiscovery, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(bgpv1alpha1.GroupVersion.WithKind("BgpPeerDiscovery").GroupKind(), bgpPeerDiscovery.Name, allErrs)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+)
+
+// SetupPeeringFilterWebhookWithManager registers the webhooks for PeeringFilter in the manager.
+func SetupPeeringFilterWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&bgpv1alpha1.PeeringFilter{}).
+		WithValidator(&PeeringFilterCustomValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-bgp-cninanny-sap-cc-v1alpha1-peeringfilter,mutating=false,failurePolicy=fail,sideEffects=None,groups=bgp.cninanny.sap.cc,resources=peeringfilters,verbs=create;update,versions=v1alpha1,name=vpeeringfilter-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// PeeringFilterCustomValidator rejects PeeringFilters that would render invalid Calico BGPFilters
+type PeeringFilterCustomValidator struct{}
+
+var _ webhook.CustomValidator = &PeeringFilterCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator
+func (v *PeeringFilterCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	filter, ok := obj.(*bgpv1alpha1.PeeringFilter)
+	if !ok {
+		return nil, fmt.Errorf("expected a PeeringFilter object but got %T", obj)
+	}
+	return validatePeeringFilter(filter)
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (v *PeeringFilterCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	filter, ok := newObj.(*bgpv1alpha1.PeeringFilter)
+	if !ok {
+		return nil, fmt.Errorf("expected a PeeringFilter object but got %T", newObj)
+	}
+	return validatePeeringFilter(filter)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (v *PeeringFilterCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validatePeeringFilter(filter *bgpv1alpha1.PeeringFilter) (admission.Warnings, error) {
+	var warnings admission.Warnings
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	for name, selection := range map[string]bgpv1alpha1.RouteSelection{"import": filter.Spec.Import, "export": filter.Spec.Export} {
+		for i, cidr := range selection.CIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				allErrs = append(allErrs, field.Invalid(specPath.Child(name, "cidrs").Index(i), cidr, "must be a valid CIDR"))
+			}
+		}
+	}
+	if filter.Spec.Import.Empty() && filter.Spec.Export.Empty() {
+		warnings = append(warnings, "neither import nor export selects routes, the filter accepts and advertises all routes")
+	}
+
+	if len(allErrs) == 0 {
+		return warnings, nil
+	}
+	return warnings, apierrors.NewInvalid(bgpv1alpha1.GroupVersion.WithKind("PeeringFilter").GroupKind(), filter.Name, allErrs)
+}
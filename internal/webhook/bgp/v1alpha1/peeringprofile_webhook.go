@@ -0,0 +1,170 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	bgpv1alpha1 "github.com/sapcc/cni-nanny/api/bgp/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/webhook/validation"
+)
+
+// SetupPeeringProfileWebhookWithManager registers the webhooks for PeeringProfile in the manager.
+func SetupPeeringProfileWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&bgpv1alpha1.PeeringProfile{}).
+		WithValidator(&PeeringProfileCustomValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-bgp-cninanny-sap-cc-v1alpha1-peeringprofile,mutating=false,failurePolicy=fail,sideEffects=None,groups=bgp.cninanny.sap.cc,resources=peeringprofiles,verbs=create;update,versions=v1alpha1,name=vpeeringprofile-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// PeeringProfileCustomValidator rejects PeeringProfiles that would render invalid Calico BGPPeers
+type PeeringProfileCustomValidator struct{}
+
+var _ webhook.CustomValidator = &PeeringProfileCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator
+func (v *PeeringProfileCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	profile, ok := obj.(*bgpv1alpha1.PeeringProfile)
+	if !ok {
+		return nil, fmt.Errorf("expected a PeeringProfile object but got %T", obj)
+	}
+	return validatePeeringProfile(profile)
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (v *PeeringProfileCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	profile, ok := newObj.(*bgpv1alpha1.PeeringProfile)
+	if !ok {
+		return nil, fmt.Errorf("expected a PeeringProfile object but got %T", newObj)
+	}
+	return validatePeeringProfile(profile)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (v *PeeringProfileCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validatePeeringProfile(profile *bgpv1alpha1.PeeringProfile) (admission.Warnings, error) {
+	var warnings admission.Warnings
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	for i, value := range profile.Spec.TopologyValues {
+		allErrs = append(allErrs, validation.ValidateLabelValue(value, specPath.Child("topologyValues").Index(i))...)
+	}
+	if profile.Spec.NodeSelector != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(profile.Spec.NodeSelector,
+			metav1validation.LabelSelectorValidationOptions{}, specPath.Child("nodeSelector"))...)
+	}
+	if len(profile.Spec.TopologyValues) == 0 && profile.Spec.NodeSelector == nil {
+		warnings = append(warnings, "neither topologyValues nor nodeSelector is set, the profile selects no rack")
+	}
+
+	template := profile.Spec.Template
+	templatePath := specPath.Child("template")
+	if template.ASNumber != nil {
+		allErrs = append(allErrs, validation.ValidateASNumber(*template.ASNumber, templatePath.Child("asNumber"))...)
+	}
+	for i, filter := range template.Filters {
+		if filter == "" {
+			allErrs = append(allErrs, field.Required(templatePath.Child("filters").Index(i), "filter name must not be empty"))
+		}
+	}
+	if template.ReachableBy != "" {
+		allErrs = append(allErrs, validation.ValidatePeerIP(template.ReachableBy, templatePath.Child("reachableBy"))...)
+	}
+	if template.Password != nil && template.Password.SecretKeyRef != nil {
+		ref := template.Password.SecretKeyRef
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(templatePath.Child("password", "secretKeyRef", "name"), ""))
+		}
+		if ref.Key == "" {
+			allErrs = append(allErrs, field.Required(templatePath.Child("password", "secretKeyRef", "key"), ""))
+		}
+	}
+	if profile.Spec.BGPConfiguration != nil {
+		allErrs = append(allErrs, validateBGPConfigurationTemplate(*profile.Spec.BGPConfiguration, specPath.Child("bgpConfiguration"))...)
+	}
+
+	if len(allErrs) == 0 {
+		return warnings, nil
+	}
+	return warnings, apierrors.NewInvalid(bgpv1alpha1.GroupVersion.WithKind("PeeringProfile").GroupKind(), profile.Name, allErrs)
+}
+
+// validateBGPConfigurationTemplate rejects CIDRs and communities Calico would not accept in a BGPConfiguration
+func validateBGPConfigurationTemplate(template bgpv1alpha1.BGPConfigurationTemplate, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := map[string]struct{}{}
+	for i, community := range template.Communities {
+		communityPath := fldPath.Child("communities").Index(i)
+		if community.Name == "" {
+			allErrs = append(allErrs, field.Required(communityPath.Child("name"), ""))
+		} else if _, ok := names[community.Name]; ok {
+			allErrs = append(allErrs, field.Duplicate(communityPath.Child("name"), community.Name))
+		}
+		names[community.Name] = struct{}{}
+		if !validCommunity(community.Value) {
+			allErrs = append(allErrs, field.Invalid(communityPath.Child("value"), community.Value, "must be a community aa:nn or a large community aa:nn:mm"))
+		}
+	}
+	for i, advertisement := range template.PrefixAdvertisements {
+		advertisementPath := fldPath.Child("prefixAdvertisements").Index(i)
+		if _, _, err := net.ParseCIDR(advertisement.CIDR); err != nil {
+			allErrs = append(allErrs, field.Invalid(advertisementPath.Child("cidr"), advertisement.CIDR, "must be a valid CIDR"))
+		}
+		for j, community := range advertisement.Communities {
+			if _, ok := names[community]; !ok && !validCommunity(community) {
+				allErrs = append(allErrs, field.Invalid(advertisementPath.Child("communities").Index(j), community, "must name a community or be a community value"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validCommunity reports whether a value is a standard community of two 16 bit parts or a large community of three 32 bit parts
+func validCommunity(value string) bool {
+	parts := strings.Split(value, ":")
+	bitSize := 16
+	switch len(parts) {
+	case 2:
+	case 3:
+		bitSize = 32
+	default:
+		return false
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, bitSize); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	topologyv1alpha1 "github.com/sapcc/cni-nanny/api/topology/v1alpha1"
+	"github.com/sapcc/cni-nanny/internal/webhook/validation"
+)
+
+// SetupLabelDiscoveryWebhookWithManager registers the webhooks for LabelDiscovery in the manager.
+// The conversion webhook is served for every kind implementing conversion.Convertible.
+// An empty topology label is defaulted to defaultTopologyLabel.
+func SetupLabelDiscoveryWebhookWithManager(mgr ctrl.Manager, defaultTopologyLabel string) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&topologyv1alpha1.LabelDiscovery{}).
+		WithValidator(&LabelDiscoveryCustomValidator{}).
+		WithDefaulter(&LabelDiscoveryCustomDefaulter{TopologyLabel: defaultTopologyLabel}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-topology-cninanny-sap-cc-v1alpha1-labeldiscovery,mutating=true,failurePolicy=fail,sideEffects=None,groups=topology.cninanny.sap.cc,resources=labeldiscoveries;labeldiscoveries/status,verbs=create;update,versions=v1alpha1,name=mlabeldiscovery-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// LabelDiscoveryCustomDefaulter sets the optional fields of LabelDiscovery
+type LabelDiscoveryCustomDefaulter struct {
+	TopologyLabel string
+}
+
+var _ webhook.CustomDefaulter = &LabelDiscoveryCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter
+func (d *LabelDiscoveryCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	labelDiscovery, ok := obj.(*topologyv1alpha1.LabelDiscovery)
+	if !ok {
+		return fmt.Errorf("expected a LabelDiscovery object but got %T", obj)
+	}
+	if labelDiscovery.Spec.TopologyLabel == "" {
+		labelDiscovery.Spec.TopologyLabel = d.TopologyLabel
+	}
+	if labelDiscovery.Status.DiscoveredTopologyValues == nil {
+		labelDiscovery.Status.DiscoveredTopologyValues = map[string]topologyv1alpha1.DiscoveredTopologyValue{}
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-topology-cninanny-sap-cc-v1alpha1-labeldiscovery,mutating=false,failurePolicy=fail,sideEffects=None,groups=topology.cninanny.sap.cc,resources=labeldiscoveries;labeldiscoveries/status,verbs=create;update,versions=v1alpha1,name=vlabeldiscovery-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// LabelDiscoveryCustomValidator rejects LabelDiscovery objects with invalid topology labels or values
+type LabelDiscoveryCustomValidator struct{}
+
+var _ webhook.CustomValidator = &LabelDiscoveryCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator
+func (v *LabelDiscoveryCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	labelDiscovery, ok := obj.(*topologyv1alpha1.LabelDiscovery)
+	if !ok {
+		return nil, fmt.Errorf("expected a LabelDiscovery object but got %T", obj)
+	}
+	return nil, invalidLabelDiscovery(labelDiscovery, validateLabelDiscovery(labelDiscovery))
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (v *LabelDiscoveryCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldLabelDiscovery, ok := oldObj.(*topologyv1alpha1.LabelDiscovery)
+	if !ok {
+		return nil, fmt.Errorf("expected a LabelDiscovery object but got %T", oldObj)
+	}
+	labelDiscovery, ok := newObj.(*topologyv1alpha1.LabelDiscovery)
+	if !ok {
+		return nil, fmt.Errorf("expected a LabelDiscovery object but got %T", newObj)
+	}
+	allErrs := validateLabelDiscovery(labelDiscovery)
+	allErrs = append(allErrs, validation.ValidateNotDecreased(oldLabelDiscovery.Spec.RediscoverGeneration,
+		labelDiscovery.Spec.RediscoverGeneration, field.NewPath("spec", "rediscover_generation"))...)
+	return nil, invalidLabelDiscovery(labelDiscovery, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (v *LabelDiscoveryCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateLabelDiscovery(labelDiscovery *topologyv1alpha1.LabelDiscovery) field.ErrorList {
+	allErrs := validation.ValidateLabelKey(labelDiscovery.Spec.TopologyLabel, field.NewPath("spec", "topology_label"))
+	valuesPath := field.NewPath("status", "discovered_topology_values")
+	for value := range labelDiscovery.Status.DiscoveredTopologyValues {
+		allErrs = append(allErrs, validation.ValidateLabelValue(value, valuesPath.Key(value))...)
+	}
+
+	return allErrs
+}
+
+func invalidLabelDiscovery(labelDiscovery *topologyv1alpha1.LabelDiscovery, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(topologyv1alpha1.GroupVersion.WithKind("LabelDiscovery").GroupKind(), labelDiscovery.Name, allErrs)
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package validation
+
+import (
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// ASTrans is the 2-byte placeholder for 4-byte AS numbers (RFC 6793)
+	ASTrans = 23456
+	// MaxASNumber is the largest 4-byte AS number
+	MaxASNumber = 4294967295
+)
+
+var broadcast = net.IPv4bcast
+
+// ValidatePeerIP checks that ip is an address a BGP session can be established with
+func ValidatePeerIP(ip string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		allErrs = append(allErrs, field.Invalid(fldPath, ip, "must be a valid IP address"))
+	case parsed.IsUnspecified():
+		allErrs = append(allErrs, field.Invalid(fldPath, ip, "must not be the unspecified address"))
+	case parsed.IsLoopback():
+		allErrs = append(allErrs, field.Invalid(fldPath, ip, "must not be a loopback address"))
+	case parsed.IsMulticast():
+		allErrs = append(allErrs, field.Invalid(fldPath, ip, "must not be a multicast address"))
+	case parsed.Equal(broadcast):
+		allErrs = append(allErrs, field.Invalid(fldPath, ip, "must not be the broadcast address"))
+	}
+	return allErrs
+}
+
+// ValidateIPOrCIDR checks that value is an IP address or a CIDR
+func ValidateIPOrCIDR(value string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if net.ParseIP(value) != nil {
+		return allErrs
+	}
+	if _, _, err := net.ParseCIDR(value); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, "must be a valid IP address or CIDR"))
+	}
+	return allErrs
+}
+
+// ValidateAddressFamily checks that family is IPv4 or IPv6 and matches ip
+func ValidateAddressFamily(family, ip string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if family != "IPv4" && family != "IPv6" {
+		return append(allErrs, field.NotSupported(fldPath, family, []string{"IPv4", "IPv6"}))
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return allErrs
+	}
+	if (parsed.To4() != nil) != (family == "IPv4") {
+		allErrs = append(allErrs, field.Invalid(fldPath, family, "does not match address "+ip))
+	}
+	return allErrs
+}
+
+// ValidateASNumber checks that asn is a usable 4-byte AS number, excluding the reserved values
+func ValidateASNumber(asn int64, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	switch {
+	case asn < 1 || asn > MaxASNumber:
+		allErrs = append(allErrs, field.Invalid(fldPath, asn, "must be between 1 and 4294967295"))
+	case asn == ASTrans, asn == 65535, asn == MaxASNumber:
+		allErrs = append(allErrs, field.Invalid(fldPath, asn, "must not be a reserved AS number"))
+	}
+	return allErrs
+}
+
+// ValidateLabelKey checks that key is a qualified label name
+func ValidateLabelKey(key string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if key == "" {
+		return append(allErrs, field.Required(fldPath, "label key must not be empty"))
+	}
+	for _, msg := range validation.IsQualifiedName(key) {
+		allErrs = append(allErrs, field.Invalid(fldPath, key, msg))
+	}
+	return allErrs
+}
+
+// ValidateLabelValue checks that value can be used as label value, e.g. in a node selector
+func ValidateLabelValue(value string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, msg := range validation.IsValidLabelValue(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+	}
+	return allErrs
+}
+
+// ValidateNotDecreased checks that a counter like a rediscover generation was not decreased by an update
+func ValidateNotDecreased(oldValue, newValue int64, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if newValue < oldValue {
+		allErrs = append(allErrs, field.Invalid(fldPath, newValue, fmt.Sprintf("must not be decreased from %d", oldValue)))
+	}
+	return allErrs
+}
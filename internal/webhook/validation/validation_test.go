@@ -0,0 +1,63 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package validation_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/sapcc/cni-nanny/internal/webhook/validation"
+)
+
+var _ = Describe("Validation", func() {
+	path := field.NewPath("ip")
+
+	It("accepts unicast peer addresses", func() {
+		Expect(validation.ValidatePeerIP("10.0.0.1", path)).To(BeEmpty())
+		Expect(validation.ValidatePeerIP("2001:db8::1", path)).To(BeEmpty())
+	})
+
+	It("rejects addresses that cannot be peered with", func() {
+		for _, ip := range []string{"", "not-an-ip", "0.0.0.0", "127.0.0.1", "224.0.0.5", "ff02::1", "255.255.255.255", "::"} {
+			Expect(validation.ValidatePeerIP(ip, path)).To(HaveLen(1), ip)
+		}
+	})
+
+	It("accepts IPs and CIDRs", func() {
+		Expect(validation.ValidateIPOrCIDR("10.0.0.1", path)).To(BeEmpty())
+		Expect(validation.ValidateIPOrCIDR("10.0.0.0/24", path)).To(BeEmpty())
+		Expect(validation.ValidateIPOrCIDR("2001:db8::/64", path)).To(BeEmpty())
+		Expect(validation.ValidateIPOrCIDR("10.0.0.0/33", path)).To(HaveLen(1))
+	})
+
+	It("checks the address family against the address", func() {
+		Expect(validation.ValidateAddressFamily("IPv4", "10.0.0.1", path)).To(BeEmpty())
+		Expect(validation.ValidateAddressFamily("IPv6", "2001:db8::1", path)).To(BeEmpty())
+		Expect(validation.ValidateAddressFamily("IPv6", "10.0.0.1", path)).To(HaveLen(1))
+		Expect(validation.ValidateAddressFamily("IPv5", "10.0.0.1", path)).To(HaveLen(1))
+	})
+
+	It("checks AS number ranges", func() {
+		Expect(validation.ValidateASNumber(65000, path)).To(BeEmpty())
+		Expect(validation.ValidateASNumber(4200000000, path)).To(BeEmpty())
+		for _, asn := range []int64{-1, 0, 23456, 65535, 4294967295, 4294967296} {
+			Expect(validation.ValidateASNumber(asn, path)).To(HaveLen(1), "%d", asn)
+		}
+	})
+
+	It("rejects decreased counters", func() {
+		Expect(validation.ValidateNotDecreased(1, 2, path)).To(BeEmpty())
+		Expect(validation.ValidateNotDecreased(2, 2, path)).To(BeEmpty())
+		Expect(validation.ValidateNotDecreased(2, 1, path)).To(HaveLen(1))
+	})
+
+	It("checks label syntax", func() {
+		Expect(validation.ValidateLabelKey("topology.kubernetes.io/zone", path)).To(BeEmpty())
+		Expect(validation.ValidateLabelKey("", path)).To(HaveLen(1))
+		Expect(validation.ValidateLabelKey("in valid", path)).ToNot(BeEmpty())
+		Expect(validation.ValidateLabelValue("pod123", path)).To(BeEmpty())
+		Expect(validation.ValidateLabelValue("-pod", path)).ToNot(BeEmpty())
+	})
+})